@@ -3,10 +3,10 @@ package config
 import (
 	"fmt"
 	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/pkg/payments"
 	"log"
 
 	_ "github.com/lib/pq"
-	"github.com/razorpay/razorpay-go"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -14,7 +14,11 @@ import (
 	"gorm.io/gorm"
 )
 
-var RazorpayClient *razorpay.Client
+// Payments is the gateway used for orders, refunds and signature checks
+var Payments payments.PaymentProvider
+
+// Payouts sends expert withdrawals to their bank account or UPI ID
+var Payouts payments.PayoutProvider
 
 type Config struct {
 	GoogleLoginConfig oauth2.Config
@@ -74,18 +78,60 @@ func RunMigrations() error {
 		return fmt.Errorf("migration failed: %w", err)
 	}
 
+	for _, statement := range models.GetMigrationStatements() {
+		if err := DB.Exec(statement).Error; err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
 
-func InitRazorpay() error {
+// InitPayments selects the payment gateway. The fake provider needs no
+// credentials, so the server can run locally without a Razorpay account.
+func InitPayments() error {
 	runtimeConfig := RuntimeConfig()
 
-	if runtimeConfig.RazorpayKey == "" || runtimeConfig.RazorpaySecret == "" {
-		return fmt.Errorf("missing Razorpay credentials")
+	switch runtimeConfig.PaymentProvider {
+	case payments.ProviderRazorpay:
+		provider, err := payments.NewRazorpayProvider(runtimeConfig.RazorpayKey, runtimeConfig.RazorpaySecret, runtimeConfig.RazorpayWebhookSecret)
+		if err != nil {
+			return err
+		}
+		Payments = provider
+
+	case payments.ProviderFake:
+		if runtimeConfig.AppEnv == "production" {
+			return fmt.Errorf("the fake payment provider cannot be used in production")
+		}
+		Payments = payments.NewFakeProvider(runtimeConfig.RazorpaySecret, runtimeConfig.RazorpayWebhookSecret)
+
+	default:
+		return fmt.Errorf("unknown PAYMENT_PROVIDER %q", runtimeConfig.PaymentProvider)
+	}
+
+	log.Printf("Payment provider %s initialized", Payments.Name())
+	return nil
+}
+
+func InitPayouts() error {
+	runtimeConfig := RuntimeConfig()
+
+	switch runtimeConfig.PayoutProvider {
+	case payments.PayoutProviderManual:
+		Payouts = payments.NewManualPayoutProvider()
+
+	case payments.PayoutProviderFake:
+		if runtimeConfig.AppEnv == "production" {
+			return fmt.Errorf("the fake payout provider cannot be used in production")
+		}
+		Payouts = payments.NewFakePayoutProvider()
+
+	default:
+		return fmt.Errorf("unknown PAYOUT_PROVIDER %q", runtimeConfig.PayoutProvider)
 	}
 
-	RazorpayClient = razorpay.NewClient(runtimeConfig.RazorpayKey, runtimeConfig.RazorpaySecret)
-	log.Println("Razorpay client initialized")
+	log.Printf("Payout provider %s initialized", Payouts.Name())
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
@@ -25,25 +26,125 @@ type yamlConfig struct {
 	GoogleRedirectURL  string   `yaml:"google_redirect_url"`
 	RedisEnabled       bool     `yaml:"redis_enabled"`
 	RedisUseTLS        bool     `yaml:"redis_use_tls"`
+	PaymentProvider    string   `yaml:"payment_provider"`
+	PayoutProvider     string   `yaml:"payout_provider"`
+
+	SlotHoldMinutes            int `yaml:"slot_hold_minutes"`
+	PaymentOrderTimeoutMinutes int `yaml:"payment_order_timeout_minutes"`
+
+	CancellationFullRefundHours      int `yaml:"cancellation_full_refund_hours"`
+	CancellationPartialRefundHours   int `yaml:"cancellation_partial_refund_hours"`
+	CancellationPartialRefundPercent int `yaml:"cancellation_partial_refund_percent"`
+
+	ExpertCancellationFlagThreshold int `yaml:"expert_cancellation_flag_threshold"`
+
+	MaxReschedulesPerSession int `yaml:"max_reschedules_per_session"`
+	RescheduleMinNoticeHours int `yaml:"reschedule_min_notice_hours"`
+
+	PlatformCommissionPercent int `yaml:"platform_commission_percent"`
+
+	EscrowReleaseDelayHours int `yaml:"escrow_release_delay_hours"`
+
+	PayoutMinimumInPaise int `yaml:"payout_minimum_in_paise"`
+
+	InvoicePrefix        string `yaml:"invoice_prefix"`
+	InvoiceSupplierState string `yaml:"invoice_supplier_state"`
+	GSTRatePercent       int    `yaml:"gst_rate_percent"`
+
+	ReconcileWindowHours int `yaml:"reconcile_window_hours"`
+
+	WalletRefundCreditValidityDays int `yaml:"wallet_refund_credit_validity_days"`
+	WalletPromoCreditValidityDays  int `yaml:"wallet_promo_credit_validity_days"`
+
+	SubscriptionGraceDays int `yaml:"subscription_grace_days"`
+
+	AvailabilityHorizonWeeks int `yaml:"availability_horizon_weeks"`
+
+	DefaultTimeZone string `yaml:"default_time_zone"`
 }
 
 type Runtime struct {
-	AppEnv             string
-	Port               string
-	DatabaseURL        string
-	CookieDomain       string
-	CookieSecure       bool
-	CorsAllowedOrigins []string
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURL  string
-	RedisEnabled       bool
-	RedisAddr          string
-	RedisPassword      string
-	RedisDB            int
-	RedisUseTLS        bool
-	RazorpayKey        string
-	RazorpaySecret     string
+	AppEnv                string
+	Port                  string
+	DatabaseURL           string
+	CookieDomain          string
+	CookieSecure          bool
+	CorsAllowedOrigins    []string
+	GoogleClientID        string
+	GoogleClientSecret    string
+	GoogleRedirectURL     string
+	RedisEnabled          bool
+	RedisAddr             string
+	RedisPassword         string
+	RedisDB               int
+	RedisUseTLS           bool
+	PaymentProvider       string // razorpay or fake
+	RazorpayKey           string
+	RazorpaySecret        string
+	RazorpayWebhookSecret string
+	PayoutProvider        string // manual or fake
+	PayoutEncryptionKey   string // base64, 32 bytes; encrypts stored bank/UPI details
+
+	// Booking
+	SlotHoldTTL time.Duration // how long a slot stays HELD for an unpaid order
+	// Unpaid orders older than this are expired by a background sweeper and
+	// any hold they still have is released
+	PaymentOrderTimeout time.Duration
+
+	// Student cancellation policy: a full refund when cancelling at least
+	// CancellationFullRefundBefore ahead of the session, PartialRefundPercent
+	// when at least CancellationPartialRefundBefore ahead, nothing after that.
+	CancellationFullRefundBefore     time.Duration
+	CancellationPartialRefundBefore  time.Duration
+	CancellationPartialRefundPercent int
+
+	// Experts who cancel this many booked sessions are flagged for review
+	ExpertCancellationFlagThreshold int
+
+	// Rescheduling: how often a session may move, and how close to its start
+	MaxReschedulesPerSession int
+	RescheduleMinNotice      time.Duration
+
+	// Default share of each session fee kept by the platform; experts may
+	// carry their own Expert.CommissionPercent override
+	PlatformCommissionPercent int
+
+	// Expert earnings stay in escrow until the session is completed and this
+	// long has passed after it ended; it is the student's window to dispute
+	EscrowReleaseDelay time.Duration
+
+	// Smallest withdrawal an expert may request
+	PayoutMinimumInPaise int64
+
+	// Tax invoices: numbers look like <prefix>/<financial year>/<sequence>.
+	// GST is split into CGST+SGST when the student's state matches the
+	// supplier's, and charged as IGST otherwise.
+	InvoicePrefix          string
+	InvoiceSupplierName    string
+	InvoiceSupplierAddress string
+	InvoiceSupplierGSTIN   string
+	InvoiceSupplierState   string
+	GSTRatePercent         int
+
+	// How far back the daily reconciliation against the gateway looks; it
+	// overlaps the previous run so nothing slips between two of them
+	ReconcileWindow time.Duration
+
+	// Student wallet credits expire: refunds kept as credit after
+	// WalletRefundCreditValidity, promotional and referral credits after
+	// WalletPromoCreditValidity unless granted with their own expiry
+	WalletRefundCreditValidity time.Duration
+	WalletPromoCreditValidity  time.Duration
+
+	// How long a subscription stays past due, with its renewal order open,
+	// before it lapses
+	SubscriptionGracePeriod time.Duration
+
+	// How far ahead availability rules are turned into bookable slots
+	AvailabilityHorizon time.Duration
+
+	// IANA zone for users who have not set one on their profile
+	DefaultTimeZone string
 }
 
 var (
@@ -93,22 +194,62 @@ func RuntimeConfig() Runtime {
 		port := getEnv("PORT", yamlDefault(yml.Port, "8080"))
 
 		runtimeConfig = Runtime{
-			AppEnv:             appEnv,
-			Port:               port,
-			DatabaseURL:        strings.TrimSpace(os.Getenv("DATABASE_URL")),
-			CookieDomain:       getEnv("COOKIE_DOMAIN", yml.CookieDomain),
-			CookieSecure:       getEnvBool("COOKIE_SECURE", yml.CookieSecure),
-			CorsAllowedOrigins: getEnvCSV("CORS_ALLOWED_ORIGINS", yamlDefaultSlice(yml.CorsAllowedOrigins, []string{"http://localhost:3010"})),
-			GoogleClientID:     strings.TrimSpace(os.Getenv("GOOGLE_CLIENT_ID")),
-			GoogleClientSecret: strings.TrimSpace(os.Getenv("GOOGLE_CLIENT_SECRET")),
-			GoogleRedirectURL:  getEnv("GOOGLE_REDIRECT_URL", yamlDefault(yml.GoogleRedirectURL, fmt.Sprintf("http://localhost:%s/google_callback", port))),
-			RedisEnabled:       resolveRedisEnabledWithDefault(yml.RedisEnabled),
-			RedisAddr:          strings.TrimSpace(os.Getenv("REDIS_ADDR")),
-			RedisPassword:      os.Getenv("REDIS_PASSWORD"),
-			RedisDB:            getEnvInt("REDIS_DB", 0),
-			RedisUseTLS:        getEnvBool("REDIS_USE_TLS", yml.RedisUseTLS),
-			RazorpayKey:        strings.TrimSpace(os.Getenv("RAZORPAY_KEY")),
-			RazorpaySecret:     strings.TrimSpace(os.Getenv("RAZORPAY_SECRET")),
+			AppEnv:                appEnv,
+			Port:                  port,
+			DatabaseURL:           strings.TrimSpace(os.Getenv("DATABASE_URL")),
+			CookieDomain:          getEnv("COOKIE_DOMAIN", yml.CookieDomain),
+			CookieSecure:          getEnvBool("COOKIE_SECURE", yml.CookieSecure),
+			CorsAllowedOrigins:    getEnvCSV("CORS_ALLOWED_ORIGINS", yamlDefaultSlice(yml.CorsAllowedOrigins, []string{"http://localhost:3010"})),
+			GoogleClientID:        strings.TrimSpace(os.Getenv("GOOGLE_CLIENT_ID")),
+			GoogleClientSecret:    strings.TrimSpace(os.Getenv("GOOGLE_CLIENT_SECRET")),
+			GoogleRedirectURL:     getEnv("GOOGLE_REDIRECT_URL", yamlDefault(yml.GoogleRedirectURL, fmt.Sprintf("http://localhost:%s/google_callback", port))),
+			RedisEnabled:          resolveRedisEnabledWithDefault(yml.RedisEnabled),
+			RedisAddr:             strings.TrimSpace(os.Getenv("REDIS_ADDR")),
+			RedisPassword:         os.Getenv("REDIS_PASSWORD"),
+			RedisDB:               getEnvInt("REDIS_DB", 0),
+			RedisUseTLS:           getEnvBool("REDIS_USE_TLS", yml.RedisUseTLS),
+			PaymentProvider:       getEnv("PAYMENT_PROVIDER", yamlDefault(yml.PaymentProvider, "razorpay")),
+			RazorpayKey:           strings.TrimSpace(os.Getenv("RAZORPAY_KEY")),
+			RazorpaySecret:        strings.TrimSpace(os.Getenv("RAZORPAY_SECRET")),
+			RazorpayWebhookSecret: strings.TrimSpace(os.Getenv("RAZORPAY_WEBHOOK_SECRET")),
+			PayoutProvider:        getEnv("PAYOUT_PROVIDER", yamlDefault(yml.PayoutProvider, "manual")),
+			PayoutEncryptionKey:   strings.TrimSpace(os.Getenv("PAYOUT_ENCRYPTION_KEY")),
+
+			SlotHoldTTL:         time.Duration(getEnvInt("SLOT_HOLD_MINUTES", yamlDefaultInt(yml.SlotHoldMinutes, 15))) * time.Minute,
+			PaymentOrderTimeout: time.Duration(getEnvInt("PAYMENT_ORDER_TIMEOUT_MINUTES", yamlDefaultInt(yml.PaymentOrderTimeoutMinutes, 60))) * time.Minute,
+
+			CancellationFullRefundBefore:     time.Duration(getEnvInt("CANCELLATION_FULL_REFUND_HOURS", yamlDefaultInt(yml.CancellationFullRefundHours, 24))) * time.Hour,
+			CancellationPartialRefundBefore:  time.Duration(getEnvInt("CANCELLATION_PARTIAL_REFUND_HOURS", yamlDefaultInt(yml.CancellationPartialRefundHours, 1))) * time.Hour,
+			CancellationPartialRefundPercent: getEnvInt("CANCELLATION_PARTIAL_REFUND_PERCENT", yamlDefaultInt(yml.CancellationPartialRefundPercent, 50)),
+
+			ExpertCancellationFlagThreshold: getEnvInt("EXPERT_CANCELLATION_FLAG_THRESHOLD", yamlDefaultInt(yml.ExpertCancellationFlagThreshold, 3)),
+
+			MaxReschedulesPerSession: getEnvInt("MAX_RESCHEDULES_PER_SESSION", yamlDefaultInt(yml.MaxReschedulesPerSession, 2)),
+			RescheduleMinNotice:      time.Duration(getEnvInt("RESCHEDULE_MIN_NOTICE_HOURS", yamlDefaultInt(yml.RescheduleMinNoticeHours, 12))) * time.Hour,
+
+			PlatformCommissionPercent: getEnvInt("PLATFORM_COMMISSION_PERCENT", yamlDefaultInt(yml.PlatformCommissionPercent, 20)),
+
+			EscrowReleaseDelay: time.Duration(getEnvInt("ESCROW_RELEASE_DELAY_HOURS", yamlDefaultInt(yml.EscrowReleaseDelayHours, 24))) * time.Hour,
+
+			PayoutMinimumInPaise: int64(getEnvInt("PAYOUT_MINIMUM_IN_PAISE", yamlDefaultInt(yml.PayoutMinimumInPaise, 50000))),
+
+			InvoicePrefix:          getEnv("INVOICE_PREFIX", yamlDefault(yml.InvoicePrefix, "IE")),
+			InvoiceSupplierName:    getEnv("INVOICE_SUPPLIER_NAME", "InterviewExcel"),
+			InvoiceSupplierAddress: strings.TrimSpace(os.Getenv("INVOICE_SUPPLIER_ADDRESS")),
+			InvoiceSupplierGSTIN:   strings.TrimSpace(os.Getenv("INVOICE_SUPPLIER_GSTIN")),
+			InvoiceSupplierState:   getEnv("INVOICE_SUPPLIER_STATE", yamlDefault(yml.InvoiceSupplierState, "Karnataka")),
+			GSTRatePercent:         getEnvInt("GST_RATE_PERCENT", yamlDefaultInt(yml.GSTRatePercent, 18)),
+
+			ReconcileWindow: time.Duration(getEnvInt("RECONCILE_WINDOW_HOURS", yamlDefaultInt(yml.ReconcileWindowHours, 48))) * time.Hour,
+
+			WalletRefundCreditValidity: time.Duration(getEnvInt("WALLET_REFUND_CREDIT_VALIDITY_DAYS", yamlDefaultInt(yml.WalletRefundCreditValidityDays, 365))) * 24 * time.Hour,
+			WalletPromoCreditValidity:  time.Duration(getEnvInt("WALLET_PROMO_CREDIT_VALIDITY_DAYS", yamlDefaultInt(yml.WalletPromoCreditValidityDays, 90))) * 24 * time.Hour,
+
+			SubscriptionGracePeriod: time.Duration(getEnvInt("SUBSCRIPTION_GRACE_DAYS", yamlDefaultInt(yml.SubscriptionGraceDays, 3))) * 24 * time.Hour,
+
+			AvailabilityHorizon: time.Duration(getEnvInt("AVAILABILITY_HORIZON_WEEKS", yamlDefaultInt(yml.AvailabilityHorizonWeeks, 4))) * 7 * 24 * time.Hour,
+
+			DefaultTimeZone: getEnv("DEFAULT_TIME_ZONE", yamlDefault(yml.DefaultTimeZone, "Asia/Kolkata")),
 		}
 	})
 
@@ -123,6 +264,14 @@ func yamlDefault(yamlVal, fallback string) string {
 	return fallback
 }
 
+// yamlDefaultInt returns the YAML value if set (non-zero), otherwise the hard-coded fallback.
+func yamlDefaultInt(yamlVal, fallback int) int {
+	if yamlVal != 0 {
+		return yamlVal
+	}
+	return fallback
+}
+
 // yamlDefaultSlice returns the YAML slice if non-empty, otherwise the hard-coded fallback.
 func yamlDefaultSlice(yamlVal, fallback []string) []string {
 	if len(yamlVal) > 0 {
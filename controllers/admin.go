@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SetExpertCommissionRequest struct {
+	// nil clears the override so the platform default applies again
+	CommissionPercent *int `json:"commission_percent"`
+}
+
+func SetExpertCommissionHandler(c *gin.Context) {
+	var (
+		req        SetExpertCommissionRequest
+		expertRepo = models.InitExpertRepo(config.DB)
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("error in binding commission request: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if req.CommissionPercent != nil && (*req.CommissionPercent < 0 || *req.CommissionPercent > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "commission_percent must be between 0 and 100"})
+		return
+	}
+
+	expertUUID := c.Param("user_uuid")
+	if err := expertRepo.SetCommissionPercent(expertUUID, req.CommissionPercent); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Expert not found"})
+			return
+		}
+		logger.Errorf("failed to set commission for expert %s: %v", expertUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update commission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_uuid":          expertUUID,
+		"commission_percent": req.CommissionPercent,
+		"default_percent":    config.RuntimeConfig().PlatformCommissionPercent,
+	})
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Participants open the meeting through the join endpoint, which is the
+// only place the meet link is handed out, and which records who joined.
+// When the session ends, the escrow job completes it only if the expert
+// joined; otherwise it is an expert no-show. Its earnings stay in escrow
+// until the dispute window passes and the student is refunded in full, or
+// an admin settles a dispute raised on it.
+
+// joinWindowOpensBefore is how early before the start a session can be joined.
+const joinWindowOpensBefore = 15 * time.Minute
+
+var ErrSessionNotJoinable = errors.New("session can only be joined shortly before and during its time")
+
+type JoinSessionResponse struct {
+	SessionUUID string `json:"session_uuid"`
+	MeetLink    string `json:"meet_link"`
+}
+
+func JoinStudentSessionHandler(c *gin.Context) {
+	studentUUID := c.GetString("user_uuid")
+	session, err := joinSession(c.Param("session_uuid"), false,
+		func(session *models.Session) bool { return session.StudentUUID == studentUUID })
+	respondJoin(c, session, err)
+}
+
+func JoinExpertSessionHandler(c *gin.Context) {
+	expertUUID := c.GetString("user_uuid")
+	session, err := joinSession(c.Param("session_uuid"), true,
+		func(session *models.Session) bool { return session.ExpertUUID == expertUUID })
+	respondJoin(c, session, err)
+}
+
+func respondJoin(c *gin.Context, session *models.Session, err error) {
+	if err != nil {
+		logger.Error("error in joining session: ", err)
+		switch {
+		case errors.Is(err, ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotSessionParticipant):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrSessionNotJoinable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join session"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, JoinSessionResponse{
+		SessionUUID: session.SessionUUID,
+		MeetLink:    session.MeetLink,
+	})
+}
+
+// joinSession records that a participant joined the scheduled session and
+// returns it. Only the first join of each participant is recorded.
+func joinSession(sessionUUID string, asExpert bool, isParticipant func(session *models.Session) bool) (*models.Session, error) {
+	var (
+		tx          = config.DB.Begin()
+		sessionRepo = models.InitSessionRepo(tx)
+		now         = time.Now()
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Locked so the escrow job cannot settle the session meanwhile
+	session, err := sessionRepo.GetByUUIDForUpdate(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	if !isParticipant(session) {
+		tx.Rollback()
+		return nil, ErrNotSessionParticipant
+	}
+
+	if session.Status != models.SessionScheduled ||
+		now.Before(session.StartTime.Add(-joinWindowOpensBefore)) || !now.Before(session.EndTime) {
+		tx.Rollback()
+		return nil, ErrSessionNotJoinable
+	}
+
+	if err := sessionRepo.MarkJoined(session.SessionUUID, asExpert, now); err != nil {
+		tx.Rollback()
+		logger.Error("error in recording session join: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
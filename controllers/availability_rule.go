@@ -0,0 +1,463 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Availability rules replace generating slots week by week. A rule is
+// turned into AvailabilitySlot rows up to AVAILABILITY_HORIZON_WEEKS ahead,
+// when it is saved and then by a background job as the window moves on.
+// Slots that would overlap one the expert already has (in any status,
+// including ones the expert cancelled) are skipped. Editing or deleting a
+// rule removes its future unbooked slots and regenerates them; booked and
+// held slots are never touched. Days and clock times are read in the
+// expert's time zone.
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// slotsForDay cuts [startClock, endClock) on the given calendar day, read
+// as wall-clock time in loc, into slots of the given length. Only the hour
+// and minute of the clocks are used. On days a DST change falls inside the
+// window, the slots keep their length and the window its wall-clock ends.
+// Slot times are stored in UTC and Date is the day in loc.
+func slotsForDay(expertID string, day time.Time, startClock time.Time, endClock time.Time, duration time.Duration, loc *time.Location) []models.AvailabilitySlot {
+	start := time.Date(day.Year(), day.Month(), day.Day(), startClock.Hour(), startClock.Minute(), 0, 0, loc)
+	end := time.Date(day.Year(), day.Month(), day.Day(), endClock.Hour(), endClock.Minute(), 0, 0, loc)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	var slots []models.AvailabilitySlot
+	for t := start; !t.Add(duration).After(end); t = t.Add(duration) {
+		slots = append(slots, models.AvailabilitySlot{
+			ExpertID:  expertID,
+			Date:      date,
+			StartTime: t.UTC(),
+			EndTime:   t.Add(duration).UTC(),
+			Status:    string(models.SlotAvailable),
+		})
+	}
+	return slots
+}
+
+// ruleSlots lists the slots the rule describes that start in [from, to),
+// with the rule's days and clock times read in loc.
+func ruleSlots(rule *models.AvailabilityRule, from time.Time, to time.Time, loc *time.Location) []models.AvailabilitySlot {
+	startClock, err := time.Parse("15:04", rule.StartTime)
+	if err != nil {
+		return nil
+	}
+	endClock, err := time.Parse("15:04", rule.EndTime)
+	if err != nil {
+		return nil
+	}
+
+	days := map[time.Weekday]bool{}
+	for _, d := range rule.Days {
+		days[weekdays[d]] = true
+	}
+
+	var (
+		slots    []models.AvailabilitySlot
+		duration = time.Duration(rule.SlotMinutes) * time.Minute
+		local    = from.In(loc)
+		first    = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	)
+	for day := first; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !days[day.Weekday()] || !ruleInEffectOn(rule, day) {
+			continue
+		}
+		for _, slot := range slotsForDay(rule.ExpertID, day, startClock, endClock, duration, loc) {
+			if slot.StartTime.Before(from) || !slot.StartTime.Before(to) {
+				continue
+			}
+			slot.RuleID = &rule.ID
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// ruleInEffectOn reports whether the rule covers the calendar day.
+func ruleInEffectOn(rule *models.AvailabilityRule, day time.Time) bool {
+	date := day.Format("2006-01-02")
+	if date < rule.EffectiveFrom.Format("2006-01-02") {
+		return false
+	}
+	return rule.EffectiveUntil == nil || date <= rule.EffectiveUntil.Format("2006-01-02")
+}
+
+// materializeRuleWithTx creates the rule's missing slots from now to the
+// end of the horizon and returns how many it created. The rule must be
+// locked by the caller.
+func materializeRuleWithTx(tx *gorm.DB, rule *models.AvailabilityRule, now time.Time) (int, error) {
+	to := now.Add(config.RuntimeConfig().AvailabilityHorizon)
+	candidates := ruleSlots(rule, now, to, utils.UserLocation(tx, rule.ExpertID))
+
+	created, _, err := placeSlotsWithTx(tx, rule.ExpertID, candidates, true)
+	if err != nil {
+		return 0, err
+	}
+	return len(created), nil
+}
+
+// MaterializeAvailability tops up the slots of every rule still in effect
+// to the end of the horizon. Rules being materialized or edited elsewhere
+// are skipped until the next run. It returns how many slots were created.
+func MaterializeAvailability(now time.Time) (int, error) {
+	ruleIDs, err := models.InitAvailabilityRuleRepo(config.DB).ListIDsInEffect(now)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, id := range ruleIDs {
+		n, err := materializeRule(id, now)
+		created += n
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+func materializeRule(ruleID uint, now time.Time) (int, error) {
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rule, err := models.InitAvailabilityRuleRepo(tx).LockForMaterializeWithTx(tx, ruleID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	created, err := materializeRuleWithTx(tx, rule, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("error in materializing availability rule %d: %v", rule.ID, err)
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+type AvailabilityRuleRequest struct {
+	Days           []string `json:"days" binding:"required"`       // ["monday","wednesday","friday"]
+	Start          string   `json:"start_time" binding:"required"` // "18:00"
+	End            string   `json:"end_time" binding:"required"`   // "21:00"
+	SlotMinutes    int      `json:"duration" binding:"required"`   // minutes, e.g. 45
+	EffectiveFrom  string   `json:"effective_from"`                // "2026-01-05", defaults to today
+	EffectiveUntil string   `json:"effective_until"`               // inclusive, optional
+}
+
+// apply validates the request and copies it onto the rule. Effective dates
+// are calendar days in the expert's zone loc.
+func (r *AvailabilityRuleRequest) apply(rule *models.AvailabilityRule, now time.Time, loc *time.Location) string {
+	if len(r.Days) == 0 {
+		return "days is required"
+	}
+	days := make([]string, 0, len(r.Days))
+	seen := map[string]bool{}
+	for _, d := range r.Days {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if _, ok := weekdays[d]; !ok {
+			return "invalid day: " + d
+		}
+		if !seen[d] {
+			seen[d] = true
+			days = append(days, d)
+		}
+	}
+
+	startClock, err := time.Parse("15:04", r.Start)
+	if err != nil {
+		return "invalid start time"
+	}
+	endClock, err := time.Parse("15:04", r.End)
+	if err != nil {
+		return "invalid end time"
+	}
+	if r.SlotMinutes <= 0 {
+		return "slot size must be greater than 0"
+	}
+	if endClock.Sub(startClock) < time.Duration(r.SlotMinutes)*time.Minute {
+		return "end_time must leave room for at least one slot after start_time"
+	}
+
+	today := now.In(loc)
+	from := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if r.EffectiveFrom != "" {
+		if from, err = time.Parse("2006-01-02", r.EffectiveFrom); err != nil {
+			return "effective_from must be a date like 2006-01-02"
+		}
+	}
+
+	var until *time.Time
+	if r.EffectiveUntil != "" {
+		t, err := time.Parse("2006-01-02", r.EffectiveUntil)
+		if err != nil {
+			return "effective_until must be a date like 2006-01-02"
+		}
+		if t.Before(from) {
+			return "effective_until must not be before effective_from"
+		}
+		until = &t
+	}
+
+	rule.Days = days
+	rule.StartTime, rule.EndTime = startClock.Format("15:04"), endClock.Format("15:04")
+	rule.SlotMinutes = r.SlotMinutes
+	rule.EffectiveFrom, rule.EffectiveUntil = from, until
+	return ""
+}
+
+type AvailabilityRuleResponse struct {
+	Rule         *models.AvailabilityRule `json:"rule"`
+	SlotsCreated int                      `json:"slots_created"`
+	SlotsRemoved int64                    `json:"slots_removed,omitempty"`
+}
+
+func ListAvailabilityRulesHandler(c *gin.Context) {
+	rules, err := models.InitAvailabilityRuleRepo(config.DB).ListByExpert(c.GetString("user_uuid"))
+	if err != nil {
+		logger.Error("error in listing availability rules: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateAvailabilityRuleHandler saves a rule and creates its slots for the
+// coming weeks straight away.
+func CreateAvailabilityRuleHandler(c *gin.Context) {
+	var (
+		req AvailabilityRuleRequest
+		now = time.Now()
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := &models.AvailabilityRule{ExpertID: c.GetString("user_uuid")}
+	if msg := req.apply(rule, now, utils.UserLocation(config.DB, rule.ExpertID)); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := models.InitAvailabilityRuleRepo(tx).CreateWithTx(tx, rule); err != nil {
+		tx.Rollback()
+		logger.Error("error in creating availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	created, err := materializeRuleWithTx(tx, rule, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in generating slots for availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, AvailabilityRuleResponse{Rule: rule, SlotsCreated: created})
+}
+
+// UpdateAvailabilityRuleHandler changes a rule and regenerates its future
+// unbooked slots. Booked and held slots keep their times; new slots that
+// would overlap them are skipped.
+func UpdateAvailabilityRuleHandler(c *gin.Context) {
+	var (
+		req AvailabilityRuleRequest
+		now = time.Now()
+	)
+
+	id, err := strconv.ParseUint(c.Param("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	ruleRepo := models.InitAvailabilityRuleRepo(tx)
+	rule, err := ruleRepo.LockByExpertWithTx(tx, uint(id), c.GetString("user_uuid"))
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		logger.Error("error in fetching availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if msg := req.apply(rule, now, utils.UserLocation(tx, rule.ExpertID)); msg != "" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := ruleRepo.SaveWithTx(tx, rule); err != nil {
+		tx.Rollback()
+		logger.Error("error in updating availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	removed, err := models.InitAvailabilitySlotRepo(tx).DeleteUnbookedByRuleWithTx(tx, rule.ID, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in removing slots of availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	created, err := materializeRuleWithTx(tx, rule, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in regenerating slots for availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	logger.Infof("availability rule %d updated: %d slots removed, %d created", rule.ID, removed, created)
+	c.JSON(http.StatusOK, AvailabilityRuleResponse{Rule: rule, SlotsCreated: created, SlotsRemoved: removed})
+}
+
+// DeleteAvailabilityRuleHandler deletes a rule with its future unbooked
+// slots. Booked sessions are kept.
+func DeleteAvailabilityRuleHandler(c *gin.Context) {
+	now := time.Now()
+
+	id, err := strconv.ParseUint(c.Param("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id"})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	ruleRepo := models.InitAvailabilityRuleRepo(tx)
+	rule, err := ruleRepo.LockByExpertWithTx(tx, uint(id), c.GetString("user_uuid"))
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		logger.Error("error in fetching availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	removed, err := models.InitAvailabilitySlotRepo(tx).DeleteUnbookedByRuleWithTx(tx, rule.ID, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in removing slots of availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := ruleRepo.DeleteWithTx(tx, rule.ID); err != nil {
+		tx.Rollback()
+		logger.Error("error in deleting availability rule: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing availability rule deletion: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted", "slots_removed": removed})
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlotsForDayAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := func(value string) time.Time {
+		c, err := time.Parse("15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		day    time.Time
+		from   string
+		to     string
+		starts []string // UTC
+	}{
+		{
+			name:   "ordinary day",
+			day:    time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC),
+			from:   "00:00",
+			to:     "04:00",
+			starts: []string{"05:00", "06:00", "07:00", "08:00"},
+		},
+		{
+			// 02:00 EST jumps to 03:00 EDT: the window is an hour shorter
+			name:   "clocks go forward",
+			day:    time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC),
+			from:   "00:00",
+			to:     "04:00",
+			starts: []string{"05:00", "06:00", "07:00"},
+		},
+		{
+			name:   "after clocks went forward",
+			day:    time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC),
+			from:   "09:00",
+			to:     "11:00",
+			starts: []string{"13:00", "14:00"},
+		},
+		{
+			// 02:00 EDT falls back to 01:00 EST: the window is an hour longer
+			name:   "clocks go back",
+			day:    time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+			from:   "00:00",
+			to:     "04:00",
+			starts: []string{"04:00", "05:00", "06:00", "07:00", "08:00"},
+		},
+		{
+			name:   "after clocks went back",
+			day:    time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+			from:   "09:00",
+			to:     "11:00",
+			starts: []string{"14:00", "15:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := slotsForDay("expert", tt.day, clock(tt.from), clock(tt.to), time.Hour, loc)
+			if len(slots) != len(tt.starts) {
+				t.Fatalf("got %d slots, want %d", len(slots), len(tt.starts))
+			}
+			for i, slot := range slots {
+				if got := slot.StartTime.Format("15:04"); got != tt.starts[i] || slot.StartTime.Location() != time.UTC {
+					t.Errorf("slot %d starts at %s (%s), want %s UTC", i, got, slot.StartTime.Location(), tt.starts[i])
+				}
+				if d := slot.EndTime.Sub(slot.StartTime); d != time.Hour {
+					t.Errorf("slot %d lasts %s, want 1h", i, d)
+				}
+				if !slot.Date.Equal(tt.day) {
+					t.Errorf("slot %d is dated %s, want %s", i, slot.Date, tt.day)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Blackouts replace cancelling slots one by one when an expert is away.
+// Saving one removes the expert's unbooked slots in the period, and slot
+// generation (by hand or from availability rules) skips it from then on.
+// Booked sessions in the period are left alone and listed back to the
+// expert to cancel or keep. Slots on hold for a checkout stay too; if the
+// payment goes through, they show up as booked sessions.
+//
+// A vacation blackout also sets Expert.IsAvailable to false while it lasts,
+// which hides the expert from the expert listing. A background job flips it
+// when a vacation starts or ends.
+
+type BlackoutRequest struct {
+	StartDate string `json:"start_date" binding:"required"` // "2026-12-20"
+	EndDate   string `json:"end_date" binding:"required"`   // inclusive
+	Reason    string `json:"reason"`
+	Vacation  bool   `json:"vacation"`
+}
+
+// blackout validates the request and turns it into a blackout of the
+// expert, with the dates read in the expert's zone loc.
+func (r *BlackoutRequest) blackout(expertID string, now time.Time, loc *time.Location) (*models.Blackout, string) {
+	start, err := time.Parse("2006-01-02", r.StartDate)
+	if err != nil {
+		return nil, "start_date must be a date like 2006-01-02"
+	}
+	end, err := time.Parse("2006-01-02", r.EndDate)
+	if err != nil {
+		return nil, "end_date must be a date like 2006-01-02"
+	}
+	if end.Before(start) {
+		return nil, "end_date must not be before start_date"
+	}
+
+	blackout := &models.Blackout{
+		ExpertID:  expertID,
+		StartDate: start,
+		EndDate:   end,
+		StartsAt:  time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc).UTC(),
+		EndsAt:    time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, loc).UTC(),
+		Reason:    r.Reason,
+		Vacation:  r.Vacation,
+	}
+	if !blackout.EndsAt.After(now) {
+		return nil, "end_date is in the past"
+	}
+	return blackout, ""
+}
+
+type BlackoutResponse struct {
+	Blackout       *models.Blackout `json:"blackout"`
+	SlotsRemoved   int64            `json:"slots_removed,omitempty"`
+	BookedSessions []models.Session `json:"booked_sessions"` // scheduled sessions inside the blackout
+}
+
+// blackoutResponse lists the booked sessions inside the blackout, with
+// times rendered in loc.
+func blackoutResponse(db *gorm.DB, blackout *models.Blackout, loc *time.Location) (BlackoutResponse, error) {
+	sessions, err := models.InitSessionRepo(db).ListScheduledForExpertBetween(blackout.ExpertID, blackout.StartsAt, blackout.EndsAt)
+	if err != nil {
+		return BlackoutResponse{}, err
+	}
+	for i := range sessions {
+		sessions[i].StartTime = sessions[i].StartTime.In(loc)
+		sessions[i].EndTime = sessions[i].EndTime.In(loc)
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	return BlackoutResponse{Blackout: blackout, BookedSessions: sessions}, nil
+}
+
+// SyncVacationMode hides experts whose vacation has started and shows
+// those whose vacation has ended. It returns how many were hidden and
+// shown.
+func SyncVacationMode(now time.Time) (int64, int64, error) {
+	return models.InitBlackoutRepo(config.DB).SyncExpertAvailabilityWithTx(config.DB, now)
+}
+
+// ListBlackoutsHandler lists the expert's blackouts that have not ended,
+// each with the booked sessions inside it.
+func ListBlackoutsHandler(c *gin.Context) {
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	blackouts, err := models.InitBlackoutRepo(config.DB).ListCurrentByExpert(c.GetString("user_uuid"), time.Now())
+	if err != nil {
+		logger.Error("error in listing blackouts: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	responses := make([]BlackoutResponse, 0, len(blackouts))
+	for i := range blackouts {
+		response, err := blackoutResponse(config.DB, &blackouts[i], loc)
+		if err != nil {
+			logger.Error("error in listing sessions in blackout: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+		responses = append(responses, response)
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+// CreateBlackoutHandler saves a blackout, removes the unbooked slots in it
+// and lists the booked sessions it covers.
+func CreateBlackoutHandler(c *gin.Context) {
+	var (
+		req      BlackoutRequest
+		now      = time.Now()
+		expertID = c.GetString("user_uuid")
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Dates are always the expert's calendar days, whatever tz is asked for
+	blackout, msg := req.blackout(expertID, now, utils.UserLocation(config.DB, expertID))
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	blackoutRepo := models.InitBlackoutRepo(tx)
+	if err := blackoutRepo.CreateWithTx(tx, blackout); err != nil {
+		tx.Rollback()
+		logger.Error("error in creating blackout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	removed, err := models.InitAvailabilitySlotRepo(tx).DeleteUnbookedInRangeWithTx(tx, expertID, blackout.StartsAt, blackout.EndsAt, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in removing slots in blackout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if blackout.Vacation {
+		if _, _, err := blackoutRepo.SyncExpertAvailabilityWithTx(tx, now, expertID); err != nil {
+			tx.Rollback()
+			logger.Error("error in updating expert availability: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+	}
+
+	response, err := blackoutResponse(tx, blackout, loc)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in listing sessions in blackout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing blackout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	logger.Infof("blackout %d created for expert %s: %d slots removed, %d booked sessions inside",
+		blackout.ID, expertID, removed, len(response.BookedSessions))
+	response.SlotsRemoved = removed
+	c.JSON(http.StatusCreated, response)
+}
+
+// DeleteBlackoutHandler removes a blackout. The expert's availability
+// rules fill the period with slots again straight away.
+func DeleteBlackoutHandler(c *gin.Context) {
+	var (
+		now      = time.Now()
+		expertID = c.GetString("user_uuid")
+	)
+
+	id, err := strconv.ParseUint(c.Param("blackout_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid blackout id"})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	blackoutRepo := models.InitBlackoutRepo(tx)
+	blackout, err := blackoutRepo.LockByExpertWithTx(tx, uint(id), expertID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Blackout not found"})
+			return
+		}
+		logger.Error("error in fetching blackout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := blackoutRepo.DeleteWithTx(tx, blackout.ID); err != nil {
+		tx.Rollback()
+		logger.Error("error in deleting blackout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if blackout.Vacation {
+		if _, _, err := blackoutRepo.SyncExpertAvailabilityWithTx(tx, now, expertID); err != nil {
+			tx.Rollback()
+			logger.Error("error in updating expert availability: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing blackout deletion: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	// Best effort; the materializer job catches up on anything missed here
+	created := 0
+	rules, err := models.InitAvailabilityRuleRepo(config.DB).ListByExpert(expertID)
+	if err != nil {
+		logger.Error("error in listing availability rules: ", err)
+	}
+	for _, rule := range rules {
+		n, err := materializeRule(rule.ID, now)
+		if err != nil {
+			logger.Errorf("error in refilling slots of availability rule %d: %v", rule.ID, err)
+			break
+		}
+		created += n
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Blackout deleted", "slots_created": created})
+}
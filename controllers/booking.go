@@ -1,6 +1,9 @@
 package controllers
 
 import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -30,10 +33,16 @@ import (
 // COMMIT
 
 type BookSlotRequest struct {
-	SlotID        uint `json:"slot_id" binding:"required"`
-	AmountInPaise int  `json:"amount_in_paise" binding:"required"`
+	SlotID uint `json:"slot_id" binding:"required"`
 
-	// In future: StudentID uint `json:"student_id"`
+	// The amount is derived server-side from the expert's fee.
+	CouponCode string `json:"coupon_code"`
+
+	// Pay with a prepaid session credit instead of opening a gateway order
+	UseCredit bool `json:"use_credit"`
+
+	// Pay from the wallet first; the gateway order covers only the rest
+	UseWallet bool `json:"use_wallet"`
 }
 
 func InitiateBookingHandler(c *gin.Context) {
@@ -47,15 +56,57 @@ func InitiateBookingHandler(c *gin.Context) {
 		return
 	}
 
-	order, err := CreateRazorpayOrder(req.SlotID, req.AmountInPaise)
+	if req.UseCredit {
+		bookWithCredit(c, req)
+		return
+	}
+
+	order, err := CreatePaymentOrder(c.GetString("user_uuid"), req.SlotID, req.CouponCode, req.UseWallet)
 	if err != nil {
 		logger.Error("error in creating razorpay order: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create payment order"})
+		switch {
+		case errors.Is(err, ErrSlotNotAvailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInvalidSessionFee):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case isCouponError(err):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create payment order"})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, order)
 }
 
+// bookWithCredit books the slot straight away with one of the student's
+// session credits; there is no payment to confirm.
+func bookWithCredit(c *gin.Context, req BookSlotRequest) {
+	if req.CouponCode != "" || req.UseWallet {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "coupons and wallet payments cannot be used with a session credit"})
+		return
+	}
+
+	session, err := BookSlotWithCredit(c.GetString("user_uuid"), req.SlotID)
+	if err != nil {
+		logger.Error("error in booking slot with credit: ", err)
+		switch {
+		case errors.Is(err, ErrSlotNotAvailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNoUsableCredit):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to book slot"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, ConfirmPaymentResponse{
+		SessionID:   session.ID,
+		SessionUUID: session.SessionUUID,
+	})
+}
+
 type ConfirmPaymentRequest struct {
 	SlotID            uint   `json:"slot_id" binding:"required"`
 	RazorpayOrderID   string `json:"razorpay_order_id" binding:"required"`
@@ -64,12 +115,15 @@ type ConfirmPaymentRequest struct {
 }
 
 type ConfirmPaymentResponse struct {
-	SessionID uint `json:"session_id"`
+	SessionID   uint   `json:"session_id"`
+	SessionUUID string `json:"session_uuid"`
 }
 
 func ConfirmPaymentHandler(c *gin.Context) {
 	var (
-		req ConfirmPaymentRequest
+		req         ConfirmPaymentRequest
+		paymentRepo = models.InitPaymentRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
 	)
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
@@ -78,24 +132,59 @@ func ConfirmPaymentHandler(c *gin.Context) {
 		return
 	}
 
-	ok := VerifyRazorpaySignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
+	payment, err := paymentRepo.GetByOrderID(req.RazorpayOrderID)
+	if err != nil {
+		logger.Error("error in fetching payment order: ", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment order not found"})
+		return
+	}
+
+	student, err := studentRepo.GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		logger.Error("error in fetching student: ", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	if payment.SlotID != req.SlotID || payment.StudentID != student.ID {
+		logger.Errorf("order %s does not match slot %d / student %d", payment.OrderID, req.SlotID, student.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrPaymentMismatch.Error()})
+		return
+	}
+
+	ok := config.Payments.VerifyPaymentSignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature)
 	if !ok {
 		logger.Error("error in verifying razorpay signature")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment signature"})
 		return
 	}
 
-	err = BookExpertSlot(c, req.SlotID)
+	method, err := FetchPaymentMethod(req.RazorpayPaymentID)
+	if err != nil {
+		logger.Error("error in fetching razorpay payment method: ", err)
+	}
+
+	session, err := BookExpertSlot(req.SlotID, PaymentConfirmation{
+		OrderID:   req.RazorpayOrderID,
+		PaymentID: req.RazorpayPaymentID,
+		Method:    method,
+	})
 	if err != nil {
 		logger.Error("error in booking slot after payment: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to book slot"})
+		switch {
+		case errors.Is(err, ErrPaymentAlreadyProcessed), errors.Is(err, ErrSlotNotAvailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to book slot"})
+		}
 		return
 	}
 
 	// Sending session details to student in response
 	c.JSON(http.StatusOK,
 		ConfirmPaymentResponse{
-			SessionID: req.SlotID,
+			SessionID:   session.ID,
+			SessionUUID: session.SessionUUID,
 		},
 	)
 
@@ -3,33 +3,36 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"interviewexcel-backend-go/config"
 	"interviewexcel-backend-go/models"
 	"time"
 
 	logger "interviewexcel-backend-go/pkg/errors"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"google.golang.org/api/calendar/v3"
-	"gorm.io/gorm/clause"
+	"gorm.io/gorm"
 )
 
+// CreateGoogleMeetLink creates a calendar event with a Meet link for the
+// session. loc is the zone the event is shown in, normally the expert's.
 func CreateGoogleMeetLink(
 	ctx context.Context,
 	srv *calendar.Service,
 	start, end time.Time,
+	loc *time.Location,
 ) (string, error) {
 
 	event := &calendar.Event{
 		Summary: "InterviewExcel Expert Session",
 		Start: &calendar.EventDateTime{
-			DateTime: start.Format(time.RFC3339),
-			TimeZone: "Asia/Kolkata",
+			DateTime: start.In(loc).Format(time.RFC3339),
+			TimeZone: loc.String(),
 		},
 		End: &calendar.EventDateTime{
-			DateTime: end.Format(time.RFC3339),
-			TimeZone: "Asia/Kolkata",
+			DateTime: end.In(loc).Format(time.RFC3339),
+			TimeZone: loc.String(),
 		},
 		ConferenceData: &calendar.ConferenceData{
 			CreateRequest: &calendar.CreateConferenceRequest{
@@ -56,21 +59,32 @@ func CreateGoogleMeetLink(
 	return createdEvent.HangoutLink, nil
 }
 
-func BookExpertSlot(c *gin.Context, slotID uint) error {
+// PaymentConfirmation carries the verified gateway details of the payment
+// that pays for a booking. It is produced either by the client confirm call
+// or by the gateway webhook; both book through BookExpertSlot.
+type PaymentConfirmation struct {
+	OrderID   string
+	PaymentID string
+	Method    string
+}
+
+// BookExpertSlot books the slot paid for by the given order. It is safe to
+// call more than once for the same order: once the payment is paid, the
+// session created by the first call is returned instead of booking again.
+func BookExpertSlot(slotID uint, confirmation PaymentConfirmation) (*models.Session, error) {
 
 	var (
 		tx                   = config.DB.Begin()
 		sessionRepo          = models.InitSessionRepo(tx)
 		AvailabilitySlotRepo = models.InitAvailabilitySlotRepo(tx)
-		walletRepo           = models.InitWalletRepo(tx)
-		wtRepo               = models.InitWalletTransactionRepo(tx)
 		expertRepo           = models.InitExpertRepo(tx)
+		paymentRepo          = models.InitPaymentRepo(tx)
+		studentRepo          = models.InitStudentRepo(tx)
 	)
-	studentUUID := c.GetString("user_uuid")
 
 	if tx.Error != nil {
 		logger.Error("error in starting transaction: ", tx.Error)
-		return tx.Error
+		return nil, tx.Error
 	}
 
 	defer func() {
@@ -79,16 +93,76 @@ func BookExpertSlot(c *gin.Context, slotID uint) error {
 		}
 	}()
 
-	var slot models.AvailabilitySlot
-	err := tx.
-		Clauses(clause.Locking{Strength: "UPDATE"}).
-		Where("id = ? AND status = ?", slotID, models.SlotAvailable).
-		First(&slot).Error
+	// 1️⃣ Lock the payment so the same order can only book once
+	payment, err := paymentRepo.GetByOrderIDForUpdate(tx, confirmation.OrderID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching payment for booking: ", err)
+		return nil, err
+	}
+
+	if payment.SlotID != slotID {
+		tx.Rollback()
+		logger.Errorf("payment %s is for slot %d, not %d", payment.OrderID, payment.SlotID, slotID)
+		return nil, ErrPaymentMismatch
+	}
+
+	if payment.Status == string(models.PaymentPaid) {
+		// Already booked by an earlier confirm or webhook delivery
+		existing, err := sessionRepo.GetByOrderID(payment.OrderID)
+		tx.Rollback()
+		if err != nil {
+			logger.Errorf("payment %s is paid but has no session: %v", payment.OrderID, err)
+			return nil, ErrPaymentAlreadyProcessed
+		}
+		return existing, nil
+	}
+
+	// A failed attempt can still be followed by a successful one on the same
+	// order, and a payment captured after the order expired still books while
+	// the slot is free
+	if !payableStatus(payment.Status) {
+		tx.Rollback()
+		logger.Errorf("payment %s already in status %s", payment.OrderID, payment.Status)
+		return nil, ErrPaymentAlreadyProcessed
+	}
+
+	student, err := studentRepo.GetByID(payment.StudentID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching student for booking: ", err)
+		return nil, err
+	}
+	studentUUID := student.UserID
 
+	// The slot must be held for this order, or at least not held for anyone else
+	slot, err := AvailabilitySlotRepo.LockForBookingWithTx(tx, slotID, payment.OrderID)
 	if err != nil {
 		tx.Rollback()
 		logger.Error("slot not available: ", err)
-		return errors.New("slot not available")
+		refundUnfulfilledPayment(confirmation, ErrSlotNotAvailable)
+		return nil, ErrSlotNotAvailable
+	}
+
+	// A payment captured late, through the webhook or reconcile after the
+	// order expired, cannot book a session that has already started
+	if !slot.StartTime.After(time.Now()) {
+		tx.Rollback()
+		logger.Errorf("slot %d started before payment %s was captured", slot.ID, payment.OrderID)
+		refundUnfulfilledPayment(confirmation, ErrSlotStarted)
+		return nil, ErrSlotStarted
+	}
+
+	// Sessions booked since the order was opened may have used up the
+	// expert's day or taken the time next to this slot. Notice is counted
+	// from when the order was opened, so a slow checkout is not refused.
+	if err := checkSchedulingWithTx(tx, slot, payment.StudentID, payment.CreatedAt, ""); err != nil {
+		tx.Rollback()
+		logger.Errorf("slot %d refused by the expert's scheduling limits: %v", slot.ID, err)
+		if errors.Is(err, ErrSlotNotAvailable) {
+			refundUnfulfilledPayment(confirmation, err)
+		}
+		return nil, err
 	}
 
 	//FIXME: Temporarily disabling Google Meet link creation
@@ -111,6 +185,7 @@ func BookExpertSlot(c *gin.Context, slotID uint) error {
 	// 	calService,
 	// 	slot.StartTime,
 	// 	slot.EndTime,
+	// 	utils.UserLocation(tx, slot.ExpertID),
 	// )
 	// if err != nil {
 	// 	tx.Rollback()
@@ -118,11 +193,225 @@ func BookExpertSlot(c *gin.Context, slotID uint) error {
 	// 	return err
 	// }
 
+	session, err := createSessionWithTx(tx, slot, payment.StudentID, studentUUID, payment.OrderID, nil)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	expertDetails, err := expertRepo.GetWithTx(tx, &models.Expert{
+		UserID: slot.ExpertID,
+	})
+	if err != nil {
+		logger.Error("error in fetching expert details: ", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Payments created before the split was recorded are split now
+	total := payment.Amount + payment.WalletAmount
+	platformFee, expertShare := payment.PlatformFee, payment.ExpertShare
+	if platformFee+expertShare != total {
+		platformFee, expertShare = splitSessionFee(total, commissionPercentFor(expertDetails))
+	}
+
+	fundingAccount, err := collectWalletPaymentWithTx(tx, payment, studentUUID)
+	if err != nil {
+		logger.Error("error in collecting wallet payment: ", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := creditSessionEarningsWithTx(tx, session, platformFee, expertShare, fundingAccount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Mark payment as paid
+	paidAt := time.Now()
+	err = paymentRepo.UpdateWithTx(tx, &models.Payment{
+		Status:      string(models.PaymentPaid),
+		PaymentID:   confirmation.PaymentID,
+		Method:      confirmation.Method,
+		PaidAt:      &paidAt,
+		PlatformFee: platformFee,
+		ExpertShare: expertShare,
+	}, &models.Payment{OrderID: payment.OrderID})
+	if err != nil {
+		logger.Error("error in marking payment as paid: ", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Count the coupon use together with the booking
+	if err := redeemCouponWithTx(tx, payment, session.SessionUUID); err != nil {
+		logger.Error("error in redeeming coupon: ", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Issue the tax invoice with the next number in this financial year
+	payment.PaidAt = &paidAt
+	payment.PlatformFee, payment.ExpertShare = platformFee, expertShare
+	if _, err := issueInvoiceWithTx(tx, payment, session.SessionUUID); err != nil {
+		logger.Error("error in issuing invoice: ", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	// All good, commit tx
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// refundUnfulfilledPayment gives back a captured payment for something that
+// could no longer be had, a slot taken meanwhile or a void subscription
+// charge: the gateway part through the gateway and the wallet part to the
+// wallet. Any slot hold and coupon reservation of the order is released.
+// The payment ends up refunded with reason recorded, so it is never booked
+// later. Orders no one has paid through the gateway are left to expire.
+// Errors are logged; reconciliation finds a paid order that is neither
+// booked nor refunded.
+func refundUnfulfilledPayment(confirmation PaymentConfirmation, reason error) {
+	if confirmation.PaymentID == "" {
+		return
+	}
+
+	var (
+		tx          = config.DB.Begin()
+		paymentRepo = models.InitPaymentRepo(tx)
+		studentRepo = models.InitStudentRepo(tx)
+		now         = time.Now()
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	payment, err := paymentRepo.GetByOrderIDForUpdate(tx, confirmation.OrderID)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("error in fetching unfulfilled payment %s: %v", confirmation.OrderID, err)
+		return
+	}
+
+	// Booked or refunded by a concurrent confirmation
+	if !payableStatus(payment.Status) {
+		tx.Rollback()
+		return
+	}
+
+	student, err := studentRepo.GetByID(payment.StudentID)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("error in fetching student of unfulfilled payment %s: %v", payment.OrderID, err)
+		return
+	}
+
+	// Nothing to give back if the order expired and returned it already
+	if _, err := releaseWalletCredits(tx, student.UserID, payment.OrderID, now); err != nil {
+		tx.Rollback()
+		logger.Errorf("error in returning wallet payment of unfulfilled order %s: %v", payment.OrderID, err)
+		return
+	}
+
+	if err := releaseCouponWithTx(tx, payment); err != nil {
+		tx.Rollback()
+		logger.Errorf("error in releasing coupon of unfulfilled order %s: %v", payment.OrderID, err)
+		return
+	}
+
+	if _, err := models.InitAvailabilitySlotRepo(tx).ReleaseHoldsWithTx(tx, []string{payment.OrderID}); err != nil {
+		tx.Rollback()
+		logger.Errorf("error in releasing hold of unfulfilled order %s: %v", payment.OrderID, err)
+		return
+	}
+
+	err = paymentRepo.UpdateWithTx(tx, &models.Payment{
+		Status:       string(models.PaymentRefunded),
+		PaymentID:    confirmation.PaymentID,
+		Method:       confirmation.Method,
+		CapturedAt:   &now,
+		RefundReason: reason.Error(),
+	}, &models.Payment{OrderID: payment.OrderID})
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("error in updating unfulfilled payment %s: %v", payment.OrderID, err)
+		return
+	}
+
+	if err := queueRefundWithTx(tx, payment, payment.Amount); err != nil {
+		tx.Rollback()
+		logger.Errorf("error in refunding unfulfilled payment %s: %v", payment.OrderID, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Errorf("error in committing refund of unfulfilled payment %s: %v", payment.OrderID, err)
+		return
+	}
+
+	if err := issuePendingRefund(payment.OrderID); err != nil {
+		logger.Errorf("refund of unfulfilled payment %s is pending: %v", payment.OrderID, err)
+	}
+	logger.Infof("refunded payment %s of order %s: %v", payment.PaymentID, payment.OrderID, reason)
+}
+
+// collectWalletPaymentWithTx returns the account a booked order's earnings
+// are paid from. Plain gateway orders pay straight from the gateway. When
+// the wallet paid part of the order, that part already sits in the checkout
+// clearing account and the gateway part is collected there too. An order
+// that expired before it was paid gave its wallet part back, so it is taken
+// from the wallet again.
+func collectWalletPaymentWithTx(tx *gorm.DB, payment *models.Payment, studentUUID string) (string, error) {
+	if payment.WalletAmount == 0 {
+		return models.LedgerGatewayAccount, nil
+	}
+
+	if payment.Status == string(models.PaymentExpired) {
+		err := spendWalletCredits(tx, studentUUID, int64(payment.WalletAmount), payment.OrderID, time.Now())
+		if err != nil {
+			return "", fmt.Errorf("wallet no longer covers %d paise of expired order %s: %w", payment.WalletAmount, payment.OrderID, err)
+		}
+	}
+
+	if payment.Amount > 0 {
+		err := models.InitLedgerRepo(tx).Create(&models.LedgerTransaction{
+			Kind:        "collect:checkout",
+			ReferenceID: payment.OrderID,
+			Description: "Gateway part of an order paid partly from the wallet",
+			Postings: []models.LedgerPosting{
+				{Account: models.LedgerCheckoutAccount, AmountInPaise: int64(payment.Amount)},
+				{Account: models.LedgerGatewayAccount, AmountInPaise: -int64(payment.Amount)},
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return models.LedgerCheckoutAccount, nil
+}
+
+// createSessionWithTx creates the session for a slot locked for booking and
+// marks the slot booked. Exactly one of orderID and creditID says how the
+// session was paid for.
+func createSessionWithTx(tx *gorm.DB, slot *models.AvailabilitySlot, studentID uint, studentUUID string, orderID string, creditID *uint) (*models.Session, error) {
 	session := &models.Session{
 		SessionUUID: uuid.New().String(),
 		ExpertUUID:  slot.ExpertID,
 		StudentUUID: studentUUID,
 		SlotID:      slot.ID,
+		OrderID:     orderID,
+		CreditID:    creditID,
 		StartTime:   slot.StartTime,
 		EndTime:     slot.EndTime,
 		Status:      "scheduled",
@@ -134,73 +423,45 @@ func BookExpertSlot(c *gin.Context, slotID uint) error {
 		session.StartTime,
 	)
 
-	if err := sessionRepo.Create(session); err != nil {
+	if err := models.InitSessionRepo(tx).Create(session); err != nil {
 		logger.Error("error in creating session: ", err)
-		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	// 5️⃣ Mark slot as booked
-	err = AvailabilitySlotRepo.UpdateWithTx(
-		tx,
-		&models.AvailabilitySlot{
-			Status: string(models.SlotBooked),
-		}, &models.AvailabilitySlot{
-			ID: slot.ID,
-		})
-	if err != nil {
+	// Mark slot as booked (releases the checkout hold)
+	if err := models.InitAvailabilitySlotRepo(tx).MarkBookedWithTx(tx, slot.ID, studentID); err != nil {
 		logger.Error("error in marking slot as booked: ", err)
-		tx.Rollback()
-		return err
+		return nil, err
 	}
+	return session, nil
+}
 
-	expertDetails, err := expertRepo.GetWithTx(tx, &models.Expert{
-		UserID: slot.ExpertID,
-	})
+// creditSessionEarningsWithTx holds the expert's share of a booked session
+// in escrow and credits the platform's commission, both paid out of
+// fundingAccount: the gateway for paid orders, the prepaid pool for credits.
+func creditSessionEarningsWithTx(tx *gorm.DB, session *models.Session, platformFee uint, expertShare uint, fundingAccount string) error {
+	// The expert's share is held in escrow until the session is completed
+	err := holdWallet(tx, session.ExpertUUID, fundingAccount, int64(expertShare), "session",
+		session.SessionUUID, "Payment for session booking (held until completion)")
 	if err != nil {
-		logger.Error("error in fetching expert details: ", err)
-		tx.Rollback()
+		logger.Error("error in holding expert earnings: ", err)
 		return err
 	}
 
-	//Crediting to expert wallet next step
-	wallet, err := walletRepo.GetByUserUUID(slot.ExpertID)
+	// The platform's commission goes to its own ledger account
+	err = creditWallet(tx, models.PlatformWalletUUID, fundingAccount, int64(platformFee), "commission",
+		session.SessionUUID, "Commission on session booking")
 	if err != nil {
-		// If wallet doesn't exist, create it
-		wallet = &models.Wallet{
-			UserUUID:       slot.ExpertID,
-			BalanceInPaise: 0,
-		}
-		if err := walletRepo.Create(wallet); err != nil {
-			logger.Error("error in creating expert wallet: ", err)
-			tx.Rollback()
-			return err
-		}
-	}
-
-	// Update balance
-	newBalance := wallet.BalanceInPaise + int64(expertDetails.FeesPerSession)
-	if err := walletRepo.UpdateBalance(slot.ExpertID, newBalance); err != nil {
-		logger.Error("error in updating expert wallet balance: ", err)
-		tx.Rollback()
-		return err
+		logger.Error("error in crediting platform commission: ", err)
 	}
+	return err
+}
 
-	// Create wallet transaction
-	err = wtRepo.Create(tx, &models.WalletTransaction{
-		WalletID:      wallet.ID,
-		AmountInPaise: int64(expertDetails.FeesPerSession),
-		Type:          "credit",
-		Source:        "session",
-		ReferenceID:   session.SessionUUID,
-		Description:   "Payment for session booking",
-	})
-	if err != nil {
-		logger.Error("error in creating wallet transaction: ", err)
-		tx.Rollback()
-		return err
+// payableStatus reports whether a payment in this status may still be paid.
+func payableStatus(status string) bool {
+	switch models.PaymentStatus(status) {
+	case models.PaymentCreated, models.PaymentFailed, models.PaymentExpired:
+		return true
 	}
-
-	// All good, commit tx
-	return tx.Commit().Error
+	return false
 }
@@ -0,0 +1,616 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Cancel a booked session (student: policy-based refund,
+// expert: reason required, full refund, counted on the expert profile)
+//    ↓
+// BEGIN TX
+//    ├─ Lock session (must be scheduled and not yet started)
+//    ├─ Lock payment
+//    ├─ Apply policy → refund % and whether the slot goes back on sale
+//    ├─ Cancel session
+//    ├─ Release slot (AVAILABLE) or retire it (CANCELLED)
+//    ├─ Void the refunded part of the expert's escrow, debit platform commission
+//    ├─ Queue the gateway refund (the wallet part of an order goes back to
+//    │  the wallet, and students may take the whole refund as wallet
+//    │  credit), or give back the session credit it was booked with
+// COMMIT
+//    ↓
+// Send the queued refund to the gateway
+//
+// The gateway is only called once the cancellation is saved. If the call
+// fails, the refund stays queued on the payment and the pending-refunds job
+// sends it later.
+//
+// A credit is a whole session, so it is only given back when the policy
+// would refund in full; a later cancellation uses it up.
+
+var (
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrSessionNotCancellable = errors.New("session can no longer be cancelled")
+	ErrNotSessionParticipant = errors.New("session does not belong to this user")
+	ErrRefundFailed          = errors.New("refund could not be issued")
+)
+
+const (
+	CancelledByStudent = "student"
+	CancelledByExpert  = "expert"
+)
+
+// cancellationPolicy decides how much of the payment is refunded and whether
+// the freed slot can be offered to other students.
+type cancellationPolicy func(session *models.Session, now time.Time) (refundPercent int, releaseSlot bool)
+
+// studentCancellationPolicy applies the configured refund tiers. The slot
+// only goes back on sale while there is still time for someone to book it.
+func studentCancellationPolicy(session *models.Session, now time.Time) (int, bool) {
+	cfg := config.RuntimeConfig()
+	notice := session.StartTime.Sub(now)
+
+	switch {
+	case notice >= cfg.CancellationFullRefundBefore:
+		return 100, true
+	case notice >= cfg.CancellationPartialRefundBefore:
+		return cfg.CancellationPartialRefundPercent, true
+	default:
+		return 0, false
+	}
+}
+
+// expertCancellationPolicy always refunds the student in full. The slot is
+// retired rather than re-offered, since the expert cannot take it.
+func expertCancellationPolicy(session *models.Session, now time.Time) (int, bool) {
+	return 100, false
+}
+
+// Where a student's refund goes
+const (
+	RefundToOriginal = "original" // back to the card or UPI account, wallet part to the wallet
+	RefundToWallet   = "wallet"   // all of it as wallet credit
+)
+
+type CancelSessionRequest struct {
+	Reason   string `json:"reason"`
+	RefundTo string `json:"refund_to"` // original (default), wallet
+}
+
+type ExpertCancelSessionRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type CancelSessionResponse struct {
+	SessionUUID   string `json:"session_uuid"`
+	Status        string `json:"status"`
+	RefundPercent int    `json:"refund_percent"`
+	RefundAmount  uint   `json:"refund_amount"` // in paise, gateway and wallet together
+	SlotReleased  bool   `json:"slot_released"`
+
+	WalletRefundAmount uint `json:"wallet_refund_amount,omitempty"` // part of RefundAmount credited to the wallet
+	CreditRestored     bool `json:"credit_restored,omitempty"`
+}
+
+func CancelStudentSessionHandler(c *gin.Context) {
+	var req CancelSessionRequest
+
+	// The body is optional for students
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Error("error in binding cancel request: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+
+	if req.RefundTo != "" && req.RefundTo != RefundToOriginal && req.RefundTo != RefundToWallet {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refund_to must be original or wallet"})
+		return
+	}
+
+	studentUUID := c.GetString("user_uuid")
+	resp, err := cancelSession(
+		c.Param("session_uuid"),
+		CancelledByStudent,
+		req.Reason,
+		req.RefundTo == RefundToWallet,
+		func(session *models.Session) bool { return session.StudentUUID == studentUUID },
+		studentCancellationPolicy,
+		nil,
+	)
+	if err != nil {
+		respondCancellationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func CancelExpertSessionHandler(c *gin.Context) {
+	var req ExpertCancelSessionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		logger.Error("error in binding expert cancel request: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a cancellation reason is required"})
+		return
+	}
+
+	expertUUID := c.GetString("user_uuid")
+	resp, err := cancelSession(
+		c.Param("session_uuid"),
+		CancelledByExpert,
+		strings.TrimSpace(req.Reason),
+		false,
+		func(session *models.Session) bool { return session.ExpertUUID == expertUUID },
+		expertCancellationPolicy,
+		func(tx *gorm.DB, session *models.Session) error {
+			err := models.InitExpertRepo(tx).RecordCancellationWithTx(tx, session.ExpertUUID,
+				config.RuntimeConfig().ExpertCancellationFlagThreshold)
+			if err != nil {
+				logger.Error("error in recording expert cancellation: ", err)
+			}
+			return err
+		},
+	)
+	if err != nil {
+		respondCancellationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func respondCancellationError(c *gin.Context, err error) {
+	logger.Error("error in cancelling session: ", err)
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotSessionParticipant):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrSessionNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel session"})
+	}
+}
+
+func cancelSession(
+	sessionUUID string,
+	cancelledBy string,
+	reason string,
+	refundToWallet bool,
+	isParticipant func(session *models.Session) bool,
+	policy cancellationPolicy,
+	onCancelled func(tx *gorm.DB, session *models.Session) error,
+) (*CancelSessionResponse, error) {
+
+	var (
+		tx          = config.DB.Begin()
+		sessionRepo = models.InitSessionRepo(tx)
+		slotRepo    = models.InitAvailabilitySlotRepo(tx)
+		now         = time.Now()
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	session, err := sessionRepo.GetByUUIDForUpdate(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	if !isParticipant(session) {
+		tx.Rollback()
+		return nil, ErrNotSessionParticipant
+	}
+
+	if session.Status != models.SessionScheduled || !session.StartTime.After(now) {
+		tx.Rollback()
+		return nil, ErrSessionNotCancellable
+	}
+
+	refundPercent, releaseSlot := policy(session, now)
+
+	if err := sessionRepo.CancelWithDetails(session.SessionUUID, cancelledBy, reason); err != nil {
+		tx.Rollback()
+		logger.Error("error in cancelling session: ", err)
+		return nil, err
+	}
+
+	if releaseSlot {
+		err = slotRepo.ReleaseWithTx(tx, session.SlotID)
+	} else {
+		err = slotRepo.UpdateWithTx(tx,
+			&models.AvailabilitySlot{Status: string(models.SlotCancelled)},
+			&models.AvailabilitySlot{ID: session.SlotID})
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in updating slot of cancelled session: ", err)
+		return nil, err
+	}
+
+	refund, err := refundSessionWithTx(tx, session, refundPercent, refundToWallet, "cancellation")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if onCancelled != nil {
+		if err := onCancelled(tx, session); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	// The session is cancelled either way; a refund that does not go
+	// through now is retried by the pending-refunds job
+	if refund.GatewayAmount > 0 {
+		if err := issuePendingRefund(refund.OrderID); err != nil {
+			logger.Errorf("refund of cancelled session %s is pending: %v", session.SessionUUID, err)
+		}
+	}
+
+	refundAmount := refund.GatewayAmount + refund.WalletAmount
+	logger.Infof("session %s cancelled by %s (refund %d%%, %d paise, %d to wallet, credit restored=%t, slot released=%t)",
+		session.SessionUUID, cancelledBy, refund.Percent, refundAmount, refund.WalletAmount, refund.CreditRestored, releaseSlot)
+
+	return &CancelSessionResponse{
+		SessionUUID:   session.SessionUUID,
+		Status:        models.SessionCancelled,
+		RefundPercent: refund.Percent,
+		RefundAmount:  refundAmount,
+		SlotReleased:  releaseSlot,
+
+		WalletRefundAmount: refund.WalletAmount,
+		CreditRestored:     refund.CreditRestored,
+	}, nil
+}
+
+// sessionRefund is what refundSessionWithTx gave back to the student.
+type sessionRefund struct {
+	Percent        int
+	OrderID        string
+	GatewayAmount  uint // queued, sent by issuePendingRefund once tx commits
+	WalletAmount   uint
+	CreditRestored bool
+}
+
+// refundSessionWithTx refunds refundPercent of what the session cost. The
+// expert's and the platform's shares are reversed and the money goes back
+// the way it came in, or all to the wallet with refundToWallet. A credit is
+// a whole session, so it is only given back by a full refund. cause, such
+// as "cancellation", ends the descriptions of the entries.
+func refundSessionWithTx(tx *gorm.DB, session *models.Session, refundPercent int, refundToWallet bool, cause string) (*sessionRefund, error) {
+	refund := &sessionRefund{Percent: refundPercent}
+
+	// Credit-booked sessions are paid from the prepaid pool, which gets
+	// the money back along with the credit
+	fundingAccount := models.LedgerGatewayAccount
+	if session.CreditID != nil {
+		fundingAccount = models.LedgerSessionCreditsAccount
+		if refund.Percent < 100 {
+			refund.Percent = 0
+		}
+	}
+
+	// Orders paid partly from the wallet were paid out of the checkout
+	// clearing account, which the refund is split from
+	var payment *models.Payment
+	if session.CreditID == nil && session.OrderID != "" {
+		var err error
+		payment, err = models.InitPaymentRepo(tx).GetByOrderIDForUpdate(tx, session.OrderID)
+		if err != nil {
+			logger.Error("error in fetching payment of refunded session: ", err)
+			return nil, err
+		}
+		if payment.WalletAmount > 0 {
+			fundingAccount = models.LedgerCheckoutAccount
+		}
+	}
+
+	reversed, err := reverseSessionCredits(tx, session, refund.Percent, fundingAccount, cause)
+	if err != nil {
+		logger.Error("error in reversing session credits: ", err)
+		return nil, err
+	}
+
+	switch {
+	case session.CreditID != nil:
+		if refund.Percent == 100 {
+			if err := models.InitSessionCreditRepo(tx).RestoreWithTx(tx, *session.CreditID); err != nil {
+				logger.Error("error in restoring session credit: ", err)
+				return nil, err
+			}
+			refund.CreditRestored = true
+		}
+	case payment == nil:
+		logger.Warnf("session %s has no payment order; nothing to refund", session.SessionUUID)
+	default:
+		gatewayRefund, walletRefund, err := refundSessionPayment(tx, session, payment, refund.Percent, reversed,
+			fundingAccount, refundToWallet, cause)
+		if err != nil {
+			return nil, err
+		}
+		refund.OrderID, refund.GatewayAmount, refund.WalletAmount = payment.OrderID, gatewayRefund, walletRefund
+	}
+
+	return refund, nil
+}
+
+// reverseSessionCredits takes back refundPercent of what the expert and the
+// platform were credited for the session, so both sides share the refund in
+// the same proportion as the original split. The expert's share is normally
+// still in escrow; sessions booked before escrow existed were credited to the
+// available balance directly. The reversed money goes back to
+// fundingAccount, the account the session was paid from; the total is
+// returned.
+func reverseSessionCredits(tx *gorm.DB, session *models.Session, refundPercent int, fundingAccount string, cause string) (int64, error) {
+	held, err := reverseWalletCredit(tx, session.ExpertUUID, "hold", "session", session.SessionUUID, refundPercent, fundingAccount,
+		"Void of %d%% of escrowed session earnings after "+cause)
+	if err != nil {
+		return 0, err
+	}
+
+	earned, err := reverseWalletCredit(tx, session.ExpertUUID, "credit", "session", session.SessionUUID, refundPercent, fundingAccount,
+		"Reversal of %d%% of session earnings after "+cause)
+	if err != nil {
+		return 0, err
+	}
+
+	commission, err := reverseWalletCredit(tx, models.PlatformWalletUUID, "credit", "commission", session.SessionUUID, refundPercent, fundingAccount,
+		"Reversal of %d%% of session commission after "+cause)
+	return held + earned + commission, err
+}
+
+// reverseWalletCredit takes back refundPercent of the entries of creditType
+// ("credit" or "hold") and source the user received for referenceID, net of
+// anything already reversed. Held amounts are voided from the pending
+// balance; credits are debited from the available balance. It returns the
+// amount taken back.
+func reverseWalletCredit(tx *gorm.DB, userUUID string, creditType string, creditSource string, referenceID string, refundPercent int, counterAccount string, description string) (int64, error) {
+	var (
+		walletRepo = models.InitWalletRepo(tx)
+		wtRepo     = models.InitWalletTransactionRepo(tx)
+	)
+
+	if refundPercent <= 0 {
+		return 0, nil
+	}
+
+	reversalType, balance := "debit", models.LedgerBalanceAvailable
+	if creditType == "hold" {
+		reversalType, balance = "void", models.LedgerBalancePending
+	}
+
+	wallet, err := walletRepo.GetByUserUUID(userUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	entries, err := wtRepo.GetByReferenceID(referenceID)
+	if err != nil {
+		return 0, err
+	}
+
+	var credited int64
+	for _, entry := range entries {
+		if entry.WalletID != wallet.ID {
+			continue
+		}
+		switch {
+		case entry.Type == creditType && entry.Source == creditSource:
+			credited += entry.AmountInPaise
+		case entry.Type == reversalType && entry.Source == "refund":
+			credited -= entry.AmountInPaise
+		}
+	}
+
+	debit := credited * int64(refundPercent) / 100
+	if debit <= 0 {
+		return 0, nil
+	}
+
+	return debit, moveWalletFunds(tx, walletMovement{
+		UserUUID:       userUUID,
+		Balance:        balance,
+		AmountInPaise:  -debit,
+		CounterAccount: counterAccount,
+		Type:           reversalType,
+		Source:         "refund",
+		ReferenceID:    referenceID,
+		Description:    fmt.Sprintf(description, refundPercent),
+	})
+}
+
+// queueRefundWithTx records on the locked payment a gateway refund to be
+// issued once tx commits, by issuePendingRefund. Nothing reaches the
+// gateway before the rest of the refund is saved, so a rollback never
+// leaves money refunded that the books still show as paid.
+func queueRefundWithTx(tx *gorm.DB, payment *models.Payment, amount uint) error {
+	if remaining := payment.Amount - payment.RefundedAmount - payment.RefundPending; amount > remaining {
+		amount = remaining
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	payment.RefundPending += amount
+	return tx.Model(&models.Payment{}).
+		Where("id = ?", payment.ID).
+		Update("refund_pending", payment.RefundPending).Error
+}
+
+// issuePendingRefund sends the payment's queued refund to the gateway and
+// records it. The payment stays locked meanwhile so the refund is sent only
+// once; the gateway's refunded total tells whether an earlier attempt got
+// through before it could be recorded.
+func issuePendingRefund(orderID string) error {
+	var (
+		tx          = config.DB.Begin()
+		paymentRepo = models.InitPaymentRepo(tx)
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	payment, err := paymentRepo.GetByOrderIDForUpdate(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if payment.RefundPending == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	gp, err := config.Payments.FetchPayment(payment.PaymentID)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("error in fetching payment %s before refund: %v", payment.PaymentID, err)
+		return ErrRefundFailed
+	}
+
+	fields := map[string]interface{}{}
+	refunded := payment.RefundedAmount + payment.RefundPending
+	if unsent := int64(refunded) - gp.AmountRefunded; unsent > 0 {
+		refund, err := config.Payments.Refund(payment.PaymentID, unsent, map[string]string{"order_id": payment.OrderID})
+		if err != nil {
+			tx.Rollback()
+			logger.Errorf("refund of %d paise for %s failed: %v", unsent, payment.PaymentID, err)
+			return ErrRefundFailed
+		}
+		fields["refund_id"] = refund.ID
+	}
+
+	status := models.PaymentPartiallyRefunded
+	if refunded >= payment.Amount {
+		status = models.PaymentRefunded
+	}
+	fields["status"] = string(status)
+	fields["refunded_amount"] = refunded
+	fields["refund_pending"] = 0
+
+	if err := tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(fields).Error; err != nil {
+		tx.Rollback()
+		logger.Errorf("error in recording refund of %s: %v", payment.PaymentID, err)
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// issuePendingRefundsBatchSize bounds how many queued refunds one run sends.
+const issuePendingRefundsBatchSize = 100
+
+// IssuePendingRefunds sends refunds still queued, those whose gateway call
+// failed or never ran after their transaction committed. It returns how
+// many were issued.
+func IssuePendingRefunds(now time.Time) (int, error) {
+	payments, err := models.InitPaymentRepo(config.DB).ListRefundPending(issuePendingRefundsBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	issued := 0
+	for _, payment := range payments {
+		if err := issuePendingRefund(payment.OrderID); err != nil {
+			logger.Errorf("error in issuing pending refund of order %s: %v", payment.OrderID, err)
+			continue
+		}
+		issued++
+	}
+	return issued, nil
+}
+
+// refundSessionPayment returns a session's refund to the student,
+// after reverseSessionCredits has moved reversed back to fundingAccount.
+// For plain gateway orders refundPercent of the charge goes back through
+// the gateway, queued to be sent once the refund commits. For orders
+// paid partly from the wallet the gateway gets its share back and the rest
+// of what was reversed returns to the wallet. With refundToWallet
+// everything is credited to the wallet instead.
+func refundSessionPayment(tx *gorm.DB, session *models.Session, payment *models.Payment, refundPercent int, reversed int64, fundingAccount string, refundToWallet bool, cause string) (gatewayRefund uint, walletRefund uint, err error) {
+	gatewayRefund = payment.Amount * uint(refundPercent) / 100
+	if fundingAccount == models.LedgerCheckoutAccount {
+		gatewayRefund = min(gatewayRefund, uint(reversed))
+		walletRefund = uint(reversed) - gatewayRefund
+	}
+	if refundToWallet {
+		gatewayRefund, walletRefund = 0, gatewayRefund+walletRefund
+	}
+
+	if walletRefund > 0 {
+		expiresAt := time.Now().Add(config.RuntimeConfig().WalletRefundCreditValidity)
+		err = grantWalletCredit(tx, session.StudentUUID, int64(walletRefund), models.WalletCreditFromRefund,
+			session.SessionUUID, "Refund for session after "+cause, &expiresAt, fundingAccount)
+		if err != nil {
+			logger.Error("error in crediting refund to wallet: ", err)
+			return 0, 0, err
+		}
+	}
+
+	if gatewayRefund == 0 {
+		return 0, walletRefund, nil
+	}
+
+	// The gateway part leaves the checkout clearing account through the gateway
+	if fundingAccount == models.LedgerCheckoutAccount {
+		err = models.InitLedgerRepo(tx).Create(&models.LedgerTransaction{
+			Kind:        "refund:gateway",
+			ReferenceID: session.SessionUUID,
+			Description: "Gateway part of a refund for an order paid partly from the wallet",
+			Postings: []models.LedgerPosting{
+				{Account: models.LedgerGatewayAccount, AmountInPaise: int64(gatewayRefund)},
+				{Account: models.LedgerCheckoutAccount, AmountInPaise: -int64(gatewayRefund)},
+			},
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := queueRefundWithTx(tx, payment, gatewayRefund); err != nil {
+		return 0, 0, err
+	}
+	return gatewayRefund, walletRefund, nil
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+)
+
+// commissionPercentFor returns the platform's cut of the expert's sessions:
+// the expert's own override when set, otherwise the configured default.
+func commissionPercentFor(expert *models.Expert) int {
+	percent := config.RuntimeConfig().PlatformCommissionPercent
+	if expert.CommissionPercent != nil {
+		percent = *expert.CommissionPercent
+	}
+
+	if percent < 0 {
+		return 0
+	}
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// splitSessionFee divides an amount (in paise) between platform and expert.
+// Rounding favours the expert so the two parts always add up to the amount.
+func splitSessionFee(amount uint, commissionPercent int) (platformFee uint, expertShare uint) {
+	platformFee = amount * uint(commissionPercent) / 100
+	return platformFee, amount - platformFee
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import "testing"
+
+func TestSplitSessionFee(t *testing.T) {
+	tests := []struct {
+		name              string
+		amount            uint
+		commissionPercent int
+		platformFee       uint
+		expertShare       uint
+	}{
+		{"even split", 1000, 20, 200, 800},
+		{"rounding favours the expert", 999, 15, 149, 850},
+		{"no commission", 1000, 0, 0, 1000},
+		{"all commission", 1000, 100, 1000, 0},
+		{"zero amount", 0, 20, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			platformFee, expertShare := splitSessionFee(tt.amount, tt.commissionPercent)
+			if platformFee != tt.platformFee || expertShare != tt.expertShare {
+				t.Errorf("splitSessionFee(%d, %d) = %d, %d; want %d, %d",
+					tt.amount, tt.commissionPercent, platformFee, expertShare, tt.platformFee, tt.expertShare)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponInactive      = errors.New("coupon is not valid at this time")
+	ErrCouponExhausted     = errors.New("coupon has been fully redeemed")
+	ErrCouponUserLimit     = errors.New("coupon already used the maximum number of times")
+	ErrCouponMinFee        = errors.New("session fee is below the coupon's minimum")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this expert")
+	ErrCouponFullDiscount  = errors.New("coupon cannot cover the whole session fee")
+)
+
+// isCouponError reports whether err explains why a coupon was refused, as
+// opposed to a failure looking it up.
+func isCouponError(err error) bool {
+	for _, target := range []error{ErrCouponNotFound, ErrCouponInactive, ErrCouponExhausted,
+		ErrCouponUserLimit, ErrCouponMinFee, ErrCouponNotApplicable, ErrCouponFullDiscount} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// SessionPrice is what a student pays for one session and how it is split.
+type SessionPrice struct {
+	OriginalAmount uint
+	Discount       uint
+	Amount         uint
+	PlatformFee    uint
+	ExpertShare    uint
+	Coupon         *models.Coupon
+}
+
+// couponDiscount is the discount the coupon gives on fee, before capping
+// at the funding party's share.
+func couponDiscount(coupon *models.Coupon, fee uint) uint {
+	var discount int64
+	switch models.CouponDiscountType(coupon.DiscountType) {
+	case models.CouponPercent:
+		discount = int64(fee) * int64(coupon.PercentOff) / 100
+		if coupon.MaxDiscountInPaise > 0 && discount > coupon.MaxDiscountInPaise {
+			discount = coupon.MaxDiscountInPaise
+		}
+	case models.CouponFlat:
+		discount = coupon.AmountOffInPaise
+	}
+
+	if discount < 0 {
+		return 0
+	}
+	return uint(min(discount, int64(fee)))
+}
+
+// couponAppliesTo reports whether a restricted coupon covers the expert.
+func couponAppliesTo(coupon *models.Coupon, expert *models.Expert) bool {
+	return expertInScope(coupon.ExpertUUIDs, coupon.Specializations, expert)
+}
+
+// expertInScope reports whether an expert falls within a restriction:
+// either the expert is listed or shares one of the listed specializations.
+// Empty lists restrict nothing.
+func expertInScope(expertUUIDs []string, specializations []string, expert *models.Expert) bool {
+	if len(expertUUIDs) == 0 && len(specializations) == 0 {
+		return true
+	}
+
+	for _, uuid := range expertUUIDs {
+		if uuid == expert.UserID {
+			return true
+		}
+	}
+	for _, wanted := range specializations {
+		for _, have := range expert.Specializations {
+			if strings.EqualFold(strings.TrimSpace(wanted), strings.TrimSpace(have)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkCoupon verifies that the student may use the coupon on a session
+// with the expert now, counting redemptions as db sees them. The
+// reservation of the replacing order, one the new order takes the place
+// of, does not count against the limits.
+func checkCoupon(db *gorm.DB, coupon *models.Coupon, studentID uint, expert *models.Expert, replacing string, now time.Time) error {
+	couponRepo := models.InitCouponRepo(db)
+
+	if !coupon.Active ||
+		(coupon.ValidFrom != nil && now.Before(*coupon.ValidFrom)) ||
+		(coupon.ValidUntil != nil && !now.Before(*coupon.ValidUntil)) {
+		return ErrCouponInactive
+	}
+
+	replaced := 0
+	if replacing != "" {
+		held, err := couponRepo.HasPendingRedemption(coupon.ID, replacing)
+		if err != nil {
+			return err
+		}
+		if held {
+			replaced = 1
+		}
+	}
+
+	if coupon.MaxRedemptions > 0 && coupon.RedemptionCount-replaced >= coupon.MaxRedemptions {
+		return ErrCouponExhausted
+	}
+
+	if coupon.MinFeeInPaise > 0 && int64(sessionFeeInPaise(expert)) < coupon.MinFeeInPaise {
+		return ErrCouponMinFee
+	}
+
+	if !couponAppliesTo(coupon, expert) {
+		return ErrCouponNotApplicable
+	}
+
+	if coupon.MaxRedemptionsPerUser > 0 {
+		used, err := couponRepo.CountRedemptionsByStudent(coupon.ID, studentID)
+		if err != nil {
+			return err
+		}
+		if used-int64(replaced) >= int64(coupon.MaxRedemptionsPerUser) {
+			return ErrCouponUserLimit
+		}
+	}
+
+	return nil
+}
+
+// priceSession works out what the student pays for a session with the
+// expert, applying the coupon when a code is given. The discount comes out
+// of the platform's commission or the expert's share as the campaign says,
+// and never more than that share, so neither side is paid a negative amount.
+// replacing is the student's unpaid order the new one takes over from, if any.
+func priceSession(expert *models.Expert, studentID uint, couponCode string, replacing string, now time.Time) (*SessionPrice, error) {
+	fee := sessionFeeInPaise(expert)
+	if fee <= 0 {
+		return nil, ErrInvalidSessionFee
+	}
+
+	price := &SessionPrice{OriginalAmount: uint(fee), Amount: uint(fee)}
+	price.PlatformFee, price.ExpertShare = splitSessionFee(uint(fee), commissionPercentFor(expert))
+
+	code := normalizeCouponCode(couponCode)
+	if code == "" {
+		return price, nil
+	}
+
+	coupon, err := models.InitCouponRepo(config.DB).GetByCode(code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+
+	if err := checkCoupon(config.DB, coupon, studentID, expert, replacing, now); err != nil {
+		return nil, err
+	}
+
+	discount := couponDiscount(coupon, uint(fee))
+	if models.CouponFunding(coupon.FundedBy) == models.CouponFundedByExpert {
+		discount = min(discount, price.ExpertShare)
+		price.ExpertShare -= discount
+	} else {
+		discount = min(discount, price.PlatformFee)
+		price.PlatformFee -= discount
+	}
+
+	price.Coupon = coupon
+	price.Discount = discount
+	price.Amount = uint(fee) - discount
+
+	// The gateway cannot take a zero amount
+	if price.Amount == 0 {
+		return nil, ErrCouponFullDiscount
+	}
+	return price, nil
+}
+
+// reserveCouponWithTx takes one of the coupon's redemptions for an order
+// being opened at the price worked out by priceSession. The coupon is
+// locked and checked again, so concurrent checkouts cannot go past its
+// limits; the reservation holds the place until the order is booked or
+// expires.
+func reserveCouponWithTx(tx *gorm.DB, price *SessionPrice, studentID uint, expert *models.Expert, orderID string, now time.Time) error {
+	if price.Coupon == nil {
+		return nil
+	}
+
+	couponRepo := models.InitCouponRepo(tx)
+
+	coupon, err := couponRepo.GetByIDForUpdate(tx, price.Coupon.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkCoupon(tx, coupon, studentID, expert, "", now); err != nil {
+		return err
+	}
+
+	_, err = couponRepo.RedeemWithTx(tx, &models.CouponRedemption{
+		CouponID:        coupon.ID,
+		StudentID:       studentID,
+		OrderID:         orderID,
+		Status:          models.CouponRedemptionPending,
+		DiscountInPaise: int64(price.Discount),
+		FundedBy:        coupon.FundedBy,
+	})
+	return err
+}
+
+// redeemCouponWithTx confirms the coupon use of a payment as part of the
+// booking transaction. An order paid after it expired lost its reservation,
+// so the use is counted again; if the coupon's global limit filled up in
+// the meantime, the booking still goes through, since the discounted amount
+// has been charged.
+func redeemCouponWithTx(tx *gorm.DB, payment *models.Payment, sessionUUID string) error {
+	if payment.CouponID == nil {
+		return nil
+	}
+
+	couponRepo := models.InitCouponRepo(tx)
+
+	coupon, err := couponRepo.GetByIDForUpdate(tx, *payment.CouponID)
+	if err != nil {
+		return err
+	}
+
+	confirmed, err := couponRepo.ConfirmWithTx(tx, payment.OrderID, sessionUUID)
+	if err != nil || confirmed {
+		return err
+	}
+
+	redeemed, err := couponRepo.RedeemWithTx(tx, &models.CouponRedemption{
+		CouponID:        coupon.ID,
+		StudentID:       payment.StudentID,
+		OrderID:         payment.OrderID,
+		Status:          models.CouponRedemptionConfirmed,
+		SessionUUID:     sessionUUID,
+		DiscountInPaise: int64(payment.DiscountInPaise),
+		FundedBy:        coupon.FundedBy,
+	})
+	if err != nil {
+		return err
+	}
+
+	if redeemed && coupon.MaxRedemptions > 0 && coupon.RedemptionCount >= coupon.MaxRedemptions {
+		logger.Warnf("coupon %s redeemed beyond its limit of %d by order %s", coupon.Code, coupon.MaxRedemptions, payment.OrderID)
+	}
+	return nil
+}
+
+// releaseCouponWithTx gives back the redemption an order reserved when it
+// will not be booked.
+func releaseCouponWithTx(tx *gorm.DB, payment *models.Payment) error {
+	if payment.CouponID == nil {
+		return nil
+	}
+
+	couponRepo := models.InitCouponRepo(tx)
+
+	// Lock the coupon first, in the same order as reservations do
+	if _, err := couponRepo.GetByIDForUpdate(tx, *payment.CouponID); err != nil {
+		return err
+	}
+	return couponRepo.ReleaseWithTx(tx, payment.OrderID)
+}
+
+type ValidateCouponRequest struct {
+	Code   string `json:"code" binding:"required"`
+	SlotID uint   `json:"slot_id" binding:"required"`
+}
+
+type ValidateCouponResponse struct {
+	Code           string `json:"code"`
+	Description    string `json:"description"`
+	OriginalAmount uint   `json:"original_amount"`
+	Discount       uint   `json:"discount"`
+	Amount         uint   `json:"amount"`
+}
+
+// ValidateCouponHandler previews a coupon on a slot without reserving it.
+func ValidateCouponHandler(c *gin.Context) {
+	var (
+		req         ValidateCouponRequest
+		slotRepo    = models.InitAvailabilitySlotRepo(config.DB)
+		expertRepo  = models.InitExpertRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	student, err := studentRepo.GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	slot, err := slotRepo.GetByID(req.SlotID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slot not found"})
+		return
+	}
+
+	expert, err := expertRepo.GetWithTx(config.DB, &models.Expert{UserID: slot.ExpertID})
+	if err != nil {
+		logger.Error("error in fetching expert for coupon: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	price, err := priceSession(expert, student.ID, req.Code, "", time.Now())
+	if err != nil {
+		switch {
+		case isCouponError(err), errors.Is(err, ErrInvalidSessionFee):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			logger.Error("error in validating coupon: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, ValidateCouponResponse{
+		Code:           price.Coupon.Code,
+		Description:    price.Coupon.Description,
+		OriginalAmount: price.OriginalAmount,
+		Discount:       price.Discount,
+		Amount:         price.Amount,
+	})
+}
+
+type CreateCouponRequest struct {
+	Code                  string     `json:"code" binding:"required"`
+	Description           string     `json:"description"`
+	DiscountType          string     `json:"discount_type" binding:"required"` // percent, flat
+	PercentOff            int        `json:"percent_off"`
+	AmountOffInPaise      int64      `json:"amount_off_in_paise"`
+	MaxDiscountInPaise    int64      `json:"max_discount_in_paise"`
+	FundedBy              string     `json:"funded_by"` // platform (default), expert
+	ValidFrom             *time.Time `json:"valid_from"`
+	ValidUntil            *time.Time `json:"valid_until"`
+	MaxRedemptions        int        `json:"max_redemptions"`
+	MaxRedemptionsPerUser int        `json:"max_redemptions_per_user"`
+	MinFeeInPaise         int64      `json:"min_fee_in_paise"`
+	ExpertUUIDs           []string   `json:"expert_uuids"`
+	Specializations       []string   `json:"specializations"`
+}
+
+func (r *CreateCouponRequest) validate() string {
+	switch models.CouponDiscountType(r.DiscountType) {
+	case models.CouponPercent:
+		if r.PercentOff <= 0 || r.PercentOff > 100 {
+			return "percent_off must be between 1 and 100"
+		}
+	case models.CouponFlat:
+		if r.AmountOffInPaise <= 0 {
+			return "amount_off_in_paise must be positive"
+		}
+	default:
+		return "discount_type must be percent or flat"
+	}
+
+	switch models.CouponFunding(r.FundedBy) {
+	case "", models.CouponFundedByPlatform, models.CouponFundedByExpert:
+	default:
+		return "funded_by must be platform or expert"
+	}
+
+	if r.ValidFrom != nil && r.ValidUntil != nil && !r.ValidUntil.After(*r.ValidFrom) {
+		return "valid_until must be after valid_from"
+	}
+	if r.MaxRedemptions < 0 || r.MaxRedemptionsPerUser < 0 || r.MinFeeInPaise < 0 || r.MaxDiscountInPaise < 0 {
+		return "limits cannot be negative"
+	}
+	return ""
+}
+
+func CreateCouponHandler(c *gin.Context) {
+	var req CreateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	fundedBy := req.FundedBy
+	if fundedBy == "" {
+		fundedBy = string(models.CouponFundedByPlatform)
+	}
+
+	coupon := &models.Coupon{
+		Code:                  normalizeCouponCode(req.Code),
+		Description:           req.Description,
+		Active:                true,
+		DiscountType:          req.DiscountType,
+		PercentOff:            req.PercentOff,
+		AmountOffInPaise:      req.AmountOffInPaise,
+		MaxDiscountInPaise:    req.MaxDiscountInPaise,
+		FundedBy:              fundedBy,
+		ValidFrom:             req.ValidFrom,
+		ValidUntil:            req.ValidUntil,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		MinFeeInPaise:         req.MinFeeInPaise,
+		ExpertUUIDs:           req.ExpertUUIDs,
+		Specializations:       req.Specializations,
+	}
+
+	couponRepo := models.InitCouponRepo(config.DB)
+	if _, err := couponRepo.GetByCode(coupon.Code); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "coupon code already exists"})
+		return
+	}
+
+	if err := couponRepo.Create(coupon); err != nil {
+		logger.Error("error in creating coupon: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+func ListCouponsHandler(c *gin.Context) {
+	coupons, err := models.InitCouponRepo(config.DB).ListAll()
+	if err != nil {
+		logger.Error("error in listing coupons: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupons)
+}
+
+// DeactivateCouponHandler stops a coupon from being applied to new orders.
+// Orders already created with it can still be paid.
+func DeactivateCouponHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("coupon_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid coupon id"})
+		return
+	}
+
+	if err := models.InitCouponRepo(config.DB).SetActive(uint(id), false); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": ErrCouponNotFound.Error()})
+			return
+		}
+		logger.Error("error in deactivating coupon: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "coupon deactivated"})
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"interviewexcel-backend-go/models"
+	"testing"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		fee    uint
+		want   uint
+	}{
+		{"percent", models.Coupon{DiscountType: string(models.CouponPercent), PercentOff: 10}, 50000, 5000},
+		{"percent rounds down", models.Coupon{DiscountType: string(models.CouponPercent), PercentOff: 15}, 999, 149},
+		{"percent capped", models.Coupon{DiscountType: string(models.CouponPercent), PercentOff: 50, MaxDiscountInPaise: 10000}, 50000, 10000},
+		{"percent under the cap", models.Coupon{DiscountType: string(models.CouponPercent), PercentOff: 10, MaxDiscountInPaise: 10000}, 50000, 5000},
+		{"hundred percent", models.Coupon{DiscountType: string(models.CouponPercent), PercentOff: 100}, 50000, 50000},
+		{"flat", models.Coupon{DiscountType: string(models.CouponFlat), AmountOffInPaise: 2000}, 50000, 2000},
+		{"flat above the fee", models.Coupon{DiscountType: string(models.CouponFlat), AmountOffInPaise: 80000}, 50000, 50000},
+		{"negative flat", models.Coupon{DiscountType: string(models.CouponFlat), AmountOffInPaise: -100}, 50000, 0},
+		{"unknown type", models.Coupon{DiscountType: "bogus", PercentOff: 10}, 50000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := couponDiscount(&tt.coupon, tt.fee); got != tt.want {
+				t.Errorf("couponDiscount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// A student may dispute a session from the moment it starts until its
+// earnings leave escrow. An open dispute blocks the release. An admin
+// resolves it with an outcome:
+//
+//   release        → the next escrow run releases the earnings
+//   refund_full    → the earnings are voided and the student refunded in full
+//   refund_partial → refund_percent is voided and refunded, the rest released
+//
+// Refunds are made in the resolving transaction the way a cancellation
+// refunds, and the gateway part is sent once it commits. Sessions the
+// expert never joined can be disputed too; releasing one marks it completed.
+
+var ErrPartialCreditRefund = errors.New("a session booked with a credit can only be refunded in full")
+
+type RaiseDisputeRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ResolveDisputeRequest struct {
+	Resolution    string `json:"resolution" binding:"required"`
+	Outcome       string `json:"outcome" binding:"required"` // release, refund_full, refund_partial
+	RefundPercent int    `json:"refund_percent"`             // 1-99, for refund_partial only
+}
+
+func (r *ResolveDisputeRequest) validate() string {
+	switch models.DisputeOutcome(r.Outcome) {
+	case models.DisputeRelease, models.DisputeRefundFull:
+		if r.RefundPercent != 0 {
+			return "refund_percent is only allowed with refund_partial"
+		}
+	case models.DisputeRefundPartial:
+		if r.RefundPercent < 1 || r.RefundPercent > 99 {
+			return "refund_percent must be between 1 and 99"
+		}
+	default:
+		return "outcome must be release, refund_full or refund_partial"
+	}
+	return ""
+}
+
+func RaiseDisputeHandler(c *gin.Context) {
+	var (
+		req         RaiseDisputeRequest
+		studentUUID = c.GetString("user_uuid")
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		logger.Error("error in binding dispute request: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a dispute reason is required"})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to raise dispute"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var (
+		sessionRepo = models.InitSessionRepo(tx)
+		disputeRepo = models.InitDisputeRepo(tx)
+	)
+
+	// The session lock orders this against the escrow release, which locks
+	// the session before checking for open disputes
+	session, err := sessionRepo.GetByUUIDForUpdate(c.Param("session_uuid"))
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": ErrSessionNotFound.Error()})
+			return
+		}
+		logger.Error("error in fetching session for dispute: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to raise dispute"})
+		return
+	}
+
+	if session.StudentUUID != studentUUID {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrNotSessionParticipant.Error()})
+		return
+	}
+
+	started := session.Status == models.SessionCompleted || session.Status == models.SessionExpertNoShow ||
+		(session.Status == models.SessionScheduled && session.StartTime.Before(time.Now()))
+	if !started || session.EarningsReleasedAt != nil || session.RefundedAt != nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "this session can no longer be disputed"})
+		return
+	}
+
+	open, err := disputeRepo.HasOpen(session.SessionUUID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in checking open disputes: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to raise dispute"})
+		return
+	}
+	if open {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": ErrSessionDisputed.Error()})
+		return
+	}
+
+	dispute := &models.Dispute{
+		SessionUUID: session.SessionUUID,
+		RaisedBy:    studentUUID,
+		Reason:      strings.TrimSpace(req.Reason),
+		Status:      string(models.DisputeOpen),
+	}
+	if err := disputeRepo.Create(dispute); err != nil {
+		tx.Rollback()
+		logger.Error("error in creating dispute: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to raise dispute"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing dispute: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to raise dispute"})
+		return
+	}
+
+	logger.Infof("dispute %d opened on session %s", dispute.ID, session.SessionUUID)
+	c.JSON(http.StatusCreated, dispute)
+}
+
+func ListDisputesHandler(c *gin.Context) {
+	disputeRepo := models.InitDisputeRepo(config.DB)
+
+	status := models.DisputeStatus(c.DefaultQuery("status", string(models.DisputeOpen)))
+	disputes, err := disputeRepo.ListByStatus(status)
+	if err != nil {
+		logger.Error("error in listing disputes: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, disputes)
+}
+
+func ResolveDisputeHandler(c *gin.Context) {
+	var req ResolveDisputeRequest
+
+	id, err := strconv.ParseUint(c.Param("dispute_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Resolution) == "" {
+		logger.Error("error in binding dispute resolution: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a resolution and an outcome are required"})
+		return
+	}
+
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	dispute, err := resolveDispute(uint(id), c.GetString("user_uuid"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Open dispute not found"})
+		case errors.Is(err, ErrPartialCreditRefund):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			logger.Error("error in resolving dispute: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dispute)
+}
+
+// resolveDispute closes an open dispute and settles its session by the
+// outcome. It returns gorm.ErrRecordNotFound when the dispute is not open.
+func resolveDispute(id uint, resolvedBy string, req ResolveDisputeRequest) (*models.Dispute, error) {
+	var (
+		tx          = config.DB.Begin()
+		sessionRepo = models.InitSessionRepo(tx)
+		disputeRepo = models.InitDisputeRepo(tx)
+		outcome     = models.DisputeOutcome(req.Outcome)
+		now         = time.Now()
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	dispute, err := disputeRepo.GetByID(id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// The session lock orders this against the escrow release and against
+	// a cancellation or a second resolution refunding the same session
+	session, err := sessionRepo.GetByUUIDForUpdate(dispute.SessionUUID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	refundPercent := req.RefundPercent
+	if outcome == models.DisputeRefundFull {
+		refundPercent = 100
+	}
+
+	if outcome == models.DisputeRefundPartial && session.CreditID != nil {
+		tx.Rollback()
+		return nil, ErrPartialCreditRefund
+	}
+
+	err = disputeRepo.Resolve(id, resolvedBy, strings.TrimSpace(req.Resolution), outcome, req.RefundPercent)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var refund *sessionRefund
+	if refundPercent > 0 {
+		refund, err = refundSessionWithTx(tx, session, refundPercent, false, "dispute")
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if err := sessionRepo.MarkRefunded(session.SessionUUID, now); err != nil {
+			tx.Rollback()
+			logger.Error("error in marking disputed session refunded: ", err)
+			return nil, err
+		}
+	}
+
+	// The admin found the expert did take the session after all, so what
+	// is left of the earnings is released like any completed session's
+	if session.Status == models.SessionExpertNoShow && outcome != models.DisputeRefundFull {
+		if err := sessionRepo.UpdateStatus(session.SessionUUID, models.SessionCompleted); err != nil {
+			tx.Rollback()
+			logger.Error("error in completing disputed session: ", err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	if refund != nil && refund.GatewayAmount > 0 {
+		if err := issuePendingRefund(refund.OrderID); err != nil {
+			logger.Errorf("refund of disputed session %s is pending: %v", session.SessionUUID, err)
+		}
+	}
+
+	logger.Infof("dispute %d on session %s resolved: %s (refund %d%%)", id, session.SessionUUID, outcome, refundPercent)
+
+	return models.InitDisputeRepo(config.DB).GetByID(id)
+}
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+// Booking paid → expert share held in escrow (Wallet.PendingBalanceInPaise, "hold")
+//    ↓
+// Session ends → marked completed if the expert joined it, otherwise an
+//                expert no-show whose earnings stay held (escrow job)
+//                and are voided to refund the student once the dispute
+//                window passes (no-show refund job)
+//    ↓
+// EscrowReleaseDelay passes with no open dispute
+//    ↓
+// BEGIN TX
+//    ├─ Lock session (completed, not yet released)
+//    ├─ Move held amount pending → available ("release")
+//    ├─ Stamp session.EarningsReleasedAt
+// COMMIT
+//
+// A session cancelled before release has the refunded part of its hold
+// voided instead ("void"), so refunds never touch money the expert can withdraw.
+
+var ErrSessionDisputed = errors.New("session has an open dispute")
+
+// escrowReleaseBatchSize bounds how many sessions one job run releases or
+// refunds.
+const escrowReleaseBatchSize = 100
+
+// heldAmount is what is still in escrow for referenceID in the wallet:
+// holds, less anything voided or already released.
+func heldAmount(entries []models.WalletTransaction, walletID uint) int64 {
+	var held int64
+	for _, entry := range entries {
+		if entry.WalletID != walletID {
+			continue
+		}
+		switch entry.Type {
+		case "hold":
+			held += entry.AmountInPaise
+		case "void", "release":
+			held -= entry.AmountInPaise
+		}
+	}
+	return held
+}
+
+// ReleaseSessionEarnings moves the expert's escrowed earnings for a completed
+// session to the available balance. Releasing twice is a no-op.
+func ReleaseSessionEarnings(sessionUUID string) (int64, error) {
+	var (
+		tx          = config.DB.Begin()
+		sessionRepo = models.InitSessionRepo(tx)
+		disputeRepo = models.InitDisputeRepo(tx)
+		walletRepo  = models.InitWalletRepo(tx)
+		wtRepo      = models.InitWalletTransactionRepo(tx)
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return 0, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The row lock keeps two job runs from releasing the same session
+	session, err := sessionRepo.GetByUUIDForUpdate(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrSessionNotFound
+		}
+		return 0, err
+	}
+
+	if session.EarningsReleasedAt != nil {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	if session.Status != models.SessionCompleted {
+		tx.Rollback()
+		return 0, fmt.Errorf("session %s is %s, not completed", sessionUUID, session.Status)
+	}
+
+	disputed, err := disputeRepo.HasOpen(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if disputed {
+		tx.Rollback()
+		return 0, ErrSessionDisputed
+	}
+
+	var released int64
+	wallet, err := walletRepo.GetByUserUUID(session.ExpertUUID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Nothing was ever held for this expert
+	case err != nil:
+		tx.Rollback()
+		return 0, err
+	default:
+		entries, err := wtRepo.GetByReferenceID(sessionUUID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		released = heldAmount(entries, wallet.ID)
+		err = releaseWalletFunds(tx, session.ExpertUUID, released, sessionUUID, "Session earnings released from escrow")
+		if err != nil {
+			tx.Rollback()
+			logger.Error("error in releasing escrowed earnings: ", err)
+			return 0, err
+		}
+	}
+
+	if err := sessionRepo.MarkEarningsReleased(sessionUUID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	logger.Infof("released %d paise of escrowed earnings for session %s", released, sessionUUID)
+	return released, nil
+}
+
+// ReleaseDueEarnings settles sessions that have ended and releases the
+// escrow of every completed session whose dispute window has passed.
+// It returns how many sessions were released.
+func ReleaseDueEarnings(now time.Time) (int, error) {
+	sessionRepo := models.InitSessionRepo(config.DB)
+
+	completed, noShows, err := sessionRepo.CompleteEnded(now)
+	if err != nil {
+		logger.Error("error in completing ended sessions: ", err)
+		return 0, err
+	}
+	if completed > 0 || noShows > 0 {
+		logger.Infof("marked %d ended sessions completed, %d expert no-shows", completed, noShows)
+	}
+
+	sessions, err := sessionRepo.GetReleasable(now.Add(-config.RuntimeConfig().EscrowReleaseDelay), escrowReleaseBatchSize)
+	if err != nil {
+		logger.Error("error in fetching sessions to release: ", err)
+		return 0, err
+	}
+
+	released := 0
+	for _, session := range sessions {
+		if _, err := ReleaseSessionEarnings(session.SessionUUID); err != nil {
+			// A dispute opened since the query is expected; anything else is
+			// logged and retried on the next run
+			if !errors.Is(err, ErrSessionDisputed) {
+				logger.Errorf("error in releasing earnings for session %s: %v", session.SessionUUID, err)
+			}
+			continue
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+// RefundExpertNoShows refunds the students of expert no-shows whose dispute
+// window has passed without an open dispute. A dispute keeps the session
+// for the admin to settle. It returns how many sessions were refunded.
+func RefundExpertNoShows(now time.Time) (int, error) {
+	sessions, err := models.InitSessionRepo(config.DB).
+		GetNoShowsToRefund(now.Add(-config.RuntimeConfig().EscrowReleaseDelay), escrowReleaseBatchSize)
+	if err != nil {
+		logger.Error("error in fetching expert no-shows to refund: ", err)
+		return 0, err
+	}
+
+	refunded := 0
+	for _, session := range sessions {
+		if err := refundExpertNoShow(session.SessionUUID); err != nil {
+			if !errors.Is(err, ErrSessionDisputed) {
+				logger.Errorf("error in refunding expert no-show %s: %v", session.SessionUUID, err)
+			}
+			continue
+		}
+		refunded++
+	}
+
+	return refunded, nil
+}
+
+// refundExpertNoShow voids the expert's escrowed earnings for a session they
+// never joined and refunds the student in full.
+func refundExpertNoShow(sessionUUID string) error {
+	var (
+		tx          = config.DB.Begin()
+		sessionRepo = models.InitSessionRepo(tx)
+		disputeRepo = models.InitDisputeRepo(tx)
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	session, err := sessionRepo.GetByUUIDForUpdate(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if session.Status != models.SessionExpertNoShow || session.RefundedAt != nil {
+		tx.Rollback()
+		return nil
+	}
+
+	disputed, err := disputeRepo.HasOpen(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if disputed {
+		tx.Rollback()
+		return ErrSessionDisputed
+	}
+
+	refund, err := refundSessionWithTx(tx, session, 100, false, "expert no-show")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := sessionRepo.MarkRefunded(sessionUUID, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	if refund.GatewayAmount > 0 {
+		if err := issuePendingRefund(refund.OrderID); err != nil {
+			logger.Errorf("refund of expert no-show %s is pending: %v", sessionUUID, err)
+		}
+	}
+
+	logger.Infof("refunded expert no-show %s (%d paise, %d to wallet, credit restored=%t)",
+		sessionUUID, refund.GatewayAmount+refund.WalletAmount, refund.WalletAmount, refund.CreditRestored)
+	return nil
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"interviewexcel-backend-go/config"
 	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/utils"
 	"net/http"
 	"strings"
 	"time"
@@ -24,13 +25,19 @@ func GetExpertBookingsHandler(c *gin.Context) {
 
 	expertID := expertIDInterface.(uint)
 
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	slots, err := availabilityRepo.GetBookedSlotsByExpert(expertID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch bookings"})
 		return
 	}
 
-	c.JSON(http.StatusOK, slots)
+	c.JSON(http.StatusOK, slotsIn(slots, loc))
 }
 
 func GetExpertProfile(c *gin.Context) {
@@ -74,6 +81,7 @@ func GetExpertProfile(c *gin.Context) {
 		Picture:  userResp.Picture,
 		Phone:    userResp.Phone,
 		Role:     userResp.Role,
+		TimeZone: utils.LoadLocation(userResp.TimeZone).String(),
 
 		Bio:                expertResp.Bio,
 		DOB:                expertResp.DOB,
@@ -90,6 +98,9 @@ func GetExpertProfile(c *gin.Context) {
 		Specializations:    expertResp.Specializations,
 		VerificationStatus: expertResp.VerificationStatus, // if present
 		StudentMentored:    expertResp.StudentMentored,
+
+		CancellationCount:   expertResp.CancellationCount,
+		CancellationFlagged: expertResp.CancellationFlagged,
 	}
 
 	c.JSON(http.StatusOK, profile)
@@ -119,6 +130,11 @@ func UpdateExpertProfile(c *gin.Context) {
 		return
 	}
 
+	if request.TimeZone != "" && !utils.ValidTimeZone(request.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time_zone must be an IANA time zone such as Asia/Kolkata"})
+		return
+	}
+
 	tx := config.DB.Begin()
 	if tx.Error != nil {
 		logger.Errorf("failed to start transaction: %v", tx.Error)
@@ -149,6 +165,7 @@ func UpdateExpertProfile(c *gin.Context) {
 	if err := userRepo.UpdateByUserUUID(uuid, &models.User{
 		FullName: request.FullName,
 		Phone:    request.Phone,
+		TimeZone: request.TimeZone,
 	}); err != nil {
 		tx.Rollback()
 		logger.Errorf("failed to update user profile (user_uuid=%s): %v", uuid, err)
@@ -166,10 +183,7 @@ func UpdateExpertProfile(c *gin.Context) {
 }
 
 func GenerateWeeklyAvailability(c *gin.Context) {
-	var (
-		req              AvailabilityRequest
-		availabilityRepo = models.InitAvailabilitySlotRepo(config.DB)
-	)
+	var req AvailabilityRequest
 
 	// Bind request
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -178,8 +192,12 @@ func GenerateWeeklyAvailability(c *gin.Context) {
 		return
 	}
 
+	// Start and end times are wall-clock times in the expert's zone
+	loc := utils.UserLocation(config.DB, req.ExpertID)
+
 	// Find Monday of current week
-	weekStart := time.Now()
+	now := time.Now()
+	weekStart := now.In(loc)
 	for weekStart.Weekday() != time.Monday {
 		weekStart = weekStart.AddDate(0, 0, -1)
 	}
@@ -197,7 +215,6 @@ func GenerateWeeklyAvailability(c *gin.Context) {
 		if !daySet[strings.ToLower(currentDay.Weekday().String())] {
 			continue
 		}
-		logger.Info("here gef")
 		// Parse clock times
 		startClock, err := time.Parse("15:04", req.Start)
 		if err != nil {
@@ -213,15 +230,6 @@ func GenerateWeeklyAvailability(c *gin.Context) {
 			return
 		}
 
-		// Merge with current day’s date
-		start := time.Date(
-			currentDay.Year(), currentDay.Month(), currentDay.Day(),
-			startClock.Hour(), startClock.Minute(), 0, 0, time.Local,
-		)
-		end := time.Date(
-			currentDay.Year(), currentDay.Month(), currentDay.Day(),
-			endClock.Hour(), endClock.Minute(), 0, 0, time.Local,
-		)
 		if req.SlotSize <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "slot size must be greater than 0"})
 			return
@@ -229,17 +237,12 @@ func GenerateWeeklyAvailability(c *gin.Context) {
 
 		duration := time.Minute * time.Duration(req.SlotSize)
 
-		for t := start; t.Add(duration).Before(end) || t.Add(duration).Equal(end); t = t.Add(duration) {
-			slot := models.AvailabilitySlot{
-				ExpertID:  (req.ExpertID),
-				Date:      currentDay,
-				StartTime: t,
-				EndTime:   t.Add(duration),
-				Status:    string(models.SlotAvailable),
+		// Days of the week that are already over get no slots
+		for _, slot := range slotsForDay(req.ExpertID, currentDay, startClock, endClock, duration, loc) {
+			if slot.StartTime.After(now) {
+				slots = append(slots, slot)
 			}
-			slots = append(slots, slot)
 		}
-
 	}
 
 	// Save slots
@@ -249,12 +252,56 @@ func GenerateWeeklyAvailability(c *gin.Context) {
 		return
 	}
 
-	if err := availabilityRepo.CreateAvailabilitySlot(slots); err != nil {
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Slots that overlap one the expert already has are reported, not created
+	created, placements, err := placeSlotsWithTx(tx, req.ExpertID, slots, false)
+	if err != nil {
+		tx.Rollback()
 		logger.Error("error in generating slots", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"slots": slots})
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing generated slots: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	var duplicates, conflicts, blackedOut int
+	for i := range placements {
+		placements[i].StartTime = placements[i].StartTime.In(loc)
+		placements[i].EndTime = placements[i].EndTime.In(loc)
+		switch placements[i].Result {
+		case SlotPlacementDuplicate:
+			duplicates++
+		case SlotPlacementConflict:
+			conflicts++
+		case SlotPlacementBlackout:
+			blackedOut++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"slots":      slotsIn(created, loc),
+		"placements": placements,
+		"created":    len(created),
+		"duplicates": duplicates,
+		"conflicts":  conflicts,
+		"blackout":   blackedOut,
+	})
 }
 
 type GetSlotsOfMerhantRequest struct {
@@ -281,6 +328,12 @@ func GetAllSlotsOfExpert(c *gin.Context) {
 		return
 	}
 
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	availableSlots, err := availabilityRepo.GetAllByExpert(uuid)
 	if err != nil {
 		logger.Error("Error in getting the available slots: ", err)
@@ -288,7 +341,7 @@ func GetAllSlotsOfExpert(c *gin.Context) {
 			"error": err,
 		})
 	}
-	c.JSON(http.StatusOK, availableSlots)
+	c.JSON(http.StatusOK, slotsIn(availableSlots, loc))
 }
 
 func CancelSlotOfExpert(c *gin.Context) {
@@ -318,7 +371,14 @@ func CancelSlotOfExpert(c *gin.Context) {
 	if slot.Status == string(models.SlotBooked) {
 		logger.Warnf("attempt to cancel booked slot (slot_id=%d)", slot.ID)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Booked slot cannot be cancelled",
+			"error": "Booked slot cannot be cancelled here; cancel its session instead",
+		})
+		return
+	}
+
+	if slot.Status == string(models.SlotHeld) && !slot.HoldExpired(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Slot is on hold for a student's checkout",
 		})
 		return
 	}
@@ -386,11 +446,21 @@ func GetExpertDashboard(c *gin.Context) {
 		profilePic = user.Picture
 	}
 
-	// 4. Fetch wallet for earnings
-	var earningsInPaise int64
+	loc := utils.LoadLocation(user.TimeZone)
+	if tz := c.Query("tz"); tz != "" {
+		if !utils.ValidTimeZone(tz) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidTimeZone.Error()})
+			return
+		}
+		loc = utils.LoadLocation(tz)
+	}
+
+	// 4. Fetch wallet for earnings (escrowed and available)
+	var pendingInPaise, availableInPaise int64
 	wallet, err := walletRepo.GetByUserUUID(uuid)
 	if err == nil && wallet != nil {
-		earningsInPaise = wallet.BalanceInPaise
+		pendingInPaise = wallet.PendingBalanceInPaise
+		availableInPaise = wallet.BalanceInPaise
 	}
 
 	// 5. Fetch upcoming sessions
@@ -414,9 +484,8 @@ func GetExpertDashboard(c *gin.Context) {
 			SessionUUID: session.SessionUUID,
 			StudentUUID: session.StudentUUID,
 			StudentName: studentName,
-			StartTime:   session.StartTime,
-			EndTime:     session.EndTime,
-			MeetLink:    session.MeetLink,
+			StartTime:   session.StartTime.In(loc),
+			EndTime:     session.EndTime.In(loc),
 			Status:      session.Status,
 		})
 	}
@@ -447,10 +516,12 @@ func GetExpertDashboard(c *gin.Context) {
 			ProfilePictureUrl:  profilePic,
 		},
 		Stats: DashboardStats{
-			TotalSessions:    expert.TotalSessions,
-			StudentsMentored: expert.StudentMentored,
-			Rating:           expert.Rating,
-			Earnings:         earningsInPaise,
+			TotalSessions:     expert.TotalSessions,
+			StudentsMentored:  expert.StudentMentored,
+			Rating:            expert.Rating,
+			Earnings:          pendingInPaise + availableInPaise,
+			PendingEarnings:   pendingInPaise,
+			AvailableEarnings: availableInPaise,
 		},
 		UpcomingSessions: upcomingSessions,
 		SlotOverview: DashboardSlotOverview{
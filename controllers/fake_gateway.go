@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/pkg/payments"
+	"net/http"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Local stand-in for Razorpay Checkout, only routed when PAYMENT_PROVIDER=fake.
+//
+// POST /dev/payments/orders/:order_id/succeed → fields for /student/confirm-booking
+// POST /dev/payments/orders/:order_id/fail    → failed attempt
+// POST /dev/payments/:payment_id/webhook      → signed body + headers for /webhooks/razorpay
+//
+// Only routed when PAYOUT_PROVIDER=fake; the payout-sync job picks the result up:
+// POST /dev/payouts/:provider_payout_id/paid
+// POST /dev/payouts/:provider_payout_id/fail
+
+type FakeCheckoutRequest struct {
+	Method string `json:"method"` // upi (default), card, ...
+}
+
+type FakeWebhookRequest struct {
+	Event string `json:"event" binding:"required"`
+}
+
+func fakeGateway(c *gin.Context) (*payments.FakeProvider, bool) {
+	fake, ok := config.Payments.(*payments.FakeProvider)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "fake payment provider is not enabled"})
+	}
+	return fake, ok
+}
+
+func FakePaymentSuccessHandler(c *gin.Context) {
+	var req FakeCheckoutRequest
+
+	fake, ok := fakeGateway(c)
+	if !ok {
+		return
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	orderID := c.Param("order_id")
+	paymentID, signature, err := fake.SimulatePaymentSuccess(orderID, req.Method)
+	if err != nil {
+		logger.Error("error in simulating payment: ", err)
+		respondFakeGatewayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"razorpay_order_id":   orderID,
+		"razorpay_payment_id": paymentID,
+		"razorpay_signature":  signature,
+	})
+}
+
+func FakePaymentFailureHandler(c *gin.Context) {
+	var req FakeCheckoutRequest
+
+	fake, ok := fakeGateway(c)
+	if !ok {
+		return
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	orderID := c.Param("order_id")
+	paymentID, err := fake.SimulatePaymentFailure(orderID, req.Method)
+	if err != nil {
+		logger.Error("error in simulating failed payment: ", err)
+		respondFakeGatewayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"razorpay_order_id":   orderID,
+		"razorpay_payment_id": paymentID,
+	})
+}
+
+func FakeWebhookHandler(c *gin.Context) {
+	var req FakeWebhookRequest
+
+	fake, ok := fakeGateway(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := fake.SimulateWebhook(req.Event, c.Param("payment_id"))
+	if err != nil {
+		logger.Error("error in simulating webhook: ", err)
+		respondFakeGatewayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"headers": gin.H{
+			"X-Razorpay-Event-Id":  webhook.EventID,
+			"X-Razorpay-Signature": webhook.Signature,
+		},
+		"body": string(webhook.Body),
+	})
+}
+
+type FakePayoutFailureRequest struct {
+	Reason string `json:"reason"`
+}
+
+func fakePayouts(c *gin.Context) (*payments.FakePayoutProvider, bool) {
+	fake, ok := config.Payouts.(*payments.FakePayoutProvider)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "fake payout provider is not enabled"})
+	}
+	return fake, ok
+}
+
+func FakePayoutPaidHandler(c *gin.Context) {
+	fake, ok := fakePayouts(c)
+	if !ok {
+		return
+	}
+
+	if err := fake.SimulatePayoutPaid(c.Param("provider_payout_id")); err != nil {
+		logger.Error("error in simulating payout: ", err)
+		respondFakeGatewayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": payments.PayoutPaid})
+}
+
+func FakePayoutFailedHandler(c *gin.Context) {
+	var req FakePayoutFailureRequest
+
+	fake, ok := fakePayouts(c)
+	if !ok {
+		return
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	if req.Reason == "" {
+		req.Reason = "simulated failure"
+	}
+
+	if err := fake.SimulatePayoutFailed(c.Param("provider_payout_id"), req.Reason); err != nil {
+		logger.Error("error in simulating failed payout: ", err)
+		respondFakeGatewayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": payments.PayoutFailed})
+}
+
+func respondFakeGatewayError(c *gin.Context, err error) {
+	if errors.Is(err, payments.ErrOrderNotFound) || errors.Is(err, payments.ErrPaymentNotFound) ||
+		errors.Is(err, payments.ErrPayoutNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPaymentNotPaid      = errors.New("payment has not been paid")
+	ErrPaymentNotFulfilled = errors.New("payment was refunded because what it paid for could not be had")
+)
+
+// gstBreakdown splits the platform fee, which is charged inclusive of GST,
+// into its taxable value and tax. Within the supplier's state the tax is
+// shared equally between CGST and SGST (any odd paisa goes to SGST);
+// otherwise it is all IGST.
+func gstBreakdown(platformFee int64, ratePercent int, intraState bool) (taxable, cgst, sgst, igst int64) {
+	if ratePercent <= 0 {
+		return platformFee, 0, 0, 0
+	}
+
+	// Round the taxable value to the nearest paisa
+	taxable = (platformFee*100*2 + int64(100+ratePercent)) / (int64(100+ratePercent) * 2)
+	tax := platformFee - taxable
+
+	if intraState {
+		cgst = tax / 2
+		return taxable, cgst, tax - cgst, 0
+	}
+	return taxable, 0, 0, tax
+}
+
+// sameState reports whether two free-text state names refer to the same state.
+func sameState(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// issueInvoiceWithTx creates the invoice for a paid payment, reserving its
+// number in the same transaction. It returns the existing invoice when the
+// payment already has one, so callers need not check first.
+func issueInvoiceWithTx(tx *gorm.DB, payment *models.Payment, sessionUUID string) (*models.Invoice, error) {
+	var (
+		invoiceRepo = models.InitInvoiceRepo(tx)
+		studentRepo = models.InitStudentRepo(tx)
+		userRepo    = models.InitUserRepo(tx)
+		expertRepo  = models.InitExpertRepo(tx)
+		cfg         = config.RuntimeConfig()
+	)
+
+	existing, err := invoiceRepo.GetByPaymentID(payment.ID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	student, err := studentRepo.GetByID(payment.StudentID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching student %d: %w", payment.StudentID, err)
+	}
+
+	user, err := userRepo.GetByUUID(student.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching user %s: %w", student.UserID, err)
+	}
+
+	// Package purchases and subscriptions are not tied to an expert
+	expertUUID, description := "", ""
+	switch payment.Purpose {
+	case models.PaymentForPackage:
+		purchase, err := models.InitPackageRepo(tx).GetPurchaseByOrderIDForUpdate(tx, payment.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("fetching package purchase for order %s: %w", payment.OrderID, err)
+		}
+		description = fmt.Sprintf("Session package: %s (%d sessions)", purchase.Name, purchase.SessionCount)
+	case models.PaymentForSubscription, models.PaymentForRenewal:
+		description, err = subscriptionInvoiceDescription(tx, payment.OrderID)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		expert, err := expertRepo.GetWithTx(tx, &models.Expert{ID: payment.ExpertID})
+		if err != nil {
+			return nil, fmt.Errorf("fetching expert %d: %w", payment.ExpertID, err)
+		}
+		expertUUID = expert.UserID
+	}
+
+	issuedAt := time.Now()
+	if payment.PaidAt != nil {
+		issuedAt = *payment.PaidAt
+	}
+	financialYear := models.FinancialYear(issuedAt)
+
+	sequence, err := invoiceRepo.NextSequence(financialYear)
+	if err != nil {
+		return nil, fmt.Errorf("reserving invoice number: %w", err)
+	}
+
+	// An unknown place of supply is treated as the supplier's own state
+	intraState := student.State == "" || sameState(student.State, cfg.InvoiceSupplierState)
+	taxable, cgst, sgst, igst := gstBreakdown(int64(payment.PlatformFee), cfg.GSTRatePercent, intraState)
+
+	invoice := &models.Invoice{
+		InvoiceNumber: fmt.Sprintf("%s/%s/%06d", cfg.InvoicePrefix, financialYear, sequence),
+		FinancialYear: financialYear,
+		Sequence:      sequence,
+		IssuedAt:      issuedAt,
+
+		PaymentID:   payment.ID,
+		OrderID:     payment.OrderID,
+		StudentUUID: student.UserID,
+		ExpertUUID:  expertUUID,
+		SessionUUID: sessionUUID,
+
+		BilledName:  user.FullName,
+		BilledEmail: user.Email,
+		BilledState: student.State,
+
+		SupplierName:    cfg.InvoiceSupplierName,
+		SupplierAddress: cfg.InvoiceSupplierAddress,
+		SupplierGSTIN:   cfg.InvoiceSupplierGSTIN,
+		SupplierState:   cfg.InvoiceSupplierState,
+
+		Description:        description,
+		Currency:           payment.Currency,
+		BaseFeeInPaise:     int64(payment.ExpertShare),
+		PlatformFeeInPaise: taxable,
+		GSTRatePercent:     cfg.GSTRatePercent,
+		CGSTInPaise:        cgst,
+		SGSTInPaise:        sgst,
+		IGSTInPaise:        igst,
+		TotalInPaise:       int64(payment.Amount + payment.WalletAmount),
+	}
+
+	if err := invoiceRepo.Create(invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// unfulfilled tells whether the payment was refunded in full because what
+// it paid for could not be had. Nothing was sold, so it gets no invoice.
+func unfulfilled(payment *models.Payment) bool {
+	return payment.Status == string(models.PaymentRefunded) && payment.RefundReason != ""
+}
+
+// invoiceForPayment returns the payment's invoice, issuing it now for
+// payments that were paid before invoices existed.
+func invoiceForPayment(payment *models.Payment) (*models.Invoice, error) {
+	if unfulfilled(payment) {
+		return nil, ErrPaymentNotFulfilled
+	}
+
+	invoice, err := models.InitInvoiceRepo(config.DB).GetByOrderID(payment.OrderID)
+	if err == nil {
+		return invoice, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the payment so concurrent downloads issue a single invoice
+	locked, err := models.InitPaymentRepo(tx).GetByOrderIDForUpdate(tx, payment.OrderID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	sessionUUID := ""
+	if session, err := models.InitSessionRepo(tx).GetByOrderID(locked.OrderID); err == nil {
+		sessionUUID = session.SessionUUID
+	}
+
+	invoice, err = issueInvoiceWithTx(tx, locked, sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// GetPaymentInvoiceHandler serves the tax invoice for one of the student's
+// payments, as a PDF by default or as HTML with ?format=html.
+func GetPaymentInvoiceHandler(c *gin.Context) {
+	var (
+		paymentRepo = models.InitPaymentRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
+		orderID     = c.Param("order_id")
+		format      = c.DefaultQuery("format", "pdf")
+	)
+
+	if format != "pdf" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or html"})
+		return
+	}
+
+	student, err := studentRepo.GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		logger.Error("error in fetching student for invoice: ", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	payment, err := paymentRepo.GetByOrderID(orderID)
+	if err != nil || payment.StudentID != student.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	if payment.PaidAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrPaymentNotPaid.Error()})
+		return
+	}
+
+	if unfulfilled(payment) {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrPaymentNotFulfilled.Error()})
+		return
+	}
+
+	invoice, err := invoiceForPayment(payment)
+	if err != nil {
+		logger.Errorf("error in issuing invoice for order %s: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	filename := strings.ReplaceAll(invoice.InvoiceNumber, "/", "-")
+
+	if format == "html" {
+		body, err := renderInvoiceHTML(invoice)
+		if err != nil {
+			logger.Error("error in rendering invoice html: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", body)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, filename))
+	c.Data(http.StatusOK, "application/pdf", renderInvoicePDF(invoice))
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/pkg/pdf"
+)
+
+// invoiceLine is one row of the amounts table, shared by the HTML and PDF
+// renderings so both always show the same breakdown.
+type invoiceLine struct {
+	Label  string
+	Amount string
+}
+
+func invoiceLines(invoice *models.Invoice) []invoiceLine {
+	description := invoice.Description
+	if description == "" {
+		description = "Mock interview session fee"
+	}
+
+	lines := []invoiceLine{
+		{description, rupees(invoice.BaseFeeInPaise)},
+		{"Platform fee (taxable value)", rupees(invoice.PlatformFeeInPaise)},
+	}
+
+	if invoice.IGSTInPaise > 0 {
+		lines = append(lines, invoiceLine{fmt.Sprintf("IGST @ %d%%", invoice.GSTRatePercent), rupees(invoice.IGSTInPaise)})
+	} else {
+		half := float64(invoice.GSTRatePercent) / 2
+		lines = append(lines,
+			invoiceLine{fmt.Sprintf("CGST @ %g%%", half), rupees(invoice.CGSTInPaise)},
+			invoiceLine{fmt.Sprintf("SGST @ %g%%", half), rupees(invoice.SGSTInPaise)},
+		)
+	}
+	return lines
+}
+
+var invoiceHTMLTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Tax Invoice {{.Invoice.InvoiceNumber}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 720px; margin: 40px auto; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+.muted { color: #666; font-size: 13px; }
+.parties { display: flex; justify-content: space-between; margin: 24px 0; }
+table { width: 100%; border-collapse: collapse; }
+td, th { padding: 8px 0; border-bottom: 1px solid #ddd; text-align: left; }
+td.amount, th.amount { text-align: right; }
+tr.total td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>Tax Invoice</h1>
+<div class="muted">Invoice {{.Invoice.InvoiceNumber}} &middot; {{.IssuedOn}} &middot; Order {{.Invoice.OrderID}}</div>
+<div class="parties">
+  <div>
+    <strong>{{.Invoice.SupplierName}}</strong><br>
+    {{with .Invoice.SupplierAddress}}{{.}}<br>{{end}}
+    State: {{.Invoice.SupplierState}}<br>
+    {{with .Invoice.SupplierGSTIN}}GSTIN: {{.}}{{end}}
+  </div>
+  <div>
+    <strong>Billed to</strong><br>
+    {{.Invoice.BilledName}}<br>
+    {{.Invoice.BilledEmail}}<br>
+    Place of supply: {{.PlaceOfSupply}}
+  </div>
+</div>
+<table>
+  <tr><th>Description</th><th class="amount">Amount ({{.Invoice.Currency}})</th></tr>
+  {{range .Lines}}<tr><td>{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+  {{end}}<tr class="total"><td>Total paid</td><td class="amount">{{.Total}}</td></tr>
+</table>
+{{with .Invoice.SessionUUID}}<p class="muted">Session {{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+func placeOfSupply(invoice *models.Invoice) string {
+	if invoice.BilledState != "" {
+		return invoice.BilledState
+	}
+	return invoice.SupplierState
+}
+
+func renderInvoiceHTML(invoice *models.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	err := invoiceHTMLTemplate.Execute(&buf, map[string]interface{}{
+		"Invoice":       invoice,
+		"IssuedOn":      invoice.IssuedAt.Format("02 Jan 2006"),
+		"PlaceOfSupply": placeOfSupply(invoice),
+		"Lines":         invoiceLines(invoice),
+		"Total":         rupees(invoice.TotalInPaise),
+	})
+	return buf.Bytes(), err
+}
+
+func renderInvoicePDF(invoice *models.Invoice) []byte {
+	const (
+		left  = 50.0
+		right = pdf.PageWidth - 50
+	)
+
+	doc := pdf.New()
+	doc.Text(left, 70, 20, true, "Tax Invoice")
+	doc.Text(left, 90, 10, false, fmt.Sprintf("Invoice %s  |  %s  |  Order %s",
+		invoice.InvoiceNumber, invoice.IssuedAt.Format("02 Jan 2006"), invoice.OrderID))
+
+	// Supplier on the left, customer on the right
+	y := 130.0
+	doc.Text(left, y, 11, true, invoice.SupplierName)
+	doc.Text(320, y, 11, true, "Billed to")
+	var supplier []string
+	if invoice.SupplierAddress != "" {
+		supplier = append(supplier, invoice.SupplierAddress)
+	}
+	supplier = append(supplier, "State: "+invoice.SupplierState)
+	if invoice.SupplierGSTIN != "" {
+		supplier = append(supplier, "GSTIN: "+invoice.SupplierGSTIN)
+	}
+	customer := []string{invoice.BilledName, invoice.BilledEmail, "Place of supply: " + placeOfSupply(invoice)}
+	for i := 0; i < max(len(supplier), len(customer)); i++ {
+		y += 15
+		if i < len(supplier) {
+			doc.Text(left, y, 10, false, supplier[i])
+		}
+		if i < len(customer) {
+			doc.Text(320, y, 10, false, customer[i])
+		}
+	}
+
+	y += 40
+	doc.Text(left, y, 10, true, "Description")
+	doc.TextRight(right, y, 10, true, "Amount ("+invoice.Currency+")")
+	doc.Line(left, y+6, right, y+6)
+
+	for _, line := range invoiceLines(invoice) {
+		y += 22
+		doc.Text(left, y, 10, false, line.Label)
+		doc.TextRight(right, y, 10, false, line.Amount)
+	}
+
+	y += 12
+	doc.Line(left, y, right, y)
+	y += 18
+	doc.Text(left, y, 11, true, "Total paid")
+	doc.TextRight(right, y, 11, true, rupees(invoice.TotalInPaise))
+
+	if invoice.SessionUUID != "" {
+		doc.Text(left, y+40, 9, false, "Session "+invoice.SessionUUID)
+	}
+
+	return doc.Bytes()
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import "testing"
+
+func TestGSTBreakdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		platformFee int64
+		ratePercent int
+		intraState  bool
+		taxable     int64
+		cgst        int64
+		sgst        int64
+		igst        int64
+	}{
+		{"intra-state", 11800, 18, true, 10000, 900, 900, 0},
+		{"inter-state", 11800, 18, false, 10000, 0, 0, 1800},
+		{"odd paisa goes to SGST", 100, 18, true, 85, 7, 8, 0},
+		{"rounds taxable to nearest paisa", 1000, 18, false, 847, 0, 0, 153},
+		{"no GST", 500, 0, true, 500, 0, 0, 0},
+		{"zero fee", 0, 18, true, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxable, cgst, sgst, igst := gstBreakdown(tt.platformFee, tt.ratePercent, tt.intraState)
+			if taxable != tt.taxable || cgst != tt.cgst || sgst != tt.sgst || igst != tt.igst {
+				t.Errorf("gstBreakdown(%d, %d, %v) = %d, %d, %d, %d; want %d, %d, %d, %d",
+					tt.platformFee, tt.ratePercent, tt.intraState, taxable, cgst, sgst, igst,
+					tt.taxable, tt.cgst, tt.sgst, tt.igst)
+			}
+			if taxable+cgst+sgst+igst != tt.platformFee {
+				t.Errorf("parts add up to %d, want %d", taxable+cgst+sgst+igst, tt.platformFee)
+			}
+		})
+	}
+}
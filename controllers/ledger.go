@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+// Every change to a wallet balance goes through moveWalletFunds or
+// releaseWalletFunds, which in the caller's transaction
+//    ├─ update the stored balance with a SQL increment (never read-modify-write)
+//    ├─ record the user-facing WalletTransaction
+//    ├─ post a balanced double-entry LedgerTransaction
+//
+// so the stored balances can always be rebuilt from, and checked against,
+// the ledger (see CheckLedgerConsistency).
+
+// walletMovement moves money between one wallet balance and another ledger
+// account.
+type walletMovement struct {
+	UserUUID       string
+	Balance        string // models.LedgerBalanceAvailable or models.LedgerBalancePending
+	AmountInPaise  int64  // positive credits the wallet, negative debits it
+	CounterAccount string // ledger account on the other side
+	// RequireFunds makes a debit fail with ErrInsufficientBalance instead of
+	// taking the available balance below zero
+	RequireFunds bool
+
+	// WalletTransaction fields
+	Type        string
+	Source      string
+	ReferenceID string
+	Description string
+	ExpiresAt   *time.Time
+}
+
+func moveWalletFunds(tx *gorm.DB, m walletMovement) error {
+	var (
+		walletRepo = models.InitWalletRepo(tx)
+		wtRepo     = models.InitWalletTransactionRepo(tx)
+		ledgerRepo = models.InitLedgerRepo(tx)
+	)
+
+	if m.AmountInPaise == 0 {
+		return nil
+	}
+
+	wallet, err := walletRepo.GetOrCreate(m.UserUUID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case m.Balance == models.LedgerBalancePending:
+		err = walletRepo.IncrementPendingBalance(m.UserUUID, m.AmountInPaise)
+	case m.AmountInPaise < 0 && m.RequireFunds:
+		var debited bool
+		debited, err = walletRepo.DebitIfSufficient(m.UserUUID, -m.AmountInPaise)
+		if err == nil && !debited {
+			err = ErrInsufficientBalance
+		}
+	default:
+		err = walletRepo.IncrementBalance(m.UserUUID, m.AmountInPaise)
+	}
+	if err != nil {
+		return err
+	}
+
+	amount := m.AmountInPaise
+	if amount < 0 {
+		amount = -amount
+	}
+
+	err = wtRepo.Create(tx, &models.WalletTransaction{
+		WalletID:      wallet.ID,
+		AmountInPaise: amount,
+		Type:          m.Type,
+		Source:        m.Source,
+		ReferenceID:   m.ReferenceID,
+		Description:   m.Description,
+		ExpiresAt:     m.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ledgerRepo.Create(&models.LedgerTransaction{
+		Kind:        m.Type + ":" + m.Source,
+		ReferenceID: m.ReferenceID,
+		Description: m.Description,
+		Postings: []models.LedgerPosting{
+			{Account: models.WalletLedgerAccount(m.UserUUID, m.Balance), AmountInPaise: m.AmountInPaise},
+			{Account: m.CounterAccount, AmountInPaise: -m.AmountInPaise},
+		},
+	})
+}
+
+// creditWallet adds amount (in paise) to the user's available balance,
+// funded by counterAccount.
+func creditWallet(tx *gorm.DB, userUUID string, counterAccount string, amount int64, source string, referenceID string, description string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	return moveWalletFunds(tx, walletMovement{
+		UserUUID:       userUUID,
+		Balance:        models.LedgerBalanceAvailable,
+		AmountInPaise:  amount,
+		CounterAccount: counterAccount,
+		Type:           "credit",
+		Source:         source,
+		ReferenceID:    referenceID,
+		Description:    description,
+	})
+}
+
+// holdWallet adds amount (in paise) to the user's pending (escrowed)
+// balance, funded by counterAccount.
+func holdWallet(tx *gorm.DB, userUUID string, counterAccount string, amount int64, source string, referenceID string, description string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	return moveWalletFunds(tx, walletMovement{
+		UserUUID:       userUUID,
+		Balance:        models.LedgerBalancePending,
+		AmountInPaise:  amount,
+		CounterAccount: counterAccount,
+		Type:           "hold",
+		Source:         source,
+		ReferenceID:    referenceID,
+		Description:    description,
+	})
+}
+
+// releaseWalletFunds moves amount from the user's pending to their
+// available balance.
+func releaseWalletFunds(tx *gorm.DB, userUUID string, amount int64, referenceID string, description string) error {
+	var (
+		walletRepo = models.InitWalletRepo(tx)
+		wtRepo     = models.InitWalletTransactionRepo(tx)
+		ledgerRepo = models.InitLedgerRepo(tx)
+	)
+
+	if amount <= 0 {
+		return nil
+	}
+
+	wallet, err := walletRepo.GetOrCreate(userUUID)
+	if err != nil {
+		return err
+	}
+
+	if err := walletRepo.ReleasePending(userUUID, amount); err != nil {
+		return err
+	}
+
+	err = wtRepo.Create(tx, &models.WalletTransaction{
+		WalletID:      wallet.ID,
+		AmountInPaise: amount,
+		Type:          "release",
+		Source:        "session",
+		ReferenceID:   referenceID,
+		Description:   description,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ledgerRepo.Create(&models.LedgerTransaction{
+		Kind:        "release:session",
+		ReferenceID: referenceID,
+		Description: description,
+		Postings: []models.LedgerPosting{
+			{Account: models.WalletLedgerAccount(userUUID, models.LedgerBalancePending), AmountInPaise: -amount},
+			{Account: models.WalletLedgerAccount(userUUID, models.LedgerBalanceAvailable), AmountInPaise: amount},
+		},
+	})
+}
+
+// LedgerMismatch is a stored wallet balance that differs from its postings.
+type LedgerMismatch struct {
+	UserUUID string `json:"user_uuid"`
+	Balance  string `json:"balance"` // available | pending
+	Stored   int64  `json:"stored"`
+	Ledger   int64  `json:"ledger"`
+}
+
+type LedgerReport struct {
+	WalletsChecked int                       `json:"wallets_checked"`
+	Mismatches     []LedgerMismatch          `json:"mismatches"`
+	Unbalanced     []models.LedgerUnbalanced `json:"unbalanced"`
+	// Sum of every posting; non-zero means postings were written outside
+	// the ledger repo
+	Total int64 `json:"total"`
+	// Ledger accounts of wallets that do not exist
+	OrphanAccounts []string `json:"orphan_accounts"`
+}
+
+func (r *LedgerReport) Consistent() bool {
+	return len(r.Mismatches) == 0 && len(r.Unbalanced) == 0 && r.Total == 0 && len(r.OrphanAccounts) == 0
+}
+
+// CheckLedgerConsistency compares every stored wallet balance with the sum
+// of its ledger postings and verifies that every transaction balances.
+func CheckLedgerConsistency() (*LedgerReport, error) {
+	var (
+		walletRepo = models.InitWalletRepo(config.DB)
+		ledgerRepo = models.InitLedgerRepo(config.DB)
+		report     = &LedgerReport{}
+	)
+
+	wallets, err := walletRepo.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := ledgerRepo.AccountBalances()
+	if err != nil {
+		return nil, err
+	}
+
+	unbalanced, err := ledgerRepo.Unbalanced()
+	if err != nil {
+		return nil, err
+	}
+	report.Unbalanced = unbalanced
+
+	for _, total := range balances {
+		report.Total += total
+	}
+
+	known := map[string]bool{}
+	for _, wallet := range wallets {
+		report.WalletsChecked++
+
+		for _, check := range []struct {
+			balance string
+			stored  int64
+		}{
+			{models.LedgerBalanceAvailable, wallet.BalanceInPaise},
+			{models.LedgerBalancePending, wallet.PendingBalanceInPaise},
+		} {
+			account := models.WalletLedgerAccount(wallet.UserUUID, check.balance)
+			known[account] = true
+
+			if ledger := balances[account]; ledger != check.stored {
+				report.Mismatches = append(report.Mismatches, LedgerMismatch{
+					UserUUID: wallet.UserUUID,
+					Balance:  check.balance,
+					Stored:   check.stored,
+					Ledger:   ledger,
+				})
+			}
+		}
+	}
+
+	for account := range balances {
+		if _, _, ok := models.ParseWalletLedgerAccount(account); ok && !known[account] {
+			report.OrphanAccounts = append(report.OrphanAccounts, account)
+		}
+	}
+
+	return report, nil
+}
+
+// BackfillOpeningBalances posts an opening-balance transaction for every
+// wallet balance that has no ledger postings yet, so wallets that predate
+// the ledger can be checked. Balances already on the ledger are untouched.
+func BackfillOpeningBalances() (int, error) {
+	var (
+		walletRepo = models.InitWalletRepo(config.DB)
+		ledgerRepo = models.InitLedgerRepo(config.DB)
+	)
+
+	wallets, err := walletRepo.ListAll()
+	if err != nil {
+		return 0, err
+	}
+
+	balances, err := ledgerRepo.AccountBalances()
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for _, wallet := range wallets {
+		for _, opening := range []struct {
+			balance string
+			amount  int64
+		}{
+			{models.LedgerBalanceAvailable, wallet.BalanceInPaise},
+			{models.LedgerBalancePending, wallet.PendingBalanceInPaise},
+		} {
+			account := models.WalletLedgerAccount(wallet.UserUUID, opening.balance)
+			if _, onLedger := balances[account]; onLedger || opening.amount == 0 {
+				continue
+			}
+
+			err := ledgerRepo.Create(&models.LedgerTransaction{
+				Kind:        "opening",
+				ReferenceID: wallet.UserUUID,
+				Description: fmt.Sprintf("Opening %s balance", opening.balance),
+				Postings: []models.LedgerPosting{
+					{Account: account, AmountInPaise: opening.amount},
+					{Account: models.LedgerOpeningAccount, AmountInPaise: -opening.amount},
+				},
+			})
+			if err != nil {
+				if errors.Is(err, models.ErrUnbalancedLedgerTransaction) {
+					logger.Errorf("opening balance for %s is unbalanced", account)
+				}
+				return posted, err
+			}
+			posted++
+		}
+	}
+
+	return posted, nil
+}
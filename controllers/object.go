@@ -29,6 +29,7 @@ type StudentProfile struct {
 	Email    string `json:"email"`
 	Phone    string `json:"phone"`
 	FullName string `json:"full_name"`
+	TimeZone string `json:"time_zone"` // IANA name
 
 	Bio          string    `json:"bio,omitempty"`
 	Sessions     string    `json:"sessions"`
@@ -36,6 +37,7 @@ type StudentProfile struct {
 	PreparingFor string    `json:"preparing_for"`
 	DateOfBirth  time.Time `json:"dob"`
 	City         string    `json:"city"`
+	State        string    `json:"state"`
 	AboutMe      string    `json:"about_me"`
 	Skills       []string  `gorm:"type:json" json:"skills"` // JSON column for skills
 }
@@ -50,6 +52,7 @@ type ExpertProfile struct {
 	Phone    *string `json:"phone"`
 	Role     string  `json:"role"`
 	City     string  `json:"city"`
+	TimeZone string  `json:"time_zone"` // IANA name
 
 	// From Expert
 	Bio                string    `json:"bio"`
@@ -68,6 +71,9 @@ type ExpertProfile struct {
 	VerificationStatus string    `json:"verification_status"`
 	IsAvailable        bool      `json:"is_available"`
 	StudentMentored    int64     `json:"student_mentored"`
+
+	CancellationCount   int  `json:"cancellation_count"`
+	CancellationFlagged bool `json:"cancellation_flagged"`
 }
 
 type AvailabilityRequest struct {
@@ -94,7 +100,6 @@ type StudentSessionResponse struct {
 	ProfilePictureUrl string    `json:"profile_picture_url"`
 	StartTime         time.Time `json:"start_time"`
 	EndTime           time.Time `json:"end_time"`
-	MeetLink          string    `json:"meet_link,omitempty"`
 	Status            string    `json:"status"`
 }
 
@@ -115,10 +120,12 @@ type DashboardExpertInfo struct {
 }
 
 type DashboardStats struct {
-	TotalSessions    int     `json:"total_sessions"`
-	StudentsMentored int64   `json:"students_mentored"`
-	Rating           float64 `json:"rating"`
-	Earnings         int64   `json:"earnings"`
+	TotalSessions     int     `json:"total_sessions"`
+	StudentsMentored  int64   `json:"students_mentored"`
+	Rating            float64 `json:"rating"`
+	Earnings          int64   `json:"earnings"`           // pending + available, in paise
+	PendingEarnings   int64   `json:"pending_earnings"`   // in escrow until sessions complete
+	AvailableEarnings int64   `json:"available_earnings"` // withdrawable
 }
 
 type DashboardSlotOverview struct {
@@ -134,6 +141,5 @@ type ExpertSessionResponse struct {
 	StudentName string    `json:"student_name"`
 	StartTime   time.Time `json:"start_time"`
 	EndTime     time.Time `json:"end_time"`
-	MeetLink    string    `json:"meet_link,omitempty"`
 	Status      string    `json:"status"`
 }
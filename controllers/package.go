@@ -0,0 +1,689 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Student buys a package
+//    ↓
+// Gateway order for the package price, Payment (purpose "package") and a
+// pending StudentPackage
+//    ↓
+// Payment success (client confirm, webhook or reconcile)
+//    ↓
+// BEGIN TX
+//    ├─ Lock payment, mark paid
+//    ├─ Activate the purchase, one SessionCredit per session
+//    ├─ Ledger: gateway → prepaid session credits
+//    ├─ Invoice
+// COMMIT
+//
+// Booking with a credit skips the gateway: the credit's value is split like
+// a session fee and paid out of the prepaid pool into the expert's escrow
+// and the platform's commission. Credits left unspent at expiry are swept
+// out of the prepaid pool into expired credits.
+
+const sessionCreditExpiryBatchSize = 100
+
+var (
+	ErrPackageNotFound = errors.New("package not found")
+	ErrPackageInactive = errors.New("package is no longer on sale")
+	ErrNoUsableCredit  = errors.New("no unused session credit covers this expert and their fee")
+)
+
+type PackageOrderResponse struct {
+	Provider  string `json:"provider"` // razorpay, fake
+	OrderID   string `json:"order_id"`
+	PackageID uint   `json:"package_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Key       string `json:"key"`
+}
+
+// splitPackagePrice divides the price of a package between its credits.
+// Leftover paise go to the first credits so the values add up to the price.
+func splitPackagePrice(price int64, count int) []int64 {
+	values := make([]int64, count)
+	for i := range values {
+		values[i] = price / int64(count)
+		if int64(i) < price%int64(count) {
+			values[i]++
+		}
+	}
+	return values
+}
+
+// CreatePackageOrder opens a gateway order for a package and records the
+// pending purchase.
+func CreatePackageOrder(studentUUID string, packageID uint) (*PackageOrderResponse, error) {
+	var (
+		packageRepo = models.InitPackageRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
+	)
+
+	pkg, err := packageRepo.GetByID(packageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPackageNotFound
+		}
+		return nil, err
+	}
+	if !pkg.Active {
+		return nil, ErrPackageInactive
+	}
+
+	student, err := studentRepo.GetByUserUUID(studentUUID)
+	if err != nil {
+		logger.Error("error in fetching student for package order: ", err)
+		return nil, err
+	}
+
+	order, err := config.Payments.CreateOrder(pkg.PriceInPaise, "INR", fmt.Sprintf("package_%d", pkg.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	// No expert yet, so the invoice splits the price at the default commission
+	platformFee, expertShare := splitSessionFee(uint(pkg.PriceInPaise), commissionPercentFor(&models.Expert{}))
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = models.InitPaymentRepo(tx).Create(&models.Payment{
+		OrderID:     order.ID,
+		Status:      string(models.PaymentCreated),
+		Purpose:     models.PaymentForPackage,
+		StudentID:   student.ID,
+		Amount:      uint(pkg.PriceInPaise),
+		PlatformFee: platformFee,
+		ExpertShare: expertShare,
+		Currency:    "INR",
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in storing payment for package order: ", err)
+		return nil, err
+	}
+
+	err = models.InitPackageRepo(tx).CreatePurchaseWithTx(tx, &models.StudentPackage{
+		StudentID:    student.ID,
+		PackageID:    pkg.ID,
+		OrderID:      order.ID,
+		Status:       string(models.StudentPackagePending),
+		Name:         pkg.Name,
+		SessionCount: pkg.SessionCount,
+		PriceInPaise: pkg.PriceInPaise,
+		ValidityDays: pkg.ValidityDays,
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in storing package purchase: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return &PackageOrderResponse{
+		Provider:  config.Payments.Name(),
+		OrderID:   order.ID,
+		PackageID: pkg.ID,
+		Amount:    pkg.PriceInPaise,
+		Currency:  "INR",
+		Key:       config.Payments.KeyID(),
+	}, nil
+}
+
+// ActivatePackagePurchase issues the credits of the package paid for by the
+// given order. Like BookExpertSlot it is safe to call more than once: after
+// the first call the already active purchase is returned.
+func ActivatePackagePurchase(confirmation PaymentConfirmation) (*models.StudentPackage, error) {
+	var (
+		tx          = config.DB.Begin()
+		paymentRepo = models.InitPaymentRepo(tx)
+		packageRepo = models.InitPackageRepo(tx)
+		creditRepo  = models.InitSessionCreditRepo(tx)
+		ledgerRepo  = models.InitLedgerRepo(tx)
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	payment, err := paymentRepo.GetByOrderIDForUpdate(tx, confirmation.OrderID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching payment for package: ", err)
+		return nil, err
+	}
+
+	if payment.Purpose != models.PaymentForPackage {
+		tx.Rollback()
+		return nil, ErrPaymentMismatch
+	}
+
+	purchase, err := packageRepo.GetPurchaseByOrderIDForUpdate(tx, payment.OrderID)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("payment %s has no package purchase: %v", payment.OrderID, err)
+		return nil, err
+	}
+
+	if payment.Status == string(models.PaymentPaid) {
+		// Already activated by an earlier confirm or webhook delivery
+		tx.Rollback()
+		return purchase, nil
+	}
+
+	if !payableStatus(payment.Status) {
+		tx.Rollback()
+		logger.Errorf("payment %s already in status %s", payment.OrderID, payment.Status)
+		return nil, ErrPaymentAlreadyProcessed
+	}
+
+	pkg, err := packageRepo.GetByID(purchase.PackageID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching package: ", err)
+		return nil, err
+	}
+
+	paidAt := time.Now()
+	expiresAt := paidAt.AddDate(0, 0, purchase.ValidityDays)
+
+	credits := make([]models.SessionCredit, 0, purchase.SessionCount)
+	for _, value := range splitPackagePrice(int64(payment.Amount), purchase.SessionCount) {
+		credits = append(credits, models.SessionCredit{
+			StudentID:       purchase.StudentID,
+			Status:          string(models.SessionCreditAvailable),
+			Source:          models.SessionCreditFromPackage,
+			SourceID:        purchase.ID,
+			ValueInPaise:    value,
+			ExpiresAt:       expiresAt,
+			ExpertUUIDs:     pkg.ExpertUUIDs,
+			Specializations: pkg.Specializations,
+		})
+	}
+
+	if err := creditRepo.CreateWithTx(tx, credits); err != nil {
+		tx.Rollback()
+		logger.Error("error in issuing session credits: ", err)
+		return nil, err
+	}
+
+	if err := packageRepo.ActivatePurchaseWithTx(tx, purchase.ID, paidAt, expiresAt); err != nil {
+		tx.Rollback()
+		logger.Error("error in activating package purchase: ", err)
+		return nil, err
+	}
+
+	// The money is owed to the student as sessions until the credits are spent
+	err = ledgerRepo.Create(&models.LedgerTransaction{
+		Kind:        "purchase:package",
+		ReferenceID: payment.OrderID,
+		Description: fmt.Sprintf("Purchase of %s (%d sessions)", purchase.Name, purchase.SessionCount),
+		Postings: []models.LedgerPosting{
+			{Account: models.LedgerSessionCreditsAccount, AmountInPaise: int64(payment.Amount)},
+			{Account: models.LedgerGatewayAccount, AmountInPaise: -int64(payment.Amount)},
+		},
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in posting package purchase: ", err)
+		return nil, err
+	}
+
+	err = paymentRepo.UpdateWithTx(tx, &models.Payment{
+		Status:    string(models.PaymentPaid),
+		PaymentID: confirmation.PaymentID,
+		Method:    confirmation.Method,
+		PaidAt:    &paidAt,
+	}, &models.Payment{OrderID: payment.OrderID})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in marking payment as paid: ", err)
+		return nil, err
+	}
+
+	payment.PaidAt = &paidAt
+	if _, err := issueInvoiceWithTx(tx, payment, ""); err != nil {
+		tx.Rollback()
+		logger.Error("error in issuing invoice: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	purchase.Status = string(models.StudentPackageActive)
+	purchase.ActivatedAt, purchase.ExpiresAt = &paidAt, &expiresAt
+	return purchase, nil
+}
+
+// BookSlotWithCredit books the slot with one of the student's session
+// credits instead of a gateway payment. The credit closest to expiry that
+// covers the expert is spent. A credit covers an expert in its scope whose
+// fee is no more than its value, so an expert is never paid less than
+// their fee for a session booked with one.
+func BookSlotWithCredit(studentUUID string, slotID uint) (*models.Session, error) {
+	var (
+		tx          = config.DB.Begin()
+		slotRepo    = models.InitAvailabilitySlotRepo(tx)
+		expertRepo  = models.InitExpertRepo(tx)
+		studentRepo = models.InitStudentRepo(tx)
+		creditRepo  = models.InitSessionCreditRepo(tx)
+		now         = time.Now()
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	student, err := studentRepo.GetByUserUUID(studentUUID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching student for credit booking: ", err)
+		return nil, err
+	}
+
+	// Available, or held by this student's own unfinished checkout
+	slot, err := slotRepo.LockForHoldWithTx(tx, slotID, student.ID)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("slot %d not available for credit booking: %v", slotID, err)
+		return nil, ErrSlotNotAvailable
+	}
+
+	if err := checkSchedulingWithTx(tx, slot, student.ID, now, ""); err != nil {
+		tx.Rollback()
+		logger.Errorf("slot %d refused by the expert's scheduling limits: %v", slotID, err)
+		return nil, err
+	}
+
+	expert, err := expertRepo.GetWithTx(tx, &models.Expert{UserID: slot.ExpertID})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching expert for credit booking: ", err)
+		return nil, err
+	}
+
+	credits, err := creditRepo.LockUsableWithTx(tx, student.ID, now)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching session credits: ", err)
+		return nil, err
+	}
+
+	var (
+		credit *models.SessionCredit
+		fee    = int64(sessionFeeInPaise(expert))
+	)
+	for i := range credits {
+		if credits[i].ValueInPaise >= fee && expertInScope(credits[i].ExpertUUIDs, credits[i].Specializations, expert) {
+			credit = &credits[i]
+			break
+		}
+	}
+	if credit == nil {
+		tx.Rollback()
+		return nil, ErrNoUsableCredit
+	}
+
+	session, err := createSessionWithTx(tx, slot, student.ID, studentUUID, "", &credit.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := creditRepo.MarkUsedWithTx(tx, credit.ID, session.SessionUUID, now); err != nil {
+		tx.Rollback()
+		logger.Error("error in spending session credit: ", err)
+		return nil, err
+	}
+
+	platformFee, expertShare := splitSessionFee(uint(credit.ValueInPaise), commissionPercentFor(expert))
+	err = creditSessionEarningsWithTx(tx, session, platformFee, expertShare, models.LedgerSessionCreditsAccount)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ExpireSessionCredits forfeits unspent credits past their expiry and takes
+// their value out of the prepaid pool. Batches are claimed with SKIP LOCKED
+// like the wallet sweeper. It returns how many credits expired.
+func ExpireSessionCredits(now time.Time) (int, error) {
+	expired := 0
+	for {
+		n, err := expireSessionCreditBatch(now)
+		expired += n
+		if err != nil || n < sessionCreditExpiryBatchSize {
+			return expired, err
+		}
+	}
+}
+
+func expireSessionCreditBatch(now time.Time) (int, error) {
+	var (
+		tx         = config.DB.Begin()
+		creditRepo = models.InitSessionCreditRepo(tx)
+		ledgerRepo = models.InitLedgerRepo(tx)
+	)
+
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	credits, err := creditRepo.LockExpiredWithTx(tx, now, sessionCreditExpiryBatchSize)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in locking expired session credits: ", err)
+		return 0, err
+	}
+
+	for _, credit := range credits {
+		err := ledgerRepo.Create(&models.LedgerTransaction{
+			Kind:        "expiry:session_credit",
+			ReferenceID: fmt.Sprintf("session_credit_%d", credit.ID),
+			Description: fmt.Sprintf("Expired %s session credit", credit.Source),
+			Postings: []models.LedgerPosting{
+				{Account: models.LedgerExpiredCreditsAccount, AmountInPaise: credit.ValueInPaise},
+				{Account: models.LedgerSessionCreditsAccount, AmountInPaise: -credit.ValueInPaise},
+			},
+		})
+		if err != nil {
+			tx.Rollback()
+			logger.Errorf("error in posting expiry of session credit %d: %v", credit.ID, err)
+			return 0, err
+		}
+
+		if err := creditRepo.MarkExpiredWithTx(tx, credit.ID); err != nil {
+			tx.Rollback()
+			logger.Errorf("error in marking session credit %d expired: %v", credit.ID, err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return len(credits), nil
+}
+
+// ListPackagesHandler lists the packages on sale.
+func ListPackagesHandler(c *gin.Context) {
+	packages, err := models.InitPackageRepo(config.DB).ListActive()
+	if err != nil {
+		logger.Error("error in listing packages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, packages)
+}
+
+func PurchasePackageHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("package_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid package id"})
+		return
+	}
+
+	order, err := CreatePackageOrder(c.GetString("user_uuid"), uint(id))
+	if err != nil {
+		logger.Error("error in creating package order: ", err)
+		switch {
+		case errors.Is(err, ErrPackageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrPackageInactive):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create payment order"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+type ConfirmPackagePurchaseRequest struct {
+	RazorpayOrderID   string `json:"razorpay_order_id" binding:"required"`
+	RazorpayPaymentID string `json:"razorpay_payment_id" binding:"required"`
+	RazorpaySignature string `json:"razorpay_signature" binding:"required"`
+}
+
+func ConfirmPackagePurchaseHandler(c *gin.Context) {
+	var (
+		req         ConfirmPackagePurchaseRequest
+		paymentRepo = models.InitPaymentRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, err := paymentRepo.GetByOrderID(req.RazorpayOrderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment order not found"})
+		return
+	}
+
+	student, err := studentRepo.GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	if payment.Purpose != models.PaymentForPackage || payment.StudentID != student.ID {
+		logger.Errorf("order %s is not a package order of student %d", payment.OrderID, student.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrPaymentMismatch.Error()})
+		return
+	}
+
+	if !config.Payments.VerifyPaymentSignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature) {
+		logger.Error("error in verifying razorpay signature")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment signature"})
+		return
+	}
+
+	method, err := FetchPaymentMethod(req.RazorpayPaymentID)
+	if err != nil {
+		logger.Error("error in fetching razorpay payment method: ", err)
+	}
+
+	purchase, err := ActivatePackagePurchase(PaymentConfirmation{
+		OrderID:   req.RazorpayOrderID,
+		PaymentID: req.RazorpayPaymentID,
+		Method:    method,
+	})
+	if err != nil {
+		logger.Error("error in activating package after payment: ", err)
+		if errors.Is(err, ErrPaymentAlreadyProcessed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to activate package"})
+		return
+	}
+
+	c.JSON(http.StatusOK, purchase)
+}
+
+type StudentCreditsResponse struct {
+	Available int                     `json:"available"` // unspent, unexpired credits
+	Packages  []models.StudentPackage `json:"packages"`
+	Credits   []models.SessionCredit  `json:"credits"`
+}
+
+// GetStudentCreditsHandler lists the student's purchased packages and the
+// credits they issued.
+func GetStudentCreditsHandler(c *gin.Context) {
+	student, err := models.InitStudentRepo(config.DB).GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	purchases, err := models.InitPackageRepo(config.DB).ListPurchasesByStudent(student.ID)
+	if err != nil {
+		logger.Error("error in listing package purchases: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	credits, err := models.InitSessionCreditRepo(config.DB).ListByStudent(student.ID)
+	if err != nil {
+		logger.Error("error in listing session credits: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	resp := StudentCreditsResponse{Packages: purchases, Credits: credits}
+	now := time.Now()
+	for _, credit := range credits {
+		if credit.Status == string(models.SessionCreditAvailable) && credit.ExpiresAt.After(now) {
+			resp.Available++
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+type CreatePackageRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Description     string   `json:"description"`
+	SessionCount    int      `json:"session_count" binding:"required"`
+	PriceInPaise    int64    `json:"price_in_paise" binding:"required"`
+	ValidityDays    int      `json:"validity_days" binding:"required"`
+	ExpertUUIDs     []string `json:"expert_uuids"`
+	Specializations []string `json:"specializations"`
+}
+
+func (r *CreatePackageRequest) validate() string {
+	switch {
+	case strings.TrimSpace(r.Name) == "":
+		return "name is required"
+	case r.SessionCount <= 0:
+		return "session_count must be positive"
+	case r.PriceInPaise < int64(r.SessionCount):
+		return "price_in_paise must be at least one paisa per session"
+	case r.ValidityDays <= 0:
+		return "validity_days must be positive"
+	}
+	return ""
+}
+
+func CreatePackageHandler(c *gin.Context) {
+	var req CreatePackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	pkg := &models.Package{
+		Name:            strings.TrimSpace(req.Name),
+		Description:     req.Description,
+		Active:          true,
+		SessionCount:    req.SessionCount,
+		PriceInPaise:    req.PriceInPaise,
+		ValidityDays:    req.ValidityDays,
+		ExpertUUIDs:     req.ExpertUUIDs,
+		Specializations: req.Specializations,
+	}
+
+	if err := models.InitPackageRepo(config.DB).Create(pkg); err != nil {
+		logger.Error("error in creating package: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, pkg)
+}
+
+func ListAllPackagesHandler(c *gin.Context) {
+	packages, err := models.InitPackageRepo(config.DB).ListAll()
+	if err != nil {
+		logger.Error("error in listing packages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, packages)
+}
+
+// DeactivatePackageHandler takes a package off sale. Credits already
+// bought keep working until they expire.
+func DeactivatePackageHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("package_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid package id"})
+		return
+	}
+
+	if err := models.InitPackageRepo(config.DB).SetActive(uint(id), false); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": ErrPackageNotFound.Error()})
+			return
+		}
+		logger.Error("error in deactivating package: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "package deactivated"})
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPackagePrice(t *testing.T) {
+	tests := []struct {
+		name  string
+		price int64
+		count int
+		want  []int64
+	}{
+		{"divides evenly", 900, 3, []int64{300, 300, 300}},
+		{"leftover to the first credits", 1000, 3, []int64{334, 333, 333}},
+		{"two leftover paise", 1001, 3, []int64{334, 334, 333}},
+		{"less than one paisa each", 2, 3, []int64{1, 1, 0}},
+		{"single credit", 499, 1, []int64{499}},
+		{"no credits", 1000, 0, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitPackagePrice(tt.price, tt.count)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPackagePrice(%d, %d) = %v, want %v", tt.price, tt.count, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,25 @@
 package controllers
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"interviewexcel-backend-go/config"
-	"os"
+	"interviewexcel-backend-go/models"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/google/uuid"
 )
 
 // Student clicks "Book"
 //    ↓
-// Backend creates Razorpay Order
+// Backend looks up slot + expert fee, creates a gateway order
+// (config.Payments: Razorpay, or the fake gateway locally),
+// holds the slot and reserves the coupon for that order and stores a
+// Payment in status "created". An unpaid order the student opened on the
+// slot before is expired in the same transaction, giving its coupon
+// reservation and wallet payment to the new one
 //    ↓
 // Frontend opens Razorpay Checkout
 //    ↓
@@ -19,53 +27,279 @@ import (
 //    ↓
 // Frontend sends payment_id + order_id + signature
 //    ↓
-// Backend verifies signature
+// Backend verifies signature and that the order belongs to the slot/student
 //    ↓
 // BEGIN TX
-//    ├─ Lock slot
+//    ├─ Lock payment
+//    ├─ Lock slot (available, held for this order, or hold lapsed)
 //    ├─ Create session
 //    ├─ Mark slot booked
+//    ├─ Mark payment paid
 // COMMIT
 
-type RazorpayOrderResponse struct {
-	OrderID  string `json:"order_id"`
-	Amount   int    `json:"amount"`
-	Currency string `json:"currency"`
-	Key      string `json:"key"`
+var (
+	ErrSlotNotAvailable  = errors.New("slot not available")
+	ErrInvalidSessionFee = errors.New("expert has no session fee configured")
+	ErrPaymentMismatch   = errors.New("payment order does not belong to this booking")
+
+	ErrPaymentAlreadyProcessed = errors.New("payment already processed")
+)
+
+type PaymentOrderResponse struct {
+	Provider     string    `json:"provider"` // razorpay, fake, or wallet when nothing is left to pay
+	OrderID      string    `json:"order_id"`
+	Amount       int       `json:"amount"` // charged through the gateway
+	Discount     int       `json:"discount,omitempty"`
+	WalletAmount int       `json:"wallet_amount,omitempty"`
+	Currency     string    `json:"currency"`
+	Key          string    `json:"key"`
+	HeldUntil    time.Time `json:"held_until"`
+
+	// Set when the wallet paid for everything and the session is booked
+	SessionUUID string `json:"session_uuid,omitempty"`
+}
+
+// sessionFeeInPaise returns the amount charged for one session with the expert.
+// FeesPerSession is stored in paise, the same unit the expert wallet is credited in.
+func sessionFeeInPaise(expert *models.Expert) int {
+	return expert.FeesPerSession
 }
 
-func CreateRazorpayOrder(slotID uint, amountInPaise int) (*RazorpayOrderResponse, error) {
+// CreatePaymentOrder holds the slot and opens a gateway order for the
+// session fee, less the coupon's discount when a code is given. With
+// useWallet, the student's wallet pays what it can first; when it covers
+// the whole fee no gateway order is opened and the slot is booked at once.
+func CreatePaymentOrder(studentUUID string, slotID uint, couponCode string, useWallet bool) (*PaymentOrderResponse, error) {
+	var (
+		slotRepo    = models.InitAvailabilitySlotRepo(config.DB)
+		expertRepo  = models.InitExpertRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
+	)
+
+	slot, err := slotRepo.GetByID(slotID)
+	if err != nil {
+		logger.Errorf("slot %d not found for order: %v", slotID, err)
+		return nil, ErrSlotNotAvailable
+	}
+
+	expert, err := expertRepo.GetWithTx(config.DB, &models.Expert{UserID: slot.ExpertID})
+	if err != nil {
+		logger.Error("error in fetching expert for order: ", err)
+		return nil, err
+	}
+
+	student, err := studentRepo.GetByUserUUID(studentUUID)
+	if err != nil {
+		logger.Error("error in fetching student for order: ", err)
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// An unpaid order the student opened on this slot earlier is replaced:
+	// its coupon reservation and wallet payment go to the new one
+	var replacing *models.Payment
+	replacingOrderID := ""
+	if slot.Status == string(models.SlotHeld) && slot.StudentID != nil && *slot.StudentID == student.ID && slot.HoldOrderID != "" {
+		previous, err := models.InitPaymentRepo(config.DB).GetByOrderID(slot.HoldOrderID)
+		if err == nil && replaceableOrder(previous) {
+			replacing, replacingOrderID = previous, previous.OrderID
+		}
+	}
+
+	price, err := priceSession(expert, student.ID, couponCode, replacingOrderID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// The gateway order is opened before any lock is taken, so a slow
+	// gateway holds up nobody else's checkout. A slot someone else holds is
+	// refused first; an order left over when the transaction below fails is
+	// never paid and is ignored by reconciliation.
+	if !slot.HoldableBy(student.ID, now) {
+		return nil, ErrSlotNotAvailable
+	}
+
+	var walletAmount uint
+	if useWallet {
+		_, balance, err := spendableWalletBalance(config.DB, studentUUID, now)
+		if err != nil {
+			logger.Error("error in fetching wallet balance for order: ", err)
+			return nil, err
+		}
+		if replacing != nil {
+			balance += int64(replacing.WalletAmount)
+		}
+		walletAmount = walletAmountFor(balance, price.Amount)
+	}
+	amountInPaise := int(price.Amount - walletAmount)
+
+	provider, orderID := "wallet", "wallet_"+uuid.New().String()
+	if amountInPaise > 0 {
+		order, err := config.Payments.CreateOrder(int64(amountInPaise), "INR", fmt.Sprintf("slot_%d", slotID))
+		if err != nil {
+			return nil, err
+		}
+		provider, orderID = config.Payments.Name(), order.ID
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
-	data := map[string]interface{}{
-		"amount":   amountInPaise,
-		"currency": "INR",
-		"receipt":  fmt.Sprintf("slot_%d", slotID),
+	txSlotRepo := models.InitAvailabilitySlotRepo(tx)
+
+	// The replaced order is locked before the slot, in the order booking
+	// locks them, and expired unless it was paid meanwhile
+	if replacing != nil {
+		previous, err := models.InitPaymentRepo(tx).GetByOrderIDForUpdate(tx, replacing.OrderID)
+		if err != nil {
+			tx.Rollback()
+			logger.Errorf("error in locking replaced order %s: %v", replacing.OrderID, err)
+			return nil, err
+		}
+
+		if replaceableOrder(previous) {
+			if err := models.InitPaymentRepo(tx).MarkExpiredWithTx(tx, []uint{previous.ID}, now); err != nil {
+				tx.Rollback()
+				logger.Errorf("error in expiring replaced order %s: %v", previous.OrderID, err)
+				return nil, err
+			}
+
+			if err := releaseOrderWithTx(tx, previous, now); err != nil {
+				tx.Rollback()
+				logger.Errorf("error in releasing replaced order %s: %v", previous.OrderID, err)
+				return nil, err
+			}
+		}
+	}
+
+	// Lock the slot so two students cannot both get an order for it
+	if _, err := txSlotRepo.LockForHoldWithTx(tx, slot.ID, student.ID); err != nil {
+		tx.Rollback()
+		logger.Errorf("slot %d not available for order: %v", slotID, err)
+		return nil, ErrSlotNotAvailable
+	}
+
+	// Refuse before the student pays; booking checks the limits again
+	if err := checkSchedulingWithTx(tx, slot, student.ID, now, ""); err != nil {
+		tx.Rollback()
+		logger.Errorf("slot %d refused by the expert's scheduling limits: %v", slotID, err)
+		return nil, err
+	}
+
+	if err := reserveCouponWithTx(tx, price, student.ID, expert, orderID, now); err != nil {
+		tx.Rollback()
+		logger.Error("error in reserving coupon for order: ", err)
+		return nil, err
+	}
+
+	if err := spendWalletCredits(tx, studentUUID, int64(walletAmount), orderID, now); err != nil {
+		tx.Rollback()
+		logger.Error("error in paying from wallet for order: ", err)
+		return nil, err
 	}
 
-	order, err := config.RazorpayClient.Order.Create(data, nil)
+	heldUntil := now.Add(config.RuntimeConfig().SlotHoldTTL)
+	if err := txSlotRepo.HoldWithTx(tx, slot.ID, student.ID, orderID, heldUntil); err != nil {
+		tx.Rollback()
+		logger.Error("error in holding slot for order: ", err)
+		return nil, err
+	}
+
+	var couponID *uint
+	if price.Coupon != nil {
+		couponID = &price.Coupon.ID
+	}
+
+	err = models.InitPaymentRepo(tx).Create(&models.Payment{
+		OrderID:     orderID,
+		Status:      string(models.PaymentCreated),
+		StudentID:   student.ID,
+		ExpertID:    expert.ID,
+		SlotID:      slot.ID,
+		Amount:      uint(amountInPaise),
+		PlatformFee: price.PlatformFee,
+		ExpertShare: price.ExpertShare,
+		Currency:    "INR",
+
+		WalletAmount: walletAmount,
+
+		CouponID:        couponID,
+		DiscountInPaise: price.Discount,
+	})
 	if err != nil {
+		tx.Rollback()
+		logger.Error("error in storing payment for order: ", err)
 		return nil, err
 	}
 
-	resp := &RazorpayOrderResponse{
-		OrderID:  order["id"].(string),
-		Amount:   amountInPaise,
-		Currency: "INR",
-		Key:      os.Getenv("RAZORPAY_KEY"),
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
 	}
 
+	resp := &PaymentOrderResponse{
+		Provider:     provider,
+		OrderID:      orderID,
+		Amount:       amountInPaise,
+		Discount:     int(price.Discount),
+		WalletAmount: int(walletAmount),
+		Currency:     "INR",
+		HeldUntil:    heldUntil,
+	}
+
+	if amountInPaise > 0 {
+		resp.Key = config.Payments.KeyID()
+		return resp, nil
+	}
+
+	// Nothing left to pay: book now. Should this fail, the order expires
+	// like any unpaid one and the wallet amount is given back.
+	session, err := BookExpertSlot(slot.ID, PaymentConfirmation{OrderID: orderID, Method: "wallet"})
+	if err != nil {
+		return nil, err
+	}
+	resp.SessionUUID = session.SessionUUID
 	return resp, nil
 }
 
-func VerifyRazorpaySignature(orderID string, paymentID string, signature string) bool {
-
-	secret := os.Getenv("RAZORPAY_SECRET")
+// replaceableOrder reports whether a new order on the same slot may take
+// the place of the payment: it is still unpaid and not yet expired.
+func replaceableOrder(payment *models.Payment) bool {
+	return payment.Status == string(models.PaymentCreated) || payment.Status == string(models.PaymentFailed)
+}
 
-	data := orderID + "|" + paymentID
+// FetchPaymentMethod returns the method (upi, card, ...) the gateway
+// recorded for a payment. The method is informational, so callers may
+// continue with an empty value on error.
+func FetchPaymentMethod(paymentID string) (string, error) {
+	payment, err := config.Payments.FetchPayment(paymentID)
+	if err != nil {
+		return "", err
+	}
 
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write([]byte(data))
+	return payment.Method, nil
+}
 
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
-	return expectedSignature == signature
+// completePayment fulfils a captured payment: books its slot, or issues the
+// credits of the package it bought. Both paths are idempotent.
+func completePayment(payment *models.Payment, confirmation PaymentConfirmation) error {
+	var err error
+	switch payment.Purpose {
+	case models.PaymentForPackage:
+		_, err = ActivatePackagePurchase(confirmation)
+	case models.PaymentForSubscription, models.PaymentForRenewal:
+		_, err = ActivateSubscriptionCharge(confirmation)
+	default:
+		_, err = BookExpertSlot(payment.SlotID, confirmation)
+	}
+	return err
 }
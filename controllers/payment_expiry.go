@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// paymentExpiryBatchSize bounds how many orders one transaction expires.
+const paymentExpiryBatchSize = 100
+
+// paymentFunnelDefaultDays is how far back the funnel looks without from.
+const paymentFunnelDefaultDays = 30
+
+// ExpireAbandonedPayments marks orders left unpaid for longer than the
+// configured timeout as expired, releases the slot holds and coupon
+// reservations they still have and gives back what the student's wallet
+// had put towards them. Each batch is claimed with SKIP LOCKED, so several
+// instances can sweep at once without expiring the same order twice. It
+// returns how many orders were expired.
+func ExpireAbandonedPayments(now time.Time) (int, error) {
+	cutoff := now.Add(-config.RuntimeConfig().PaymentOrderTimeout)
+	expired := 0
+
+	for {
+		n, err := expirePaymentBatch(cutoff, now)
+		expired += n
+		if err != nil || n < paymentExpiryBatchSize {
+			return expired, err
+		}
+	}
+}
+
+func expirePaymentBatch(cutoff time.Time, now time.Time) (int, error) {
+	var (
+		tx          = config.DB.Begin()
+		paymentRepo = models.InitPaymentRepo(tx)
+		slotRepo    = models.InitAvailabilitySlotRepo(tx)
+	)
+
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	payments, err := paymentRepo.LockAbandonedWithTx(tx, cutoff, paymentExpiryBatchSize)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in locking abandoned payments: ", err)
+		return 0, err
+	}
+
+	if len(payments) == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	ids := make([]uint, 0, len(payments))
+	orderIDs := make([]string, 0, len(payments))
+	for _, payment := range payments {
+		ids = append(ids, payment.ID)
+		orderIDs = append(orderIDs, payment.OrderID)
+	}
+
+	if err := paymentRepo.MarkExpiredWithTx(tx, ids, now); err != nil {
+		tx.Rollback()
+		logger.Error("error in expiring payments: ", err)
+		return 0, err
+	}
+
+	released, err := slotRepo.ReleaseHoldsWithTx(tx, orderIDs)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in releasing holds of expired payments: ", err)
+		return 0, err
+	}
+
+	for _, payment := range payments {
+		if err := releaseOrderWithTx(tx, &payment, now); err != nil {
+			tx.Rollback()
+			logger.Errorf("error in releasing expired order %s: %v", payment.OrderID, err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	logger.Infof("expired %d abandoned payment orders, released %d slot holds", len(payments), released)
+	return len(payments), nil
+}
+
+// releaseOrderWithTx gives back the coupon reservation and the wallet
+// payment of an order that will not be booked.
+func releaseOrderWithTx(tx *gorm.DB, payment *models.Payment, now time.Time) error {
+	if err := releaseCouponWithTx(tx, payment); err != nil {
+		return fmt.Errorf("releasing coupon: %w", err)
+	}
+
+	if payment.WalletAmount == 0 {
+		return nil
+	}
+
+	student, err := models.InitStudentRepo(tx).GetByID(payment.StudentID)
+	if err != nil {
+		return fmt.Errorf("fetching student: %w", err)
+	}
+
+	if _, err := releaseWalletCredits(tx, student.UserID, payment.OrderID, now); err != nil {
+		return fmt.Errorf("returning wallet payment: %w", err)
+	}
+	return nil
+}
+
+// PaymentFunnelResponse is how the orders opened in [from, to) ended up:
+// paid, expired unpaid, failed, refunded or still open.
+type PaymentFunnelResponse struct {
+	From time.Time                 `json:"from"`
+	To   time.Time                 `json:"to"`
+	Rows []models.PaymentFunnelRow `json:"rows"`
+}
+
+// PaymentFunnelHandler reports the outcome of the orders opened in a date
+// range, counted from the payments the expiry sweeper and checkout leave
+// behind. to is exclusive and defaults to now; from defaults to 30 days
+// before it.
+func PaymentFunnelHandler(c *gin.Context) {
+	from, err := parseDateParam(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseDateParam(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := PaymentFunnelResponse{To: time.Now()}
+	if to != nil {
+		resp.To = *to
+	}
+	resp.From = resp.To.AddDate(0, 0, -paymentFunnelDefaultDays)
+	if from != nil {
+		resp.From = *from
+	}
+	if !resp.From.Before(resp.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	resp.Rows, err = models.InitPaymentRepo(config.DB).CountByStatusBetween(resp.From, resp.To)
+	if err != nil {
+		logger.Error("error in counting payments for funnel: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
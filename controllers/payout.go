@@ -0,0 +1,685 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/pkg/payments"
+	"interviewexcel-backend-go/pkg/secrets"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Expert → POST /expert/payouts
+//    ↓
+// BEGIN TX
+//    ├─ Debit available balance (only if it covers the amount)
+//    ├─ Create payout (requested) + "debit"/"payout" wallet transaction
+// COMMIT
+//    ↓
+// Admin approves → provider.InitiatePayout → processing
+// Admin rejects  → rejected, debit reversed
+//    ↓
+// Provider settles (payout-sync job, or admin settles manual transfers)
+//    ├─ paid
+//    ├─ failed → debit reversed ("credit"/"payout")
+
+var (
+	ErrPayoutAccountMissing = errors.New("add a bank account or UPI ID before requesting a payout")
+	ErrPayoutBelowMinimum   = errors.New("payout amount is below the minimum")
+	ErrInsufficientBalance  = errors.New("insufficient available balance")
+	ErrPayoutNotFound       = errors.New("payout not found")
+	ErrPayoutWrongStatus    = errors.New("payout is not in a state that allows this action")
+	ErrPayoutProvider       = errors.New("payout provider could not start the transfer")
+	ErrPayoutNotExpert      = errors.New("only experts can request payouts")
+)
+
+var (
+	accountNumberPattern = regexp.MustCompile(`^[0-9]{9,18}$`)
+	ifscPattern          = regexp.MustCompile(`^[A-Z]{4}0[A-Z0-9]{6}$`)
+	upiIDPattern         = regexp.MustCompile(`^[a-zA-Z0-9.\-_]{2,256}@[a-zA-Z]{2,64}$`)
+)
+
+// payoutSyncBatchSize bounds how many processing payouts one job run checks.
+const payoutSyncBatchSize = 100
+
+type PayoutAccountRequest struct {
+	Method            string `json:"method" binding:"required,oneof=bank upi"`
+	AccountHolderName string `json:"account_holder_name" binding:"required"`
+	AccountNumber     string `json:"account_number"`
+	IFSC              string `json:"ifsc"`
+	UPIID             string `json:"upi_id"`
+}
+
+// payoutDetails is the plaintext sealed into PayoutAccount.EncryptedDetails.
+type payoutDetails struct {
+	AccountNumber string `json:"account_number,omitempty"`
+	IFSC          string `json:"ifsc,omitempty"`
+	UPIID         string `json:"upi_id,omitempty"`
+}
+
+type CreatePayoutRequest struct {
+	AmountInPaise int64 `json:"amount_in_paise" binding:"required"`
+}
+
+type RejectPayoutRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type SettlePayoutRequest struct {
+	Status string `json:"status" binding:"required,oneof=paid failed"`
+	UTR    string `json:"utr"`
+	Reason string `json:"reason"`
+}
+
+// AdminPayoutResponse carries the decrypted destination so an admin can
+// make or check the transfer.
+type AdminPayoutResponse struct {
+	models.Payout
+	AccountNumber string `json:"account_number,omitempty"`
+	IFSC          string `json:"ifsc,omitempty"`
+	UPIID         string `json:"upi_id,omitempty"`
+}
+
+func payoutBox() (*secrets.Box, error) {
+	box, err := secrets.NewBox(config.RuntimeConfig().PayoutEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("PAYOUT_ENCRYPTION_KEY: %w", err)
+	}
+	return box, nil
+}
+
+func sealPayoutDetails(details payoutDetails) (string, error) {
+	box, err := payoutBox()
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := json.Marshal(details)
+	if err != nil {
+		return "", err
+	}
+	return box.Seal(plaintext)
+}
+
+func openPayoutDetails(encrypted string) (*payoutDetails, error) {
+	box, err := payoutBox()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := box.Open(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	var details payoutDetails
+	if err := json.Unmarshal(plaintext, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+func maskPayoutDestination(method string, details payoutDetails) string {
+	if method == "upi" {
+		parts := strings.SplitN(details.UPIID, "@", 2)
+		prefix := parts[0]
+		if len(prefix) > 2 {
+			prefix = prefix[:2]
+		}
+		return prefix + "***@" + parts[1]
+	}
+
+	number := details.AccountNumber
+	return strings.Repeat("X", len(number)-4) + number[len(number)-4:]
+}
+
+func SavePayoutAccountHandler(c *gin.Context) {
+	var (
+		req         PayoutAccountRequest
+		details     payoutDetails
+		accountRepo = models.InitPayoutAccountRepo(config.DB)
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("error in binding payout account request: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch req.Method {
+	case "bank":
+		details.AccountNumber = strings.TrimSpace(req.AccountNumber)
+		details.IFSC = strings.ToUpper(strings.TrimSpace(req.IFSC))
+		if !accountNumberPattern.MatchString(details.AccountNumber) || !ifscPattern.MatchString(details.IFSC) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a valid account_number and ifsc are required for bank payouts"})
+			return
+		}
+	case "upi":
+		details.UPIID = strings.TrimSpace(req.UPIID)
+		if !upiIDPattern.MatchString(details.UPIID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a valid upi_id is required for UPI payouts"})
+			return
+		}
+	}
+
+	encrypted, err := sealPayoutDetails(details)
+	if err != nil {
+		logger.Error("error in encrypting payout details: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save payout account"})
+		return
+	}
+
+	account := &models.PayoutAccount{
+		ExpertUUID:        c.GetString("user_uuid"),
+		Method:            req.Method,
+		AccountHolderName: strings.TrimSpace(req.AccountHolderName),
+		MaskedDestination: maskPayoutDestination(req.Method, details),
+		EncryptedDetails:  encrypted,
+	}
+	if err := accountRepo.Upsert(account); err != nil {
+		logger.Error("error in saving payout account: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save payout account"})
+		return
+	}
+
+	saved, err := accountRepo.GetByExpertUUID(account.ExpertUUID)
+	if err != nil {
+		logger.Error("error in fetching saved payout account: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save payout account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+func GetPayoutAccountHandler(c *gin.Context) {
+	account, err := models.InitPayoutAccountRepo(config.DB).GetByExpertUUID(c.GetString("user_uuid"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No payout account configured"})
+			return
+		}
+		logger.Error("error in fetching payout account: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func RequestPayoutHandler(c *gin.Context) {
+	var req CreatePayoutRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("error in binding payout request: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	payout, err := RequestPayout(c.GetString("user_uuid"), req.AmountInPaise)
+	if err != nil {
+		logger.Error("error in requesting payout: ", err)
+		switch {
+		case errors.Is(err, ErrPayoutAccountMissing):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrPayoutBelowMinimum):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":            err.Error(),
+				"minimum_in_paise": config.RuntimeConfig().PayoutMinimumInPaise,
+			})
+		case errors.Is(err, ErrInsufficientBalance):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrPayoutNotExpert):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request payout"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, payout)
+}
+
+// RequestPayout debits the expert's available balance and records a payout
+// request in the same transaction. Student wallets hold credits that can
+// only be spent on bookings, so they are never paid out.
+func RequestPayout(expertUUID string, amountInPaise int64) (*models.Payout, error) {
+	if amountInPaise < config.RuntimeConfig().PayoutMinimumInPaise {
+		return nil, ErrPayoutBelowMinimum
+	}
+
+	if _, err := models.InitExpertRepo(config.DB).GetWithTx(config.DB, &models.Expert{UserID: expertUUID}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPayoutNotExpert
+		}
+		return nil, err
+	}
+
+	account, err := models.InitPayoutAccountRepo(config.DB).GetByExpertUUID(expertUUID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPayoutAccountMissing
+		}
+		return nil, err
+	}
+
+	var (
+		tx         = config.DB.Begin()
+		payoutRepo = models.InitPayoutRepo(tx)
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	payout := &models.Payout{
+		PayoutUUID:        uuid.New().String(),
+		ExpertUUID:        expertUUID,
+		AmountInPaise:     amountInPaise,
+		Status:            string(models.PayoutRequested),
+		PayoutAccountID:   account.ID,
+		Method:            account.Method,
+		AccountHolderName: account.AccountHolderName,
+		MaskedDestination: account.MaskedDestination,
+		EncryptedDetails:  account.EncryptedDetails,
+	}
+	if err := payoutRepo.Create(payout); err != nil {
+		tx.Rollback()
+		logger.Error("error in creating payout: ", err)
+		return nil, err
+	}
+
+	err = moveWalletFunds(tx, walletMovement{
+		UserUUID:       expertUUID,
+		Balance:        models.LedgerBalanceAvailable,
+		AmountInPaise:  -amountInPaise,
+		CounterAccount: models.LedgerPayoutsAccount,
+		RequireFunds:   true,
+		Type:           "debit",
+		Source:         "payout",
+		ReferenceID:    payout.PayoutUUID,
+		Description:    "Payout to " + account.MaskedDestination,
+	})
+	if err != nil {
+		tx.Rollback()
+		if !errors.Is(err, ErrInsufficientBalance) {
+			logger.Error("error in debiting wallet for payout: ", err)
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	logger.Infof("payout %s of %d paise requested by %s", payout.PayoutUUID, amountInPaise, expertUUID)
+	return payout, nil
+}
+
+func ListExpertPayoutsHandler(c *gin.Context) {
+	payouts, err := models.InitPayoutRepo(config.DB).ListByExpert(c.GetString("user_uuid"))
+	if err != nil {
+		logger.Error("error in listing payouts: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payouts)
+}
+
+func ListPayoutsHandler(c *gin.Context) {
+	status := models.PayoutStatus(c.DefaultQuery("status", string(models.PayoutRequested)))
+
+	payouts, err := models.InitPayoutRepo(config.DB).ListByStatus(status, 500)
+	if err != nil {
+		logger.Error("error in listing payouts: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payouts)
+}
+
+func GetPayoutHandler(c *gin.Context) {
+	payout, err := models.InitPayoutRepo(config.DB).GetByUUID(c.Param("payout_uuid"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": ErrPayoutNotFound.Error()})
+			return
+		}
+		logger.Error("error in fetching payout: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	resp := AdminPayoutResponse{Payout: *payout}
+
+	if details, err := openPayoutDetails(payout.EncryptedDetails); err == nil {
+		resp.AccountNumber = details.AccountNumber
+		resp.IFSC = details.IFSC
+		resp.UPIID = details.UPIID
+	} else {
+		logger.Error("error in decrypting payout details: ", err)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func ApprovePayoutHandler(c *gin.Context) {
+	payout, err := ApprovePayout(c.Param("payout_uuid"), c.GetString("user_uuid"))
+	if err != nil {
+		respondPayoutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payout)
+}
+
+func RejectPayoutHandler(c *gin.Context) {
+	var req RejectPayoutRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a rejection reason is required"})
+		return
+	}
+
+	payout, err := RejectPayout(c.Param("payout_uuid"), c.GetString("user_uuid"), strings.TrimSpace(req.Reason))
+	if err != nil {
+		respondPayoutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payout)
+}
+
+// SettlePayoutHandler records the outcome of a transfer the provider does not
+// report on its own, such as a manual bank transfer.
+func SettlePayoutHandler(c *gin.Context) {
+	var req SettlePayoutRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Status == payments.PayoutFailed && strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a reason is required for failed payouts"})
+		return
+	}
+
+	payout, err := SettlePayout(c.Param("payout_uuid"), &payments.PayoutResult{
+		Status:        req.Status,
+		UTR:           strings.TrimSpace(req.UTR),
+		FailureReason: strings.TrimSpace(req.Reason),
+	})
+	if err != nil {
+		respondPayoutError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payout)
+}
+
+func respondPayoutError(c *gin.Context, err error) {
+	logger.Error("error in updating payout: ", err)
+	switch {
+	case errors.Is(err, ErrPayoutNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrPayoutWrongStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrPayoutProvider):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update payout"})
+	}
+}
+
+// lockPayout starts a transaction and locks the payout, which must be in
+// the given status.
+func lockPayout(payoutUUID string, status models.PayoutStatus) (*gorm.DB, *models.Payout, error) {
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, nil, tx.Error
+	}
+
+	payout, err := models.InitPayoutRepo(tx).GetByUUIDForUpdate(payoutUUID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrPayoutNotFound
+		}
+		return nil, nil, err
+	}
+
+	if payout.Status != string(status) {
+		tx.Rollback()
+		return nil, nil, ErrPayoutWrongStatus
+	}
+
+	return tx, payout, nil
+}
+
+// ApprovePayout hands a requested payout to the provider. A provider error
+// leaves the payout requested so it can be approved again.
+func ApprovePayout(payoutUUID string, adminUUID string) (*models.Payout, error) {
+	tx, payout, err := lockPayout(payoutUUID, models.PayoutRequested)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Paid to the destination recorded with the request, never to the
+	// expert's current account
+	details, err := openPayoutDetails(payout.EncryptedDetails)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in decrypting payout details: ", err)
+		return nil, err
+	}
+
+	result, err := config.Payouts.InitiatePayout(payments.PayoutInstruction{
+		ReferenceID:       payout.PayoutUUID,
+		AmountInPaise:     payout.AmountInPaise,
+		Method:            payout.Method,
+		AccountHolderName: payout.AccountHolderName,
+		AccountNumber:     details.AccountNumber,
+		IFSC:              details.IFSC,
+		UPIID:             details.UPIID,
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("payout provider rejected %s: %v", payoutUUID, err)
+		return nil, ErrPayoutProvider
+	}
+
+	now := time.Now()
+	err = models.InitPayoutRepo(tx).Update(payoutUUID, map[string]interface{}{
+		"status":             string(models.PayoutProcessing),
+		"provider":           config.Payouts.Name(),
+		"provider_payout_id": result.ProviderPayoutID,
+		"reviewed_by":        adminUUID,
+		"reviewed_at":        now,
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in marking payout processing: ", err)
+		return nil, err
+	}
+
+	// Some providers settle (or refuse) the transfer straight away
+	if result.Status != payments.PayoutProcessing {
+		if err := applyPayoutOutcome(tx, payout, result); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	logger.Infof("payout %s approved by %s (%s)", payoutUUID, adminUUID, result.Status)
+	return models.InitPayoutRepo(config.DB).GetByUUID(payoutUUID)
+}
+
+// RejectPayout declines a requested payout and returns the amount to the
+// expert's available balance.
+func RejectPayout(payoutUUID string, adminUUID string, reason string) (*models.Payout, error) {
+	tx, payout, err := lockPayout(payoutUUID, models.PayoutRequested)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+	err = models.InitPayoutRepo(tx).Update(payoutUUID, map[string]interface{}{
+		"status":         string(models.PayoutRejected),
+		"failure_reason": reason,
+		"reviewed_by":    adminUUID,
+		"reviewed_at":    now,
+		"settled_at":     now,
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in rejecting payout: ", err)
+		return nil, err
+	}
+
+	if err := reversePayoutDebit(tx, payout, "Payout request rejected: "+reason); err != nil {
+		tx.Rollback()
+		logger.Error("error in reversing rejected payout: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	logger.Infof("payout %s rejected by %s", payoutUUID, adminUUID)
+	return models.InitPayoutRepo(config.DB).GetByUUID(payoutUUID)
+}
+
+// SettlePayout records the final outcome of a processing payout.
+func SettlePayout(payoutUUID string, result *payments.PayoutResult) (*models.Payout, error) {
+	tx, payout, err := lockPayout(payoutUUID, models.PayoutProcessing)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := applyPayoutOutcome(tx, payout, result); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	logger.Infof("payout %s settled as %s", payoutUUID, result.Status)
+	return models.InitPayoutRepo(config.DB).GetByUUID(payoutUUID)
+}
+
+// applyPayoutOutcome marks the locked payout paid or failed. A failed payout
+// gives the amount back to the expert.
+func applyPayoutOutcome(tx *gorm.DB, payout *models.Payout, result *payments.PayoutResult) error {
+	now := time.Now()
+	payoutRepo := models.InitPayoutRepo(tx)
+
+	switch result.Status {
+	case payments.PayoutPaid:
+		return payoutRepo.Update(payout.PayoutUUID, map[string]interface{}{
+			"status":     string(models.PayoutPaid),
+			"utr":        result.UTR,
+			"settled_at": now,
+		})
+
+	case payments.PayoutFailed:
+		err := payoutRepo.Update(payout.PayoutUUID, map[string]interface{}{
+			"status":         string(models.PayoutFailed),
+			"failure_reason": result.FailureReason,
+			"settled_at":     now,
+		})
+		if err != nil {
+			return err
+		}
+		return reversePayoutDebit(tx, payout, "Payout failed: "+result.FailureReason)
+
+	default:
+		return fmt.Errorf("unexpected payout status %q", result.Status)
+	}
+}
+
+func reversePayoutDebit(tx *gorm.DB, payout *models.Payout, description string) error {
+	return creditWallet(tx, payout.ExpertUUID, models.LedgerPayoutsAccount, payout.AmountInPaise, "payout", payout.PayoutUUID, description)
+}
+
+// SyncProcessingPayouts asks the provider about every processing payout and
+// settles those that have finished. It returns how many were settled.
+func SyncProcessingPayouts(now time.Time) (int, error) {
+	payouts, err := models.InitPayoutRepo(config.DB).ListByStatus(models.PayoutProcessing, payoutSyncBatchSize)
+	if err != nil {
+		logger.Error("error in fetching processing payouts: ", err)
+		return 0, err
+	}
+
+	settled := 0
+	for _, payout := range payouts {
+		if payout.Provider != config.Payouts.Name() || payout.ProviderPayoutID == "" {
+			continue
+		}
+
+		result, err := config.Payouts.FetchPayout(payout.ProviderPayoutID)
+		if err != nil {
+			logger.Errorf("error in fetching payout %s from provider: %v", payout.PayoutUUID, err)
+			continue
+		}
+		if result.Status == payments.PayoutProcessing {
+			continue
+		}
+
+		if _, err := SettlePayout(payout.PayoutUUID, result); err != nil {
+			if !errors.Is(err, ErrPayoutWrongStatus) {
+				logger.Errorf("error in settling payout %s: %v", payout.PayoutUUID, err)
+			}
+			continue
+		}
+		settled++
+	}
+
+	return settled, nil
+}
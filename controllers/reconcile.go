@@ -0,0 +1,462 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/pkg/payments"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"gorm.io/gorm"
+)
+
+// Reconciliation compares the gateway's view of a time window with ours:
+//
+//   gateway payment captured, local Payment not paid  → book it, or issue the
+//                                                       package credits (healed)
+//   gateway payment failed, local Payment created     → mark failed (healed)
+//   gateway refunds ahead of local refunded_amount    → record refund (healed)
+//   captured, but the slot or charge is gone          → refunded (listed)
+//   anything else that disagrees                      → reported for a human
+//
+// Healing goes through the same idempotent paths as the webhook, so it is
+// safe to run on several instances and to repeat.
+
+// Discrepancy kinds in a ReconcileReport
+const (
+	DiscrepancyPaidNotBooked     = "paid_not_booked"
+	DiscrepancyFailedNotRecorded = "failed_not_recorded"
+	DiscrepancyRefundNotRecorded = "refund_not_recorded"
+	DiscrepancyUnknownOrder      = "unknown_order"
+	DiscrepancyCapturedUnknown   = "captured_for_unknown_order"
+	DiscrepancyAmountMismatch    = "amount_mismatch"
+	DiscrepancyDuplicateCapture  = "duplicate_capture"
+	DiscrepancyMissingSession    = "missing_session"
+	DiscrepancyMissingWalletRows = "missing_wallet_entries"
+	DiscrepancyMissingCredits    = "missing_credits"
+	DiscrepancyNotCaptured       = "paid_but_not_captured"
+	DiscrepancyRefundedNotBooked = "refunded_not_booked"
+)
+
+type Discrepancy struct {
+	Kind      string `json:"kind"`
+	OrderID   string `json:"order_id"`
+	PaymentID string `json:"payment_id,omitempty"`
+	Detail    string `json:"detail"`
+	Healed    bool   `json:"healed"`
+	HealError string `json:"heal_error,omitempty"`
+}
+
+type ReconcileReport struct {
+	From            time.Time     `json:"from"`
+	To              time.Time     `json:"to"`
+	GatewayOrders   int           `json:"gateway_orders"`
+	GatewayPayments int           `json:"gateway_payments"`
+	LocalPayments   int           `json:"local_payments"`
+	Discrepancies   []Discrepancy `json:"discrepancies"`
+}
+
+// Unresolved counts discrepancies that still need attention.
+func (r *ReconcileReport) Unresolved() int {
+	count := 0
+	for _, d := range r.Discrepancies {
+		if !d.Healed {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *ReconcileReport) add(d Discrepancy) {
+	r.Discrepancies = append(r.Discrepancies, d)
+}
+
+// ReconcilePayments matches gateway orders and payments created in [from, to)
+// against local Payment, Session and WalletTransaction rows. With heal set,
+// safe discrepancies are repaired; the report records which ones were.
+func ReconcilePayments(from time.Time, to time.Time, heal bool) (*ReconcileReport, error) {
+	var (
+		paymentRepo = models.InitPaymentRepo(config.DB)
+		report      = &ReconcileReport{From: from, To: to}
+	)
+
+	gatewayOrders, err := config.Payments.ListOrders(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("listing gateway orders: %w", err)
+	}
+	gatewayPayments, err := config.Payments.ListPayments(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("listing gateway payments: %w", err)
+	}
+	report.GatewayOrders, report.GatewayPayments = len(gatewayOrders), len(gatewayPayments)
+
+	// Local rows for the window, plus any older orders the gateway saw paid in it
+	localPayments, err := paymentRepo.ListCreatedBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.LocalPayments = len(localPayments)
+
+	local := make(map[string]*models.Payment, len(localPayments))
+	for i := range localPayments {
+		local[localPayments[i].OrderID] = &localPayments[i]
+	}
+
+	var missing []string
+	for _, gp := range gatewayPayments {
+		if _, ok := local[gp.OrderID]; !ok && gp.OrderID != "" {
+			missing = append(missing, gp.OrderID)
+		}
+	}
+	older, err := paymentRepo.GetByOrderIDs(missing)
+	if err != nil {
+		return nil, err
+	}
+	for i := range older {
+		local[older[i].OrderID] = &older[i]
+	}
+
+	// An order opened for a checkout that then failed locally is never
+	// shown to the student; left unattempted it needs no attention
+	for _, order := range gatewayOrders {
+		if _, ok := local[order.ID]; !ok && order.Status != "created" {
+			report.add(Discrepancy{
+				Kind:    DiscrepancyUnknownOrder,
+				OrderID: order.ID,
+				Detail:  fmt.Sprintf("gateway order (%s, %d paise) has no local payment", order.Status, order.AmountInPaise),
+			})
+		}
+	}
+
+	// Captured payments per order; more than one means the student paid twice
+	captured := map[string][]payments.Payment{}
+	for _, gp := range gatewayPayments {
+		if isCaptured(gp.Status) {
+			captured[gp.OrderID] = append(captured[gp.OrderID], gp)
+		}
+	}
+
+	for _, gp := range gatewayPayments {
+		payment, ok := local[gp.OrderID]
+		if !ok {
+			if isCaptured(gp.Status) {
+				report.add(Discrepancy{
+					Kind:      DiscrepancyCapturedUnknown,
+					OrderID:   gp.OrderID,
+					PaymentID: gp.ID,
+					Detail:    fmt.Sprintf("%d paise captured for an order we have no record of; refund manually", gp.AmountInPaise),
+				})
+			}
+			continue
+		}
+
+		switch {
+		case isCaptured(gp.Status):
+			reconcileCaptured(report, payment, gp, len(captured[gp.OrderID]), heal)
+		case gp.Status == "failed" && payment.Status == string(models.PaymentCreated) && len(captured[gp.OrderID]) == 0:
+			d := Discrepancy{
+				Kind:      DiscrepancyFailedNotRecorded,
+				OrderID:   gp.OrderID,
+				PaymentID: gp.ID,
+				Detail:    "gateway payment failed, local payment still created",
+			}
+			if heal {
+				healDiscrepancy(&d, markPaymentFailed(gatewayPaymentEntity(gp)))
+			}
+			report.add(d)
+		}
+	}
+
+	// Local payments marked paid that the gateway did not capture in the window.
+	// Orders paid entirely from the wallet never went to the gateway.
+	for _, payment := range localPayments {
+		if payableStatus(payment.Status) || payment.Amount == 0 {
+			continue
+		}
+		if len(captured[payment.OrderID]) > 0 {
+			continue
+		}
+		reconcileLocalPaid(report, &payment)
+	}
+
+	return report, nil
+}
+
+func isCaptured(status string) bool {
+	return status == "captured" || status == "refunded"
+}
+
+func gatewayPaymentEntity(gp payments.Payment) razorpayPaymentEntity {
+	return razorpayPaymentEntity{
+		ID:             gp.ID,
+		OrderID:        gp.OrderID,
+		Amount:         gp.AmountInPaise,
+		AmountRefunded: gp.AmountRefunded,
+		Method:         gp.Method,
+		Status:         gp.Status,
+	}
+}
+
+func healDiscrepancy(d *Discrepancy, err error) {
+	if err != nil {
+		d.HealError = err.Error()
+		return
+	}
+	d.Healed = true
+}
+
+// reconcileCaptured checks one captured gateway payment against its order.
+func reconcileCaptured(report *ReconcileReport, payment *models.Payment, gp payments.Payment, capturesForOrder int, heal bool) {
+	if gp.AmountInPaise != int64(payment.Amount) {
+		report.add(Discrepancy{
+			Kind:      DiscrepancyAmountMismatch,
+			OrderID:   payment.OrderID,
+			PaymentID: gp.ID,
+			Detail:    fmt.Sprintf("gateway captured %d paise, order is for %d", gp.AmountInPaise, payment.Amount),
+		})
+		return
+	}
+
+	// Not yet booked: this is the crash between signature check and commit
+	if payableStatus(payment.Status) {
+		d := Discrepancy{
+			Kind:      DiscrepancyPaidNotBooked,
+			OrderID:   payment.OrderID,
+			PaymentID: gp.ID,
+			Detail:    fmt.Sprintf("gateway payment captured, local payment %s", payment.Status),
+		}
+		if heal {
+			err := completePayment(payment, PaymentConfirmation{
+				OrderID:   payment.OrderID,
+				PaymentID: gp.ID,
+				Method:    gp.Method,
+			})
+			if errors.Is(err, ErrSlotNotAvailable) || errors.Is(err, ErrSubscriptionChargeVoid) {
+				err = refundedAfterRefusal(&d, payment, err)
+			}
+			healDiscrepancy(&d, err)
+		}
+		report.add(d)
+		return
+	}
+
+	if payment.PaymentID != gp.ID {
+		if capturesForOrder > 1 {
+			report.add(Discrepancy{
+				Kind:      DiscrepancyDuplicateCapture,
+				OrderID:   payment.OrderID,
+				PaymentID: gp.ID,
+				Detail:    fmt.Sprintf("order was paid by %s; this second capture should be refunded", payment.PaymentID),
+			})
+		}
+		return
+	}
+
+	if gp.AmountRefunded > int64(payment.RefundedAmount) {
+		d := Discrepancy{
+			Kind:      DiscrepancyRefundNotRecorded,
+			OrderID:   payment.OrderID,
+			PaymentID: gp.ID,
+			Detail:    fmt.Sprintf("gateway refunded %d paise, local %d", gp.AmountRefunded, payment.RefundedAmount),
+		}
+		if heal {
+			healDiscrepancy(&d, recordRefund(gatewayPaymentEntity(gp)))
+		}
+		report.add(d)
+	}
+
+	reconcileBookingRecords(report, payment)
+}
+
+// refundedAfterRefusal reports how a captured payment that could not be
+// applied, with err, was settled. It is refunded then; if that failed, the
+// student still has to be refunded.
+func refundedAfterRefusal(d *Discrepancy, payment *models.Payment, err error) error {
+	refunded, lookupErr := models.InitPaymentRepo(config.DB).GetByOrderID(payment.OrderID)
+	if lookupErr != nil || refunded.Status != string(models.PaymentRefunded) {
+		return fmt.Errorf("payment could not be applied and the refund did not go through; refund the student: %w", err)
+	}
+	d.Kind = DiscrepancyRefundedNotBooked
+	d.Detail = fmt.Sprintf("gateway payment captured but %s; refunded %d paise", refunded.RefundReason, refunded.RefundedAmount)
+	return nil
+}
+
+// reconcileBookingRecords checks that a paid order produced its session and
+// the wallet entries for the expert's share. These are reported only: fixing
+// them means deciding what the expert is owed.
+func reconcileBookingRecords(report *ReconcileReport, payment *models.Payment) {
+	// Refunded because what it paid for could no longer be had; listed so
+	// the refund is seen, with nothing left to heal
+	if payment.RefundReason != "" {
+		report.add(Discrepancy{
+			Kind:      DiscrepancyRefundedNotBooked,
+			OrderID:   payment.OrderID,
+			PaymentID: payment.PaymentID,
+			Detail:    fmt.Sprintf("refunded %d paise without booking: %s", payment.RefundedAmount, payment.RefundReason),
+			Healed:    true,
+		})
+		return
+	}
+
+	switch payment.Purpose {
+	case models.PaymentForPackage:
+		reconcilePackageRecords(report, payment)
+		return
+	case models.PaymentForSubscription, models.PaymentForRenewal:
+		reconcileSubscriptionRecords(report, payment)
+		return
+	}
+
+	session, err := models.InitSessionRepo(config.DB).GetByOrderID(payment.OrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			report.add(Discrepancy{
+				Kind:      DiscrepancyMissingSession,
+				OrderID:   payment.OrderID,
+				PaymentID: payment.PaymentID,
+				Detail:    fmt.Sprintf("payment is %s but no session was created", payment.Status),
+			})
+		} else {
+			logger.Errorf("reconcile: fetching session for order %s: %v", payment.OrderID, err)
+		}
+		return
+	}
+
+	if payment.ExpertShare == 0 {
+		return
+	}
+
+	entries, err := models.InitWalletTransactionRepo(config.DB).GetByReferenceID(session.SessionUUID)
+	if err != nil {
+		logger.Errorf("reconcile: fetching wallet entries for session %s: %v", session.SessionUUID, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Source == "session" && (entry.Type == "hold" || entry.Type == "credit") {
+			return
+		}
+	}
+
+	report.add(Discrepancy{
+		Kind:      DiscrepancyMissingWalletRows,
+		OrderID:   payment.OrderID,
+		PaymentID: payment.PaymentID,
+		Detail:    fmt.Sprintf("session %s has no wallet entry for the expert's %d paise", session.SessionUUID, payment.ExpertShare),
+	})
+}
+
+// reconcilePackageRecords checks that a paid package order issued its
+// credits.
+func reconcilePackageRecords(report *ReconcileReport, payment *models.Payment) {
+	purchase, err := models.InitPackageRepo(config.DB).GetPurchaseByOrderID(payment.OrderID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Errorf("reconcile: fetching package purchase for order %s: %v", payment.OrderID, err)
+			return
+		}
+		report.add(Discrepancy{
+			Kind:      DiscrepancyMissingCredits,
+			OrderID:   payment.OrderID,
+			PaymentID: payment.PaymentID,
+			Detail:    fmt.Sprintf("payment is %s but has no package purchase", payment.Status),
+		})
+		return
+	}
+
+	credits, err := models.InitSessionCreditRepo(config.DB).ListBySource(models.SessionCreditFromPackage, purchase.ID)
+	if err != nil {
+		logger.Errorf("reconcile: fetching credits for package purchase %d: %v", purchase.ID, err)
+		return
+	}
+
+	if purchase.Status != string(models.StudentPackageActive) || len(credits) != purchase.SessionCount {
+		report.add(Discrepancy{
+			Kind:      DiscrepancyMissingCredits,
+			OrderID:   payment.OrderID,
+			PaymentID: payment.PaymentID,
+			Detail: fmt.Sprintf("package purchase %d is %s with %d of %d credits",
+				purchase.ID, purchase.Status, len(credits), purchase.SessionCount),
+		})
+	}
+}
+
+// reconcileSubscriptionRecords checks that a paid subscription order was
+// applied and issued its credits.
+func reconcileSubscriptionRecords(report *ReconcileReport, payment *models.Payment) {
+	charge, err := models.InitSubscriptionRepo(config.DB).GetChargeByOrderID(payment.OrderID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Errorf("reconcile: fetching subscription charge for order %s: %v", payment.OrderID, err)
+			return
+		}
+		report.add(Discrepancy{
+			Kind:      DiscrepancyMissingCredits,
+			OrderID:   payment.OrderID,
+			PaymentID: payment.PaymentID,
+			Detail:    fmt.Sprintf("payment is %s but has no subscription charge", payment.Status),
+		})
+		return
+	}
+
+	credits, err := models.InitSessionCreditRepo(config.DB).ListBySource(models.SessionCreditFromSubscription, charge.ID)
+	if err != nil {
+		logger.Errorf("reconcile: fetching credits for subscription charge %d: %v", charge.ID, err)
+		return
+	}
+
+	if charge.Status != string(models.SubscriptionChargePaid) || len(credits) != charge.Credits {
+		report.add(Discrepancy{
+			Kind:      DiscrepancyMissingCredits,
+			OrderID:   payment.OrderID,
+			PaymentID: payment.PaymentID,
+			Detail: fmt.Sprintf("subscription charge %d is %s with %d of %d credits",
+				charge.ID, charge.Status, len(credits), charge.Credits),
+		})
+	}
+}
+
+// reconcileLocalPaid confirms with the gateway a local payment marked paid
+// whose capture fell outside the listed window.
+func reconcileLocalPaid(report *ReconcileReport, payment *models.Payment) {
+	gp, err := config.Payments.FetchPayment(payment.PaymentID)
+	if err == nil && gp.OrderID == payment.OrderID && isCaptured(gp.Status) {
+		reconcileBookingRecords(report, payment)
+		return
+	}
+
+	detail := "gateway has no such payment"
+	if err == nil {
+		detail = fmt.Sprintf("gateway payment is %s for order %s", gp.Status, gp.OrderID)
+	} else if !errors.Is(err, payments.ErrPaymentNotFound) {
+		detail = fmt.Sprintf("gateway lookup failed: %v", err)
+	}
+
+	report.add(Discrepancy{
+		Kind:      DiscrepancyNotCaptured,
+		OrderID:   payment.OrderID,
+		PaymentID: payment.PaymentID,
+		Detail:    fmt.Sprintf("local payment is %s but %s", payment.Status, detail),
+	})
+}
+
+// ReconcileRecentPayments reconciles the configured window ending at now and
+// logs every discrepancy.
+func ReconcileRecentPayments(now time.Time) (*ReconcileReport, error) {
+	report, err := ReconcilePayments(now.Add(-config.RuntimeConfig().ReconcileWindow), now, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range report.Discrepancies {
+		if d.Healed {
+			logger.Infof("reconcile: healed %s for order %s (%s)", d.Kind, d.OrderID, d.Detail)
+		} else {
+			logger.Warnf("reconcile: %s for order %s: %s %s", d.Kind, d.OrderID, d.Detail, d.HealError)
+		}
+	}
+	return report, nil
+}
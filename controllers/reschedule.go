@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Student moves a session → POST /student/sessions/:session_uuid/reschedule
+//    ↓
+// BEGIN TX
+//    ├─ Lock session (scheduled, owned by student, within limits)
+//    ├─ Lock old + new slot (ID order)
+//    ├─ Validate new slot (same expert, bookable, in the future)
+//    ├─ Free old slot, book new slot
+//    ├─ Move session times, new meet link
+//    ├─ Re-point payment at the new slot
+// COMMIT
+//
+// No gateway round trip: the original payment stays attached to the session.
+
+var (
+	ErrRescheduleLimitReached = errors.New("session has been rescheduled too many times")
+	ErrRescheduleTooLate      = errors.New("session starts too soon to be rescheduled")
+	ErrInvalidRescheduleSlot  = errors.New("slot must be a different upcoming slot of the same expert")
+)
+
+type RescheduleSessionRequest struct {
+	SlotID uint `json:"slot_id" binding:"required"`
+}
+
+func RescheduleSessionHandler(c *gin.Context) {
+	var req RescheduleSessionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("error in binding reschedule request: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := RescheduleSession(c.GetString("user_uuid"), c.Param("session_uuid"), req.SlotID)
+	if err != nil {
+		logger.Error("error in rescheduling session: ", err)
+		switch {
+		case errors.Is(err, ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotSessionParticipant):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInvalidRescheduleSlot):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrSessionNotCancellable),
+			errors.Is(err, ErrRescheduleLimitReached),
+			errors.Is(err, ErrRescheduleTooLate),
+			errors.Is(err, ErrSlotNotAvailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reschedule session"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func RescheduleSession(studentUUID string, sessionUUID string, targetSlotID uint) (*models.Session, error) {
+	var (
+		tx          = config.DB.Begin()
+		sessionRepo = models.InitSessionRepo(tx)
+		slotRepo    = models.InitAvailabilitySlotRepo(tx)
+		studentRepo = models.InitStudentRepo(tx)
+		paymentRepo = models.InitPaymentRepo(tx)
+		cfg         = config.RuntimeConfig()
+		now         = time.Now()
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	session, err := sessionRepo.GetByUUIDForUpdate(sessionUUID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	if session.StudentUUID != studentUUID {
+		tx.Rollback()
+		return nil, ErrNotSessionParticipant
+	}
+
+	if session.Status != models.SessionScheduled {
+		tx.Rollback()
+		return nil, ErrSessionNotCancellable
+	}
+
+	if session.RescheduleCount >= cfg.MaxReschedulesPerSession {
+		tx.Rollback()
+		return nil, ErrRescheduleLimitReached
+	}
+
+	if session.StartTime.Sub(now) < cfg.RescheduleMinNotice {
+		tx.Rollback()
+		return nil, ErrRescheduleTooLate
+	}
+
+	if targetSlotID == session.SlotID {
+		tx.Rollback()
+		return nil, ErrInvalidRescheduleSlot
+	}
+
+	slots, err := slotRepo.LockByIDsWithTx(tx, []uint{session.SlotID, targetSlotID})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in locking slots for reschedule: ", err)
+		return nil, err
+	}
+
+	var target *models.AvailabilitySlot
+	for i := range slots {
+		if slots[i].ID == targetSlotID {
+			target = &slots[i]
+		}
+	}
+
+	if target == nil || target.ExpertID != session.ExpertUUID || !target.StartTime.After(now) {
+		tx.Rollback()
+		return nil, ErrInvalidRescheduleSlot
+	}
+
+	if target.Status != string(models.SlotAvailable) && !target.HoldExpired(now) {
+		tx.Rollback()
+		return nil, ErrSlotNotAvailable
+	}
+
+	student, err := studentRepo.GetByUserUUID(studentUUID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching student for reschedule: ", err)
+		return nil, err
+	}
+
+	// The session being moved does not count against the new slot
+	if err := checkSchedulingWithTx(tx, target, student.ID, now, session.SessionUUID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := slotRepo.ReleaseWithTx(tx, session.SlotID); err != nil {
+		tx.Rollback()
+		logger.Error("error in releasing old slot: ", err)
+		return nil, err
+	}
+
+	if err := slotRepo.MarkBookedWithTx(tx, target.ID, student.ID); err != nil {
+		tx.Rollback()
+		logger.Error("error in booking new slot: ", err)
+		return nil, err
+	}
+
+	meetLink := generateJitsiMeetLink(session.ExpertUUID, session.StudentUUID, target.StartTime)
+	if err := sessionRepo.Reschedule(session.SessionUUID, target, meetLink); err != nil {
+		tx.Rollback()
+		logger.Error("error in moving session: ", err)
+		return nil, err
+	}
+
+	if session.OrderID != "" {
+		err = paymentRepo.UpdateWithTx(tx,
+			&models.Payment{SlotID: target.ID},
+			&models.Payment{OrderID: session.OrderID})
+		if err != nil {
+			tx.Rollback()
+			logger.Error("error in moving payment to new slot: ", err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	logger.Infof("session %s rescheduled from slot %d to slot %d", session.SessionUUID, session.SlotID, target.ID)
+	return models.InitSessionRepo(config.DB).GetByUUID(session.SessionUUID)
+}
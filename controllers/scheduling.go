@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/utils"
+	"net/http"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// An expert's scheduling limits decide which of their slots students may
+// book. Slot listings leave out slots that break them, and every booking
+// checks them again with the expert locked, since sessions booked in the
+// meantime can use up a day or take the time next to a slot.
+
+// Why a slot cannot be booked under the expert's limits. They wrap
+// ErrSlotNotAvailable, so callers treat them like a taken slot.
+var (
+	ErrBookingTooSoon        = fmt.Errorf("%w: it starts too soon to be booked", ErrSlotNotAvailable)
+	ErrBookingTooFarAhead    = fmt.Errorf("%w: it is too far ahead to be booked", ErrSlotNotAvailable)
+	ErrBookingBuffer         = fmt.Errorf("%w: it is too close to another session of the expert", ErrSlotNotAvailable)
+	ErrExpertDayFullyBooked  = fmt.Errorf("%w: the expert is fully booked that day", ErrSlotNotAvailable)
+	ErrExpertWeekFullyBooked = fmt.Errorf("%w: the expert is fully booked that week", ErrSlotNotAvailable)
+	ErrSlotStarted           = fmt.Errorf("%w: it has already started", ErrSlotNotAvailable)
+)
+
+// expertSchedule is an expert's limits together with their booked sessions
+// and the slots held for open orders around the slots being checked. Holds
+// count like sessions, so two checkouts cannot both take the last place in
+// a day. priorityDays extends the expert's booking window for a subscribed
+// student.
+type expertSchedule struct {
+	expert       *models.Expert
+	loc          *time.Location
+	sessions     []models.Session
+	holds        []models.AvailabilitySlot
+	priorityDays int
+}
+
+// startOfDay returns midnight of t's calendar day in loc.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// startOfWeek returns midnight of the Monday of t's week in loc.
+func startOfWeek(t time.Time, loc *time.Location) time.Time {
+	day := startOfDay(t, loc)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// loadExpertScheduleWithTx loads what is needed to check the expert's slots
+// starting in [from, to) for the student, or for no one in particular when
+// studentID is 0. The session skipSessionUUID, one being moved to another
+// slot, is left out.
+func loadExpertScheduleWithTx(tx *gorm.DB, expert *models.Expert, studentID uint, from time.Time, to time.Time, skipSessionUUID string) (*expertSchedule, error) {
+	schedule := &expertSchedule{expert: expert, loc: utils.UserLocation(tx, expert.UserID)}
+	if expert.MaxAdvanceDays > 0 && studentID != 0 {
+		days, err := priorityBookingDays(tx, studentID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		schedule.priorityDays = days
+	}
+
+	if expert.BufferMinutes <= 0 && expert.MaxSessionsPerDay <= 0 && expert.MaxSessionsPerWeek <= 0 {
+		return schedule, nil
+	}
+
+	// Wide enough for the buffer and for whole weeks around the slots
+	buffer := time.Duration(expert.BufferMinutes) * time.Minute
+	windowStart := startOfWeek(from, schedule.loc).Add(-buffer)
+	windowEnd := startOfWeek(to, schedule.loc).AddDate(0, 0, 7).Add(buffer)
+
+	sessions, err := models.InitSessionRepo(tx).ListBookedForExpertBetween(expert.UserID, windowStart, windowEnd)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.SessionUUID != skipSessionUUID {
+			schedule.sessions = append(schedule.sessions, session)
+		}
+	}
+
+	schedule.holds, err = models.InitAvailabilitySlotRepo(tx).ListLiveHoldsWithTx(tx, expert.UserID, windowStart, windowEnd, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// check returns why the slot cannot be booked at now, or nil.
+func (s *expertSchedule) check(slot *models.AvailabilitySlot, now time.Time) error {
+	expert := s.expert
+
+	if expert.MinNoticeMinutes > 0 && slot.StartTime.Before(now.Add(time.Duration(expert.MinNoticeMinutes)*time.Minute)) {
+		return ErrBookingTooSoon
+	}
+
+	if expert.MaxAdvanceDays > 0 {
+		lastDayEnd := startOfDay(now, s.loc).AddDate(0, 0, expert.MaxAdvanceDays+s.priorityDays+1)
+		if !slot.StartTime.Before(lastDayEnd) {
+			return ErrBookingTooFarAhead
+		}
+	}
+
+	buffer := time.Duration(expert.BufferMinutes) * time.Minute
+	day, week := startOfDay(slot.StartTime, s.loc), startOfWeek(slot.StartTime, s.loc)
+	var sameDay, sameWeek int
+	taken := func(start time.Time, end time.Time) bool {
+		if buffer > 0 && start.Before(slot.EndTime.Add(buffer)) && end.After(slot.StartTime.Add(-buffer)) {
+			return true
+		}
+		if startOfDay(start, s.loc).Equal(day) {
+			sameDay++
+		}
+		if startOfWeek(start, s.loc).Equal(week) {
+			sameWeek++
+		}
+		return false
+	}
+	for _, session := range s.sessions {
+		if taken(session.StartTime, session.EndTime) {
+			return ErrBookingBuffer
+		}
+	}
+	for _, hold := range s.holds {
+		// The slot's own hold, for the order being opened or booked
+		if hold.ID != slot.ID && taken(hold.StartTime, hold.EndTime) {
+			return ErrBookingBuffer
+		}
+	}
+
+	if expert.MaxSessionsPerDay > 0 && sameDay >= expert.MaxSessionsPerDay {
+		return ErrExpertDayFullyBooked
+	}
+	if expert.MaxSessionsPerWeek > 0 && sameWeek >= expert.MaxSessionsPerWeek {
+		return ErrExpertWeekFullyBooked
+	}
+	return nil
+}
+
+// checkSchedulingWithTx locks the slot's expert and returns why the student
+// cannot book the slot at now under the expert's limits, or nil. Pass the
+// UUID of a session being moved to the slot as skipSessionUUID.
+func checkSchedulingWithTx(tx *gorm.DB, slot *models.AvailabilitySlot, studentID uint, now time.Time, skipSessionUUID string) error {
+	expert, err := models.InitExpertRepo(tx).GetForUpdateWithTx(tx, slot.ExpertID)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := loadExpertScheduleWithTx(tx, expert, studentID, slot.StartTime, slot.EndTime, skipSessionUUID)
+	if err != nil {
+		return err
+	}
+	return schedule.check(slot, now)
+}
+
+// bookableSlots leaves out the expert's slots that the student, or anyone
+// when studentID is 0, cannot book at now under the expert's limits.
+func bookableSlots(expert *models.Expert, slots []models.AvailabilitySlot, studentID uint, now time.Time) ([]models.AvailabilitySlot, error) {
+	if len(slots) == 0 {
+		return slots, nil
+	}
+
+	from, to := slots[0].StartTime, slots[0].EndTime
+	for _, slot := range slots[1:] {
+		if slot.StartTime.Before(from) {
+			from = slot.StartTime
+		}
+		if slot.EndTime.After(to) {
+			to = slot.EndTime
+		}
+	}
+
+	schedule, err := loadExpertScheduleWithTx(config.DB, expert, studentID, from, to, "")
+	if err != nil {
+		return nil, err
+	}
+
+	bookable := make([]models.AvailabilitySlot, 0, len(slots))
+	for i := range slots {
+		if schedule.check(&slots[i], now) == nil {
+			bookable = append(bookable, slots[i])
+		}
+	}
+	return bookable, nil
+}
+
+// SchedulingRequest sets all of the expert's scheduling limits; 0 (or
+// leaving a field out) removes that limit.
+type SchedulingRequest struct {
+	BufferMinutes      int `json:"buffer_minutes"`
+	MaxSessionsPerDay  int `json:"max_sessions_per_day"`
+	MaxSessionsPerWeek int `json:"max_sessions_per_week"`
+	MinNoticeMinutes   int `json:"min_notice_minutes"`
+	MaxAdvanceDays     int `json:"max_advance_days"`
+}
+
+func GetSchedulingHandler(c *gin.Context) {
+	expert, err := models.InitExpertRepo(config.DB).GetWithTx(config.DB, &models.Expert{UserID: c.GetString("user_uuid")})
+	if err != nil {
+		logger.Error("error in fetching expert: ", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expert not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SchedulingRequest{
+		BufferMinutes:      expert.BufferMinutes,
+		MaxSessionsPerDay:  expert.MaxSessionsPerDay,
+		MaxSessionsPerWeek: expert.MaxSessionsPerWeek,
+		MinNoticeMinutes:   expert.MinNoticeMinutes,
+		MaxAdvanceDays:     expert.MaxAdvanceDays,
+	})
+}
+
+// UpdateSchedulingHandler replaces the expert's scheduling limits. Sessions
+// already booked are kept even if they break the new limits.
+func UpdateSchedulingHandler(c *gin.Context) {
+	var req SchedulingRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.BufferMinutes < 0 || req.MaxSessionsPerDay < 0 || req.MaxSessionsPerWeek < 0 ||
+		req.MinNoticeMinutes < 0 || req.MaxAdvanceDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limits must not be negative"})
+		return
+	}
+
+	err := models.InitExpertRepo(config.DB).UpdateScheduling(c.GetString("user_uuid"), map[string]interface{}{
+		"buffer_minutes":        req.BufferMinutes,
+		"max_sessions_per_day":  req.MaxSessionsPerDay,
+		"max_sessions_per_week": req.MaxSessionsPerWeek,
+		"min_notice_minutes":    req.MinNoticeMinutes,
+		"max_advance_days":      req.MaxAdvanceDays,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Expert not found"})
+			return
+		}
+		logger.Error("error in updating scheduling limits: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
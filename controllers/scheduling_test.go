@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/models"
+	"testing"
+	"time"
+)
+
+func TestExpertScheduleCheck(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Monday 2 March 2026, 09:00 in the expert's zone
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, loc)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, loc)
+	}
+	slot := func(id uint, start time.Time) models.AvailabilitySlot {
+		return models.AvailabilitySlot{ID: id, StartTime: start, EndTime: start.Add(time.Hour)}
+	}
+	session := func(start time.Time) models.Session {
+		return models.Session{StartTime: start, EndTime: start.Add(time.Hour)}
+	}
+
+	tests := []struct {
+		name         string
+		expert       models.Expert
+		sessions     []models.Session
+		holds        []models.AvailabilitySlot
+		priorityDays int
+		slot         models.AvailabilitySlot
+		want         error
+	}{
+		{
+			name: "no limits",
+			sessions: []models.Session{
+				session(at(3, 10, 0)), session(at(3, 11, 0)),
+			},
+			slot: slot(1, at(3, 12, 0)),
+		},
+		{
+			name:   "too soon",
+			expert: models.Expert{MinNoticeMinutes: 60},
+			slot:   slot(1, at(2, 9, 30)),
+			want:   ErrBookingTooSoon,
+		},
+		{
+			name:   "just enough notice",
+			expert: models.Expert{MinNoticeMinutes: 60},
+			slot:   slot(1, at(2, 10, 0)),
+		},
+		{
+			name:   "last day of the booking window",
+			expert: models.Expert{MaxAdvanceDays: 7},
+			slot:   slot(1, at(9, 23, 0)),
+		},
+		{
+			name:   "past the booking window",
+			expert: models.Expert{MaxAdvanceDays: 7},
+			slot:   slot(1, at(10, 0, 0)),
+			want:   ErrBookingTooFarAhead,
+		},
+		{
+			name:         "subscriber inside the longer window",
+			expert:       models.Expert{MaxAdvanceDays: 7},
+			priorityDays: 3,
+			slot:         slot(1, at(12, 23, 0)),
+		},
+		{
+			name:         "subscriber past the longer window",
+			expert:       models.Expert{MaxAdvanceDays: 7},
+			priorityDays: 3,
+			slot:         slot(1, at(13, 0, 0)),
+			want:         ErrBookingTooFarAhead,
+		},
+		{
+			name:     "inside another session's buffer",
+			expert:   models.Expert{BufferMinutes: 15},
+			sessions: []models.Session{session(at(3, 10, 0))},
+			slot:     slot(1, at(3, 11, 10)),
+			want:     ErrBookingBuffer,
+		},
+		{
+			name:     "clear of another session's buffer",
+			expert:   models.Expert{BufferMinutes: 15},
+			sessions: []models.Session{session(at(3, 10, 0))},
+			slot:     slot(1, at(3, 11, 15)),
+		},
+		{
+			name:   "inside another checkout's buffer",
+			expert: models.Expert{BufferMinutes: 15},
+			holds:  []models.AvailabilitySlot{slot(2, at(3, 12, 20))},
+			slot:   slot(1, at(3, 11, 10)),
+			want:   ErrBookingBuffer,
+		},
+		{
+			name:   "the slot's own hold",
+			expert: models.Expert{BufferMinutes: 15, MaxSessionsPerDay: 1},
+			holds:  []models.AvailabilitySlot{slot(1, at(3, 11, 0))},
+			slot:   slot(1, at(3, 11, 0)),
+		},
+		{
+			name:   "day full",
+			expert: models.Expert{MaxSessionsPerDay: 2},
+			sessions: []models.Session{
+				session(at(3, 8, 0)), session(at(3, 18, 0)),
+			},
+			slot: slot(1, at(3, 12, 0)),
+			want: ErrExpertDayFullyBooked,
+		},
+		{
+			name:     "day full with a checkout in progress",
+			expert:   models.Expert{MaxSessionsPerDay: 2},
+			sessions: []models.Session{session(at(3, 8, 0))},
+			holds:    []models.AvailabilitySlot{slot(2, at(3, 18, 0))},
+			slot:     slot(1, at(3, 12, 0)),
+			want:     ErrExpertDayFullyBooked,
+		},
+		{
+			// 23:30 on the 2nd in Kolkata is 18:00 UTC, the same UTC day as the slot
+			name:   "days are counted in the expert's zone",
+			expert: models.Expert{MaxSessionsPerDay: 1},
+			sessions: []models.Session{
+				session(at(2, 23, 30)),
+			},
+			slot: slot(1, at(3, 6, 0)),
+		},
+		{
+			name:   "week full",
+			expert: models.Expert{MaxSessionsPerWeek: 3},
+			sessions: []models.Session{
+				session(at(2, 12, 0)), session(at(4, 12, 0)), session(at(8, 12, 0)),
+			},
+			slot: slot(1, at(6, 12, 0)),
+			want: ErrExpertWeekFullyBooked,
+		},
+		{
+			name:   "previous week not counted",
+			expert: models.Expert{MaxSessionsPerWeek: 1},
+			sessions: []models.Session{
+				session(at(1, 12, 0)),
+			},
+			slot: slot(1, at(3, 12, 0)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := &expertSchedule{expert: &tt.expert, loc: loc, sessions: tt.sessions, holds: tt.holds, priorityDays: tt.priorityDays}
+			err := schedule.check(&tt.slot, now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("check() = %v, want %v", err, tt.want)
+			}
+			if err != nil && !errors.Is(err, ErrSlotNotAvailable) {
+				t.Errorf("check() = %v, does not wrap ErrSlotNotAvailable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What happened to a generated slot
+const (
+	SlotPlacementCreated   = "created"
+	SlotPlacementDuplicate = "duplicate" // the expert already has a slot at exactly this time
+	SlotPlacementConflict  = "conflict"  // it overlaps another slot of the expert
+	SlotPlacementBlackout  = "blackout"  // it falls in one of the expert's blackouts
+)
+
+type SlotPlacement struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Result    string    `json:"result"`
+	SlotID    uint      `json:"slot_id,omitempty"` // the slot created, or the one in the way
+}
+
+// placeSlotsWithTx creates the candidate slots of one expert that overlap
+// neither the expert's existing active slots, each other, nor a blackout,
+// and reports what happened to each. With keepCancelled, cancelled slots
+// are in the way too, so an expert's cancellations are not undone by
+// regeneration. The created slots are returned with their IDs.
+//
+// Overlaps are checked here first; a slot created concurrently by another
+// request is caught by the database constraint and reported as a conflict.
+func placeSlotsWithTx(tx *gorm.DB, expertID string, candidates []models.AvailabilitySlot, keepCancelled bool) ([]models.AvailabilitySlot, []SlotPlacement, error) {
+	if len(candidates) == 0 {
+		return nil, nil, nil
+	}
+
+	slotRepo := models.InitAvailabilitySlotRepo(tx)
+
+	from, to := candidates[0].StartTime, candidates[0].EndTime
+	for _, candidate := range candidates[1:] {
+		if candidate.StartTime.Before(from) {
+			from = candidate.StartTime
+		}
+		if candidate.EndTime.After(to) {
+			to = candidate.EndTime
+		}
+	}
+
+	existing, err := slotRepo.ListOverlappingWithTx(tx, expertID, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blackouts, err := models.InitBlackoutRepo(tx).ListOverlappingWithTx(tx, expertID, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	taken := make([]models.AvailabilitySlot, 0, len(existing)+len(candidates))
+	for _, slot := range existing {
+		if keepCancelled || slot.Active() {
+			taken = append(taken, slot)
+		}
+	}
+
+	var (
+		created    []models.AvailabilitySlot
+		placements = make([]SlotPlacement, 0, len(candidates))
+	)
+	for _, candidate := range candidates {
+		placement := SlotPlacement{StartTime: candidate.StartTime, EndTime: candidate.EndTime}
+
+		var blackout *models.Blackout
+		for i := range blackouts {
+			if blackouts[i].StartsAt.Before(candidate.EndTime) && blackouts[i].EndsAt.After(candidate.StartTime) {
+				blackout = &blackouts[i]
+				break
+			}
+		}
+
+		var blocking *models.AvailabilitySlot
+		for i := range taken {
+			if taken[i].StartTime.Before(candidate.EndTime) && taken[i].EndTime.After(candidate.StartTime) {
+				blocking = &taken[i]
+				break
+			}
+		}
+
+		switch {
+		case blackout != nil:
+			placement.Result = SlotPlacementBlackout
+
+		case blocking != nil && blocking.StartTime.Equal(candidate.StartTime) && blocking.EndTime.Equal(candidate.EndTime):
+			placement.Result, placement.SlotID = SlotPlacementDuplicate, blocking.ID
+
+		case blocking != nil:
+			placement.Result, placement.SlotID = SlotPlacementConflict, blocking.ID
+
+		default:
+			err := slotRepo.InsertWithTx(tx, &candidate)
+			if errors.Is(err, models.ErrSlotOverlap) {
+				placement.Result = SlotPlacementConflict
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			placement.Result, placement.SlotID = SlotPlacementCreated, candidate.ID
+			created = append(created, candidate)
+			taken = append(taken, candidate)
+		}
+
+		placements = append(placements, placement)
+	}
+	return created, placements, nil
+}
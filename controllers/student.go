@@ -6,7 +6,9 @@ import (
 	"interviewexcel-backend-go/config"
 	"interviewexcel-backend-go/models"
 	logger "interviewexcel-backend-go/pkg/errors"
+	"interviewexcel-backend-go/utils"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/datatypes"
@@ -68,12 +70,14 @@ func GetStudentProfile(c *gin.Context) {
 		FullName:     user.FullName,
 		Email:        user.Email,
 		Phone:        safeString(user.Phone),
+		TimeZone:     utils.LoadLocation(user.TimeZone).String(),
 		Bio:          student.Bio,
 		PreparingFor: student.PreparingFor,
 		Sessions:     student.Sessions,
 		Points:       student.Points,
 		DateOfBirth:  student.DateOfBirth,
 		City:         student.City,
+		State:        student.State,
 		AboutMe:      student.AboutMe,
 		Skills:       skills,
 	}
@@ -102,6 +106,11 @@ func UpdateStudentProfile(c *gin.Context) {
 		return
 	}
 
+	if request.TimeZone != "" && !utils.ValidTimeZone(request.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time_zone must be an IANA time zone such as Asia/Kolkata"})
+		return
+	}
+
 	tx := config.DB.Begin()
 	if tx.Error != nil {
 		logger.Error("failed to start transaction: ", tx.Error)
@@ -133,6 +142,7 @@ func UpdateStudentProfile(c *gin.Context) {
 		"preparing_for": request.PreparingFor,
 		"date_of_birth": request.DateOfBirth,
 		"city":          request.City,
+		"state":         request.State,
 		"about_me":      request.AboutMe,
 		"skills":        datatypes.JSON(skillsJSON),
 	}
@@ -146,6 +156,7 @@ func UpdateStudentProfile(c *gin.Context) {
 	if err := userRepo.UpdateByUserUUID(userUUID, &models.User{
 		FullName: request.FullName,
 		Phone:    &request.Phone,
+		TimeZone: request.TimeZone,
 	}); err != nil {
 		tx.Rollback()
 		logger.Error("error updating user: ", err)
@@ -166,7 +177,7 @@ func GetAllExpertsHandler(c *gin.Context) {
 	var (
 		expertRepo = models.InitExpertRepo(config.DB)
 	)
-	experts, err := expertRepo.GetAllExpertsWithUserDetails()
+	experts, err := expertRepo.GetAvailableExpertsWithUserDetails()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch experts"})
 		return
@@ -181,13 +192,44 @@ func GetAvailableSlotsForExpertHandler(c *gin.Context) {
 	)
 	expertIDStr := c.Param("id")
 
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	slots, err := availabilityRepo.GetAvailableByExpert((expertIDStr))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch slots"})
 		return
 	}
 
-	c.JSON(http.StatusOK, slots)
+	// Leave out slots the expert's scheduling limits do not allow booking now
+	if len(slots) > 0 {
+		expert, err := models.InitExpertRepo(config.DB).GetWithTx(config.DB, &models.Expert{UserID: expertIDStr})
+		if err != nil {
+			logger.Error("error in fetching expert for slots: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch slots"})
+			return
+		}
+		// A subscribed student may see further ahead; on the expert's own
+		// listing there is no student
+		var studentID uint
+		if userUUID, ok := c.Get("user_uuid"); ok {
+			if uuid, ok := userUUID.(string); ok {
+				if student, err := models.InitStudentRepo(config.DB).GetByUserUUID(uuid); err == nil {
+					studentID = student.ID
+				}
+			}
+		}
+		if slots, err = bookableSlots(expert, slots, studentID, time.Now()); err != nil {
+			logger.Error("error in applying scheduling limits: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch slots"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, slotsIn(slots, loc))
 }
 
 // FIXME: Expert name is not Received in response
@@ -207,6 +249,12 @@ func GetStudentSessions(c *gin.Context) {
 		return
 	}
 
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	sessions, err := sessionRepo.GetByStudentUUID(uuid)
 	if err != nil {
 		logger.Error("error in getting student sessions: ", err)
@@ -243,9 +291,8 @@ func GetStudentSessions(c *gin.Context) {
 			ExpertUUID:        session.ExpertUUID,
 			ExpertName:        expertName,
 			ProfilePictureUrl: expertPic,
-			StartTime:         session.StartTime,
-			EndTime:           session.EndTime,
-			MeetLink:          session.MeetLink,
+			StartTime:         session.StartTime.In(loc),
+			EndTime:           session.EndTime.In(loc),
 			Status:            session.Status,
 		})
 	}
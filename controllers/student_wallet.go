@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Student wallets hold credits from refunds, promotions and referrals. Each
+// credit is a WalletCredit with its own expiry, next to the usual
+// WalletTransaction and ledger entries:
+//
+//   grant     → credit the wallet, new WalletCredit
+//   checkout  → debit the wallet into the checkout clearing account, taking
+//               the amount off the credits closest to expiry
+//   order expires unpaid → credit the same amount back onto the same credits
+//   credit expires       → debit what is left of it
+//
+// The gateway needs at least minGatewayAmountInPaise, so a partial wallet
+// payment always leaves at least that much for Razorpay.
+
+const (
+	minGatewayAmountInPaise = 100
+	walletExpiryBatchSize   = 100
+)
+
+// grantWalletCredit adds a credit to the student's wallet, funded by
+// counterAccount.
+func grantWalletCredit(tx *gorm.DB, userUUID string, amount int64, source string, referenceID string, description string, expiresAt *time.Time, counterAccount string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	err := moveWalletFunds(tx, walletMovement{
+		UserUUID:       userUUID,
+		Balance:        models.LedgerBalanceAvailable,
+		AmountInPaise:  amount,
+		CounterAccount: counterAccount,
+		Type:           "credit",
+		Source:         source,
+		ReferenceID:    referenceID,
+		Description:    description,
+		ExpiresAt:      expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return models.InitWalletCreditRepo(tx).CreateWithTx(tx, &models.WalletCredit{
+		UserUUID:         userUUID,
+		Source:           source,
+		ReferenceID:      referenceID,
+		Description:      description,
+		AmountInPaise:    amount,
+		RemainingInPaise: amount,
+		ExpiresAt:        expiresAt,
+	})
+}
+
+// spendableWalletBalance locks the student's unexpired credits and returns
+// what they add up to.
+func spendableWalletBalance(tx *gorm.DB, userUUID string, now time.Time) ([]models.WalletCredit, int64, error) {
+	credits, err := models.InitWalletCreditRepo(tx).LockSpendableWithTx(tx, userUUID, now)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	for _, credit := range credits {
+		total += credit.RemainingInPaise
+	}
+	return credits, total, nil
+}
+
+// spendWalletCredits pays amount of the order from the student's wallet.
+// It fails with ErrInsufficientBalance when the unexpired credits do not
+// cover it.
+func spendWalletCredits(tx *gorm.DB, userUUID string, amount int64, orderID string, now time.Time) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	credits, total, err := spendableWalletBalance(tx, userUUID, now)
+	if err != nil {
+		return err
+	}
+	if total < amount {
+		return ErrInsufficientBalance
+	}
+
+	err = moveWalletFunds(tx, walletMovement{
+		UserUUID:       userUUID,
+		Balance:        models.LedgerBalanceAvailable,
+		AmountInPaise:  -amount,
+		CounterAccount: models.LedgerCheckoutAccount,
+		RequireFunds:   true,
+		Type:           "debit",
+		Source:         "checkout",
+		ReferenceID:    orderID,
+		Description:    "Wallet payment for session booking",
+	})
+	if err != nil {
+		return err
+	}
+
+	creditRepo := models.InitWalletCreditRepo(tx)
+	left := amount
+	for _, credit := range credits {
+		if left == 0 {
+			break
+		}
+		take := min(left, credit.RemainingInPaise)
+		if err := creditRepo.SpendWithTx(tx, credit.ID, orderID, take); err != nil {
+			return err
+		}
+		left -= take
+	}
+	return nil
+}
+
+// releaseWalletCredits gives back what an unpaid order took from the
+// student's wallet, onto the credits it came from.
+func releaseWalletCredits(tx *gorm.DB, userUUID string, orderID string, now time.Time) (int64, error) {
+	released, err := models.InitWalletCreditRepo(tx).ReleaseUsesWithTx(tx, orderID, now)
+	if err != nil || released == 0 {
+		return 0, err
+	}
+
+	err = moveWalletFunds(tx, walletMovement{
+		UserUUID:       userUUID,
+		Balance:        models.LedgerBalanceAvailable,
+		AmountInPaise:  released,
+		CounterAccount: models.LedgerCheckoutAccount,
+		Type:           "credit",
+		Source:         "checkout",
+		ReferenceID:    orderID,
+		Description:    "Wallet payment returned, order was not completed",
+	})
+	return released, err
+}
+
+// walletAmountFor decides how much of a price the wallet pays: all of it
+// when the balance covers it, otherwise as much as leaves the gateway an
+// amount it accepts.
+func walletAmountFor(balance int64, price uint) uint {
+	if balance <= 0 {
+		return 0
+	}
+	if balance >= int64(price) {
+		return price
+	}
+	if int64(price)-balance >= minGatewayAmountInPaise {
+		return uint(balance)
+	}
+	if price <= minGatewayAmountInPaise {
+		return 0
+	}
+	return price - minGatewayAmountInPaise
+}
+
+// ExpireWalletCredits forfeits what is left of credits past their expiry.
+// Like the payment sweeper, batches are claimed with SKIP LOCKED so several
+// instances can run it at once. It returns how many credits expired.
+func ExpireWalletCredits(now time.Time) (int, error) {
+	expired := 0
+	for {
+		n, err := expireWalletCreditBatch(now)
+		expired += n
+		if err != nil || n < walletExpiryBatchSize {
+			return expired, err
+		}
+	}
+}
+
+func expireWalletCreditBatch(now time.Time) (int, error) {
+	var (
+		tx         = config.DB.Begin()
+		creditRepo = models.InitWalletCreditRepo(tx)
+	)
+
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	credits, err := creditRepo.LockExpiredWithTx(tx, now, walletExpiryBatchSize)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in locking expired wallet credits: ", err)
+		return 0, err
+	}
+
+	for _, credit := range credits {
+		err := moveWalletFunds(tx, walletMovement{
+			UserUUID:       credit.UserUUID,
+			Balance:        models.LedgerBalanceAvailable,
+			AmountInPaise:  -credit.RemainingInPaise,
+			CounterAccount: models.LedgerExpiredCreditsAccount,
+			Type:           "debit",
+			Source:         "expiry",
+			ReferenceID:    fmt.Sprintf("wallet_credit_%d", credit.ID),
+			Description:    fmt.Sprintf("Expired %s credit", credit.Source),
+		})
+		if err != nil {
+			tx.Rollback()
+			logger.Errorf("error in expiring wallet credit %d: %v", credit.ID, err)
+			return 0, err
+		}
+
+		if err := creditRepo.MarkExpiredWithTx(tx, credit.ID, now); err != nil {
+			tx.Rollback()
+			logger.Errorf("error in marking wallet credit %d expired: %v", credit.ID, err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return len(credits), nil
+}
+
+type StudentWalletResponse struct {
+	BalanceInPaise int64                 `json:"balance_in_paise"`
+	Credits        []models.WalletCredit `json:"credits"` // with money left, soonest to expire first
+}
+
+// GetStudentWalletHandler shows the student's wallet balance and the
+// credits it is made of.
+func GetStudentWalletHandler(c *gin.Context) {
+	userUUID := c.GetString("user_uuid")
+
+	credits, err := models.InitWalletCreditRepo(config.DB).ListActiveByUser(userUUID, time.Now())
+	if err != nil {
+		logger.Error("error in listing wallet credits: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	resp := StudentWalletResponse{Credits: credits}
+	for _, credit := range credits {
+		resp.BalanceInPaise += credit.RemainingInPaise
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+type GrantWalletCreditRequest struct {
+	AmountInPaise int64      `json:"amount_in_paise" binding:"required"`
+	Source        string     `json:"source" binding:"required"` // promotion, referral
+	Description   string     `json:"description"`
+	ReferenceID   string     `json:"reference_id"` // e.g. the referred user
+	ExpiresAt     *time.Time `json:"expires_at"`   // defaults to WALLET_PROMO_CREDIT_VALIDITY_DAYS from now
+}
+
+// GrantWalletCreditHandler adds a promotional or referral credit to a
+// student's wallet.
+func GrantWalletCreditHandler(c *gin.Context) {
+	var req GrantWalletCreditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case req.AmountInPaise <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount_in_paise must be positive"})
+		return
+	case req.Source != models.WalletCreditFromPromotion && req.Source != models.WalletCreditFromReferral:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be promotion or referral"})
+		return
+	case req.ExpiresAt != nil && !req.ExpiresAt.After(now):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	student, err := models.InitStudentRepo(config.DB).GetByUserUUID(c.Param("user_uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil {
+		t := now.Add(config.RuntimeConfig().WalletPromoCreditValidity)
+		expiresAt = &t
+	}
+
+	description := strings.TrimSpace(req.Description)
+	if description == "" {
+		description = fmt.Sprintf("%s%s credit", strings.ToUpper(req.Source[:1]), req.Source[1:])
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = grantWalletCredit(tx, student.UserID, req.AmountInPaise, req.Source, req.ReferenceID, description,
+		expiresAt, models.LedgerPromotionsAccount)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in granting wallet credit: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("error in committing wallet credit: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	logger.Infof("%s credit of %d paise granted to %s by %s", req.Source, req.AmountInPaise, student.UserID, c.GetString("user_uuid"))
+	c.JSON(http.StatusCreated, gin.H{"message": "credit granted", "expires_at": expiresAt})
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import "testing"
+
+func TestWalletAmountFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int64
+		price   uint
+		want    uint
+	}{
+		{"empty wallet", 0, 3000, 0},
+		{"negative balance", -5, 3000, 0},
+		{"covers the price", 5000, 3000, 3000},
+		{"exactly the price", 3000, 3000, 3000},
+		{"part of the price", 1000, 3000, 1000},
+		{"leaves the gateway its minimum", 2950, 3000, 2900},
+		{"leaves exactly the minimum", 2900, 3000, 2900},
+		{"price below the gateway minimum", 50, 80, 0},
+		{"price at the gateway minimum", 50, minGatewayAmountInPaise, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := walletAmountFor(tt.balance, tt.price); got != tt.want {
+				t.Errorf("walletAmountFor(%d, %d) = %d, want %d", tt.balance, tt.price, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1222 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Student subscribes to a plan
+//    ↓
+// Gateway order (purpose "subscription"), pending Subscription and its first
+// SubscriptionCharge
+//    ↓
+// Payment success (client confirm, webhook or reconcile)
+//    ↓
+// BEGIN TX
+//    ├─ Lock payment, charge and subscription
+//    ├─ Start the period (first charge), move to it (renewal) or switch plan
+//    │  (upgrade)
+//    ├─ One SessionCredit per session, expiring with the period
+//    ├─ Ledger: gateway → prepaid session credits
+//    ├─ Invoice
+// COMMIT
+//
+// The renewal job opens a renewal order (purpose "renewal") when a period
+// ends and marks the subscription past_due. The order stays payable for
+// SUBSCRIPTION_GRACE_DAYS; the subscription lapses if it is not paid by
+// then. A subscription cancelled at period end simply ends instead of
+// renewing. Subscription credits are spent like package credits.
+
+// subscriptionBatchSize bounds how many subscriptions one transaction lapses.
+const subscriptionBatchSize = 100
+
+var (
+	ErrPlanNotFound           = errors.New("plan not found")
+	ErrPlanInactive           = errors.New("plan is no longer offered")
+	ErrAlreadySubscribed      = errors.New("student already has a subscription; upgrade it instead")
+	ErrNoSubscription         = errors.New("no subscription found")
+	ErrSubscriptionNotActive  = errors.New("subscription is not active")
+	ErrNotAnUpgrade           = errors.New("plan must have the same period and more sessions for a higher price")
+	ErrSubscriptionChargeVoid = errors.New("subscription charge is no longer payable")
+	ErrSubscriptionChanged    = errors.New("subscription changed while the order was opened; try again")
+)
+
+type SubscriptionOrderResponse struct {
+	Provider       string `json:"provider"` // razorpay, fake
+	OrderID        string `json:"order_id"`
+	SubscriptionID uint   `json:"subscription_id"`
+	Kind           string `json:"kind"` // first, renewal, upgrade
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+	Key            string `json:"key"`
+}
+
+func subscriptionOrderResponse(charge *models.SubscriptionCharge) *SubscriptionOrderResponse {
+	return &SubscriptionOrderResponse{
+		Provider:       config.Payments.Name(),
+		OrderID:        charge.OrderID,
+		SubscriptionID: charge.SubscriptionID,
+		Kind:           charge.Kind,
+		Amount:         charge.AmountInPaise,
+		Currency:       "INR",
+		Key:            config.Payments.KeyID(),
+	}
+}
+
+// openSubscriptionOrder opens the gateway order for a charge on the plan.
+// Like CreatePaymentOrder it is called before the transaction that records
+// the charge, so no lock is held while the gateway answers; an order left
+// over when that transaction fails is never paid and is ignored by
+// reconciliation.
+func openSubscriptionOrder(planID uint, amountInPaise int64) (string, error) {
+	order, err := config.Payments.CreateOrder(amountInPaise, "INR", fmt.Sprintf("plan_%d", planID))
+	if err != nil {
+		logger.Error("error in opening subscription order: ", err)
+		return "", err
+	}
+	return order.ID, nil
+}
+
+// recordSubscriptionChargeWithTx records the charge, to be paid through the
+// gateway order opened for it, with its Payment.
+func recordSubscriptionChargeWithTx(tx *gorm.DB, studentID uint, purpose string, charge *models.SubscriptionCharge, orderID string) error {
+	charge.OrderID = orderID
+	charge.Status = string(models.SubscriptionChargePending)
+
+	// No expert yet, so the invoice splits the price at the default commission
+	platformFee, expertShare := splitSessionFee(uint(charge.AmountInPaise), commissionPercentFor(&models.Expert{}))
+
+	err := models.InitPaymentRepo(tx).Create(&models.Payment{
+		OrderID:     orderID,
+		Status:      string(models.PaymentCreated),
+		Purpose:     purpose,
+		StudentID:   studentID,
+		Amount:      uint(charge.AmountInPaise),
+		PlatformFee: platformFee,
+		ExpertShare: expertShare,
+		Currency:    "INR",
+	})
+	if err != nil {
+		logger.Error("error in storing payment for subscription charge: ", err)
+		return err
+	}
+
+	return models.InitSubscriptionRepo(tx).CreateChargeWithTx(tx, charge)
+}
+
+// expireOpenOrdersWithTx expires the orders of voided charges that are still
+// waiting for payment, so a late payment is not mistaken for a live one.
+func expireOpenOrdersWithTx(tx *gorm.DB, orderIDs []string, at time.Time) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	paymentRepo := models.InitPaymentRepo(tx)
+	payments, err := paymentRepo.GetByOrderIDs(orderIDs)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, 0, len(payments))
+	for _, payment := range payments {
+		if payment.Status == string(models.PaymentCreated) || payment.Status == string(models.PaymentFailed) {
+			ids = append(ids, payment.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return paymentRepo.MarkExpiredWithTx(tx, ids, at)
+}
+
+// endSubscriptionWithTx ends the subscription with the given status and
+// voids its unpaid charges. Credits already issued keep working until they
+// expire.
+func endSubscriptionWithTx(tx *gorm.DB, subscription *models.Subscription, status models.SubscriptionStatus, at time.Time) error {
+	subscriptionRepo := models.InitSubscriptionRepo(tx)
+
+	orderIDs, err := subscriptionRepo.VoidPendingChargesWithTx(tx, subscription.ID)
+	if err != nil {
+		return err
+	}
+	if err := expireOpenOrdersWithTx(tx, orderIDs, at); err != nil {
+		return err
+	}
+
+	subscription.Status = string(status)
+	subscription.EndedAt = &at
+	subscription.GraceUntil = nil
+	return subscriptionRepo.UpdateWithTx(tx, subscription.ID, map[string]interface{}{
+		"status":      subscription.Status,
+		"ended_at":    at,
+		"grace_until": nil,
+	})
+}
+
+// CreateSubscriptionOrder subscribes the student to a plan, pending payment
+// of the first period. An earlier subscription that was never paid is
+// replaced.
+func CreateSubscriptionOrder(studentUUID string, planID uint) (*SubscriptionOrderResponse, error) {
+	var (
+		subscriptionRepo = models.InitSubscriptionRepo(config.DB)
+		studentRepo      = models.InitStudentRepo(config.DB)
+		now              = time.Now()
+	)
+
+	plan, err := subscriptionRepo.GetPlanByID(planID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	if !plan.Active {
+		return nil, ErrPlanInactive
+	}
+
+	student, err := studentRepo.GetByUserUUID(studentUUID)
+	if err != nil {
+		logger.Error("error in fetching student for subscription: ", err)
+		return nil, err
+	}
+
+	// Refused before the gateway order is opened; checked again once locked
+	current, err := subscriptionRepo.GetCurrentByStudent(student.ID)
+	if err == nil && current.Status != string(models.SubscriptionPending) {
+		return nil, ErrAlreadySubscribed
+	}
+
+	orderID, err := openSubscriptionOrder(plan.ID, plan.PriceInPaise)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	current, err = subscriptionRepo.GetCurrentByStudentForUpdate(tx, student.ID)
+	switch {
+	case err == nil && current.Status != string(models.SubscriptionPending):
+		tx.Rollback()
+		return nil, ErrAlreadySubscribed
+	case err == nil:
+		if err := endSubscriptionWithTx(tx, current, models.SubscriptionCancelled, now); err != nil {
+			tx.Rollback()
+			logger.Error("error in replacing unpaid subscription: ", err)
+			return nil, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		tx.Rollback()
+		logger.Error("error in fetching current subscription: ", err)
+		return nil, err
+	}
+
+	subscription := &models.Subscription{
+		StudentID:         student.ID,
+		PlanID:            plan.ID,
+		Status:            string(models.SubscriptionPending),
+		PlanName:          plan.Name,
+		SessionsPerPeriod: plan.SessionsPerPeriod,
+		PriceInPaise:      plan.PriceInPaise,
+		PeriodMonths:      plan.PeriodMonths,
+
+		PriorityBookingDays: plan.PriorityBookingDays,
+	}
+	if err := models.InitSubscriptionRepo(tx).CreateWithTx(tx, subscription); err != nil {
+		tx.Rollback()
+		logger.Error("error in storing subscription: ", err)
+		return nil, err
+	}
+
+	charge := &models.SubscriptionCharge{
+		SubscriptionID: subscription.ID,
+		PlanID:         plan.ID,
+		Kind:           models.SubscriptionChargeFirst,
+		AmountInPaise:  plan.PriceInPaise,
+		Credits:        plan.SessionsPerPeriod,
+	}
+	if err := recordSubscriptionChargeWithTx(tx, student.ID, models.PaymentForSubscription, charge, orderID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return subscriptionOrderResponse(charge), nil
+}
+
+// upgradeCharge prorates an upgrade over what is left of the current
+// period: the price difference and the extra sessions both shrink with the
+// time remaining. The student always gets at least one extra session and
+// pays at least what the gateway accepts.
+func upgradeCharge(subscription *models.Subscription, plan *models.Plan, now time.Time) (amount int64, credits int) {
+	total := int64(subscription.CurrentPeriodEnd.Sub(*subscription.CurrentPeriodStart) / time.Second)
+	remaining := int64(subscription.CurrentPeriodEnd.Sub(now) / time.Second)
+	if total <= 0 {
+		total = 1
+	}
+	remaining = max(min(remaining, total), 0)
+
+	amount = (plan.PriceInPaise - subscription.PriceInPaise) * remaining / total
+	extra := int64(plan.SessionsPerPeriod - subscription.SessionsPerPeriod)
+	credits = int((extra*remaining + total/2) / total)
+
+	return max(amount, minGatewayAmountInPaise), max(credits, 1)
+}
+
+// priorityBookingDays returns how many days past an expert's booking window
+// the student may book: those of their plan while the subscription is
+// active, none otherwise.
+func priorityBookingDays(db *gorm.DB, studentID uint, now time.Time) (int, error) {
+	subscription, err := models.InitSubscriptionRepo(db).GetCurrentByStudent(studentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		logger.Error("error in fetching subscription for priority booking: ", err)
+		return 0, err
+	}
+
+	if subscription.Status != string(models.SubscriptionActive) || !subscription.CurrentPeriodEnd.After(now) {
+		return 0, nil
+	}
+	return subscription.PriorityBookingDays, nil
+}
+
+// checkUpgrade verifies that the subscription can move to the plan now.
+func checkUpgrade(subscription *models.Subscription, plan *models.Plan, now time.Time) error {
+	if subscription.Status != string(models.SubscriptionActive) || !subscription.CurrentPeriodEnd.After(now) {
+		return ErrSubscriptionNotActive
+	}
+
+	if plan.ID == subscription.PlanID ||
+		plan.PeriodMonths != subscription.PeriodMonths ||
+		plan.PriceInPaise <= subscription.PriceInPaise ||
+		plan.SessionsPerPeriod <= subscription.SessionsPerPeriod {
+		return ErrNotAnUpgrade
+	}
+	return nil
+}
+
+// UpgradeSubscription opens an order for moving the student's active
+// subscription to a bigger plan with the same period. The plan changes when
+// the order is paid; later renewals charge the new price. An earlier unpaid
+// upgrade is replaced.
+func UpgradeSubscription(studentUUID string, planID uint) (*SubscriptionOrderResponse, error) {
+	var (
+		subscriptionRepo = models.InitSubscriptionRepo(config.DB)
+		studentRepo      = models.InitStudentRepo(config.DB)
+		now              = time.Now()
+	)
+
+	plan, err := subscriptionRepo.GetPlanByID(planID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	if !plan.Active {
+		return nil, ErrPlanInactive
+	}
+
+	student, err := studentRepo.GetByUserUUID(studentUUID)
+	if err != nil {
+		logger.Error("error in fetching student for upgrade: ", err)
+		return nil, err
+	}
+
+	// The upgrade is priced before the gateway order is opened, and priced
+	// again once the subscription is locked
+	subscription, err := subscriptionRepo.GetCurrentByStudent(student.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSubscription
+		}
+		logger.Error("error in fetching subscription for upgrade: ", err)
+		return nil, err
+	}
+	if err := checkUpgrade(subscription, plan, now); err != nil {
+		return nil, err
+	}
+
+	amount, credits := upgradeCharge(subscription, plan, now)
+	orderID, err := openSubscriptionOrder(plan.ID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	subscription, err = subscriptionRepo.GetCurrentByStudentForUpdate(tx, student.ID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSubscription
+		}
+		logger.Error("error in fetching subscription for upgrade: ", err)
+		return nil, err
+	}
+
+	if err := checkUpgrade(subscription, plan, now); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if lockedAmount, lockedCredits := upgradeCharge(subscription, plan, now); lockedAmount != amount || lockedCredits != credits {
+		tx.Rollback()
+		return nil, ErrSubscriptionChanged
+	}
+
+	orderIDs, err := models.InitSubscriptionRepo(tx).VoidPendingChargesWithTx(tx, subscription.ID, models.SubscriptionChargeUpgrade)
+	if err == nil {
+		err = expireOpenOrdersWithTx(tx, orderIDs, now)
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in replacing earlier upgrade: ", err)
+		return nil, err
+	}
+
+	charge := &models.SubscriptionCharge{
+		SubscriptionID: subscription.ID,
+		PlanID:         plan.ID,
+		Kind:           models.SubscriptionChargeUpgrade,
+		AmountInPaise:  amount,
+		Credits:        credits,
+		PeriodStart:    subscription.CurrentPeriodStart,
+		PeriodEnd:      subscription.CurrentPeriodEnd,
+	}
+	if err := recordSubscriptionChargeWithTx(tx, student.ID, models.PaymentForSubscription, charge, orderID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return subscriptionOrderResponse(charge), nil
+}
+
+// ActivateSubscriptionCharge applies the charge paid for by the given order
+// and issues its credits. Like ActivatePackagePurchase it is safe to call
+// more than once.
+func ActivateSubscriptionCharge(confirmation PaymentConfirmation) (*models.Subscription, error) {
+	var (
+		tx               = config.DB.Begin()
+		paymentRepo      = models.InitPaymentRepo(tx)
+		subscriptionRepo = models.InitSubscriptionRepo(tx)
+		creditRepo       = models.InitSessionCreditRepo(tx)
+		ledgerRepo       = models.InitLedgerRepo(tx)
+	)
+
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	payment, err := paymentRepo.GetByOrderIDForUpdate(tx, confirmation.OrderID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching payment for subscription: ", err)
+		return nil, err
+	}
+
+	if payment.Purpose != models.PaymentForSubscription && payment.Purpose != models.PaymentForRenewal {
+		tx.Rollback()
+		return nil, ErrPaymentMismatch
+	}
+
+	charge, err := subscriptionRepo.GetChargeByOrderIDForUpdate(tx, payment.OrderID)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("payment %s has no subscription charge: %v", payment.OrderID, err)
+		return nil, err
+	}
+
+	subscription, err := subscriptionRepo.GetByIDForUpdate(tx, charge.SubscriptionID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching subscription: ", err)
+		return nil, err
+	}
+
+	if payment.Status == string(models.PaymentPaid) {
+		// Already applied by an earlier confirm or webhook delivery
+		tx.Rollback()
+		return subscription, nil
+	}
+
+	if !payableStatus(payment.Status) {
+		tx.Rollback()
+		logger.Errorf("payment %s already in status %s", payment.OrderID, payment.Status)
+		return nil, ErrPaymentAlreadyProcessed
+	}
+
+	if charge.Status != string(models.SubscriptionChargePending) {
+		tx.Rollback()
+		logger.Errorf("payment %s captured for %s subscription charge %d", payment.OrderID, charge.Status, charge.ID)
+		refundUnfulfilledPayment(confirmation, ErrSubscriptionChargeVoid)
+		return nil, ErrSubscriptionChargeVoid
+	}
+
+	plan, err := subscriptionRepo.GetPlanByID(charge.PlanID)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in fetching plan: ", err)
+		return nil, err
+	}
+
+	paidAt := time.Now()
+	periodStart, periodEnd := paidAt, paidAt.AddDate(0, subscription.PeriodMonths, 0)
+	if charge.Kind != models.SubscriptionChargeFirst {
+		periodStart, periodEnd = *charge.PeriodStart, *charge.PeriodEnd
+	}
+
+	credits := make([]models.SessionCredit, 0, charge.Credits)
+	for _, value := range splitPackagePrice(int64(payment.Amount), charge.Credits) {
+		credits = append(credits, models.SessionCredit{
+			StudentID:       subscription.StudentID,
+			Status:          string(models.SessionCreditAvailable),
+			Source:          models.SessionCreditFromSubscription,
+			SourceID:        charge.ID,
+			ValueInPaise:    value,
+			ExpiresAt:       periodEnd,
+			ExpertUUIDs:     plan.ExpertUUIDs,
+			Specializations: plan.Specializations,
+		})
+	}
+
+	if err := creditRepo.CreateWithTx(tx, credits); err != nil {
+		tx.Rollback()
+		logger.Error("error in issuing session credits: ", err)
+		return nil, err
+	}
+
+	if err := subscriptionRepo.MarkChargePaidWithTx(tx, charge.ID, periodStart, periodEnd, paidAt); err != nil {
+		tx.Rollback()
+		logger.Error("error in marking subscription charge paid: ", err)
+		return nil, err
+	}
+
+	fields := map[string]interface{}{
+		"status":      string(models.SubscriptionActive),
+		"grace_until": nil,
+	}
+	if charge.Kind == models.SubscriptionChargeUpgrade {
+		subscription.PlanID, subscription.PlanName = plan.ID, plan.Name
+		subscription.SessionsPerPeriod, subscription.PriceInPaise = plan.SessionsPerPeriod, plan.PriceInPaise
+		fields["plan_id"], fields["plan_name"] = plan.ID, plan.Name
+		fields["sessions_per_period"], fields["price_in_paise"] = plan.SessionsPerPeriod, plan.PriceInPaise
+		subscription.PriorityBookingDays = plan.PriorityBookingDays
+		fields["priority_booking_days"] = plan.PriorityBookingDays
+	} else {
+		subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd = &periodStart, &periodEnd
+		fields["current_period_start"], fields["current_period_end"] = periodStart, periodEnd
+	}
+	subscription.Status, subscription.GraceUntil = string(models.SubscriptionActive), nil
+
+	if err := subscriptionRepo.UpdateWithTx(tx, subscription.ID, fields); err != nil {
+		tx.Rollback()
+		logger.Error("error in updating subscription: ", err)
+		return nil, err
+	}
+
+	// The money is owed to the student as sessions until the credits are spent
+	err = ledgerRepo.Create(&models.LedgerTransaction{
+		Kind:        "purchase:subscription",
+		ReferenceID: payment.OrderID,
+		Description: fmt.Sprintf("%s charge for %s subscription (%d sessions)", charge.Kind, plan.Name, charge.Credits),
+		Postings: []models.LedgerPosting{
+			{Account: models.LedgerSessionCreditsAccount, AmountInPaise: int64(payment.Amount)},
+			{Account: models.LedgerGatewayAccount, AmountInPaise: -int64(payment.Amount)},
+		},
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in posting subscription charge: ", err)
+		return nil, err
+	}
+
+	err = paymentRepo.UpdateWithTx(tx, &models.Payment{
+		Status:    string(models.PaymentPaid),
+		PaymentID: confirmation.PaymentID,
+		Method:    confirmation.Method,
+		PaidAt:    &paidAt,
+	}, &models.Payment{OrderID: payment.OrderID})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in marking payment as paid: ", err)
+		return nil, err
+	}
+
+	payment.PaidAt = &paidAt
+	if _, err := issueInvoiceWithTx(tx, payment, ""); err != nil {
+		tx.Rollback()
+		logger.Error("error in issuing invoice: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// subscriptionInvoiceDescription describes a subscription charge on its
+// invoice.
+func subscriptionInvoiceDescription(tx *gorm.DB, orderID string) (string, error) {
+	subscriptionRepo := models.InitSubscriptionRepo(tx)
+
+	charge, err := subscriptionRepo.GetChargeByOrderIDForUpdate(tx, orderID)
+	if err != nil {
+		return "", fmt.Errorf("fetching subscription charge for order %s: %w", orderID, err)
+	}
+
+	plan, err := subscriptionRepo.GetPlanByID(charge.PlanID)
+	if err != nil {
+		return "", fmt.Errorf("fetching plan %d: %w", charge.PlanID, err)
+	}
+
+	if charge.PeriodStart == nil || charge.PeriodEnd == nil {
+		return fmt.Sprintf("Subscription: %s (%d sessions)", plan.Name, charge.Credits), nil
+	}
+	if charge.Kind == models.SubscriptionChargeUpgrade {
+		return fmt.Sprintf("Subscription upgrade: %s (%d extra sessions until %s)",
+			plan.Name, charge.Credits, charge.PeriodEnd.Format("02 Jan 2006")), nil
+	}
+	return fmt.Sprintf("Subscription: %s (%d sessions, %s to %s)", plan.Name, charge.Credits,
+		charge.PeriodStart.Format("02 Jan 2006"), charge.PeriodEnd.Format("02 Jan 2006")), nil
+}
+
+// RenewSubscriptions opens renewal orders for subscriptions whose period
+// has ended, ends those cancelled at period end, and lapses past-due ones
+// whose grace period has run out. It returns how many were renewed and how
+// many ended.
+func RenewSubscriptions(now time.Time) (renewed int, ended int, err error) {
+	var seen []uint
+	for {
+		var (
+			result string
+			id     uint
+		)
+		result, id, err = renewDueSubscription(now, seen)
+		if err != nil || id == 0 {
+			break
+		}
+		seen = append(seen, id)
+		switch result {
+		case "":
+		case models.SubscriptionChargeRenewal:
+			renewed++
+		default:
+			ended++
+		}
+	}
+	if err != nil {
+		return renewed, ended, err
+	}
+
+	for {
+		n, err := lapseSubscriptionBatch(now)
+		ended += n
+		if err != nil || n < subscriptionBatchSize {
+			return renewed, ended, err
+		}
+	}
+}
+
+// renewDueSubscription handles the next subscription whose period has
+// ended, leaving out those already seen in this run, and returns its ID, or
+// 0 when none is due. The result is "renewal" when a renewal order was
+// opened, the status when the subscription ended, and "" when it was left
+// for a later run because another instance holds it or it changed while the
+// gateway order was opened. The order is opened before the subscription is
+// locked, as in CreatePaymentOrder; one left unused is ignored by
+// reconciliation.
+func renewDueSubscription(now time.Time, seen []uint) (string, uint, error) {
+	subscriptionRepo := models.InitSubscriptionRepo(config.DB)
+
+	next, err := subscriptionRepo.GetNextDueForRenewal(now, seen)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", 0, nil
+		}
+		logger.Error("error in fetching subscriptions due for renewal: ", err)
+		return "", 0, err
+	}
+
+	var orderID string
+	if !next.CancelAtPeriodEnd {
+		if orderID, err = openSubscriptionOrder(next.PlanID, next.PriceInPaise); err != nil {
+			logger.Errorf("error in opening renewal of subscription %d: %v", next.ID, err)
+			return "", next.ID, err
+		}
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		return "", next.ID, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	subscription, err := subscriptionRepo.LockDueForRenewalWithTx(tx, next.ID, now)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", next.ID, nil
+		}
+		logger.Errorf("error in locking subscription %d for renewal: %v", next.ID, err)
+		return "", next.ID, err
+	}
+	if subscription.CancelAtPeriodEnd != next.CancelAtPeriodEnd || subscription.PriceInPaise != next.PriceInPaise {
+		tx.Rollback()
+		return "", next.ID, nil
+	}
+
+	periodStart := *subscription.CurrentPeriodEnd
+
+	// An upgrade of the period that just ended can no longer be paid
+	orderIDs, err := subscriptionRepo.VoidPendingChargesWithTx(tx, subscription.ID, models.SubscriptionChargeUpgrade)
+	if err == nil {
+		err = expireOpenOrdersWithTx(tx, orderIDs, now)
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("error in voiding upgrades of subscription %d: %v", subscription.ID, err)
+		return "", subscription.ID, err
+	}
+
+	result := models.SubscriptionChargeRenewal
+	if subscription.CancelAtPeriodEnd {
+		result = string(models.SubscriptionCancelled)
+		if err := endSubscriptionWithTx(tx, subscription, models.SubscriptionCancelled, periodStart); err != nil {
+			tx.Rollback()
+			logger.Errorf("error in ending subscription %d: %v", subscription.ID, err)
+			return "", subscription.ID, err
+		}
+	} else {
+		periodEnd := periodStart.AddDate(0, subscription.PeriodMonths, 0)
+		charge := &models.SubscriptionCharge{
+			SubscriptionID: subscription.ID,
+			PlanID:         subscription.PlanID,
+			Kind:           models.SubscriptionChargeRenewal,
+			AmountInPaise:  subscription.PriceInPaise,
+			Credits:        subscription.SessionsPerPeriod,
+			PeriodStart:    &periodStart,
+			PeriodEnd:      &periodEnd,
+		}
+		if err := recordSubscriptionChargeWithTx(tx, subscription.StudentID, models.PaymentForRenewal, charge, orderID); err != nil {
+			tx.Rollback()
+			logger.Errorf("error in recording renewal of subscription %d: %v", subscription.ID, err)
+			return "", subscription.ID, err
+		}
+
+		err = subscriptionRepo.UpdateWithTx(tx, subscription.ID, map[string]interface{}{
+			"status":      string(models.SubscriptionPastDue),
+			"grace_until": periodStart.Add(config.RuntimeConfig().SubscriptionGracePeriod),
+		})
+		if err != nil {
+			tx.Rollback()
+			logger.Errorf("error in marking subscription %d past due: %v", subscription.ID, err)
+			return "", subscription.ID, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return "", subscription.ID, err
+	}
+	return result, subscription.ID, nil
+}
+
+// lapseSubscriptionBatch ends past-due subscriptions whose grace period has
+// run out. Batches are claimed with SKIP LOCKED like the payment sweeper.
+func lapseSubscriptionBatch(now time.Time) (int, error) {
+	var (
+		tx               = config.DB.Begin()
+		subscriptionRepo = models.InitSubscriptionRepo(tx)
+	)
+
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	subscriptions, err := subscriptionRepo.LockGraceExpiredWithTx(tx, now, subscriptionBatchSize)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in locking lapsed subscriptions: ", err)
+		return 0, err
+	}
+
+	for i := range subscriptions {
+		if err := endSubscriptionWithTx(tx, &subscriptions[i], models.SubscriptionLapsed, now); err != nil {
+			tx.Rollback()
+			logger.Errorf("error in lapsing subscription %d: %v", subscriptions[i].ID, err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return len(subscriptions), nil
+}
+
+// CancelSubscription cancels the student's subscription. A paid period
+// runs to its end and is not renewed; an unpaid first period or renewal
+// ends the subscription at once.
+func CancelSubscription(studentUUID string, now time.Time) (*models.Subscription, error) {
+	student, err := models.InitStudentRepo(config.DB).GetByUserUUID(studentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	subscriptionRepo := models.InitSubscriptionRepo(tx)
+	subscription, err := subscriptionRepo.GetCurrentByStudentForUpdate(tx, student.ID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSubscription
+		}
+		return nil, err
+	}
+
+	if subscription.Status == string(models.SubscriptionActive) {
+		subscription.CancelAtPeriodEnd = true
+		err = subscriptionRepo.UpdateWithTx(tx, subscription.ID, map[string]interface{}{"cancel_at_period_end": true})
+	} else {
+		err = endSubscriptionWithTx(tx, subscription, models.SubscriptionCancelled, now)
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in cancelling subscription: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// ResumeSubscription undoes a cancellation at period end.
+func ResumeSubscription(studentUUID string) (*models.Subscription, error) {
+	student, err := models.InitStudentRepo(config.DB).GetByUserUUID(studentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		logger.Error("error in starting transaction: ", tx.Error)
+		return nil, tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	subscriptionRepo := models.InitSubscriptionRepo(tx)
+	subscription, err := subscriptionRepo.GetCurrentByStudentForUpdate(tx, student.ID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSubscription
+		}
+		return nil, err
+	}
+
+	if subscription.Status != string(models.SubscriptionActive) {
+		tx.Rollback()
+		return nil, ErrSubscriptionNotActive
+	}
+
+	subscription.CancelAtPeriodEnd = false
+	err = subscriptionRepo.UpdateWithTx(tx, subscription.ID, map[string]interface{}{"cancel_at_period_end": false})
+	if err != nil {
+		tx.Rollback()
+		logger.Error("error in resuming subscription: ", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// subscriptionErrorResponse maps subscription errors to a status code.
+func subscriptionErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrPlanNotFound), errors.Is(err, ErrNoSubscription):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrPlanInactive), errors.Is(err, ErrAlreadySubscribed),
+		errors.Is(err, ErrSubscriptionNotActive), errors.Is(err, ErrNotAnUpgrade),
+		errors.Is(err, ErrSubscriptionChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+	}
+}
+
+// ListPlansHandler lists the plans on offer.
+func ListPlansHandler(c *gin.Context) {
+	plans, err := models.InitSubscriptionRepo(config.DB).ListActivePlans()
+	if err != nil {
+		logger.Error("error in listing plans: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plans)
+}
+
+type SubscribeRequest struct {
+	PlanID uint `json:"plan_id" binding:"required"`
+}
+
+func SubscribeHandler(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := CreateSubscriptionOrder(c.GetString("user_uuid"), req.PlanID)
+	if err != nil {
+		logger.Error("error in creating subscription order: ", err)
+		subscriptionErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func UpgradeSubscriptionHandler(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := UpgradeSubscription(c.GetString("user_uuid"), req.PlanID)
+	if err != nil {
+		logger.Error("error in creating upgrade order: ", err)
+		subscriptionErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+type SubscriptionResponse struct {
+	Subscription *models.Subscription        `json:"subscription"`
+	Charges      []models.SubscriptionCharge `json:"charges"`
+	// Orders still waiting for payment, e.g. a renewal in its grace period
+	OpenOrders []SubscriptionOrderResponse `json:"open_orders"`
+}
+
+// GetSubscriptionHandler shows the student's current subscription, its
+// charges and any order still open for payment.
+func GetSubscriptionHandler(c *gin.Context) {
+	var (
+		subscriptionRepo = models.InitSubscriptionRepo(config.DB)
+		resp             = SubscriptionResponse{Charges: []models.SubscriptionCharge{}, OpenOrders: []SubscriptionOrderResponse{}}
+	)
+
+	student, err := models.InitStudentRepo(config.DB).GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	subscription, err := subscriptionRepo.GetCurrentByStudent(student.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		logger.Error("error in fetching subscription: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+	resp.Subscription = subscription
+
+	charges, err := subscriptionRepo.ListChargesBySubscription(subscription.ID)
+	if err != nil {
+		logger.Error("error in listing subscription charges: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+	resp.Charges = charges
+
+	pending := map[string]*models.SubscriptionCharge{}
+	orderIDs := []string{}
+	for i := range charges {
+		if charges[i].Status == string(models.SubscriptionChargePending) {
+			pending[charges[i].OrderID] = &charges[i]
+			orderIDs = append(orderIDs, charges[i].OrderID)
+		}
+	}
+
+	if len(orderIDs) > 0 {
+		payments, err := models.InitPaymentRepo(config.DB).GetByOrderIDs(orderIDs)
+		if err != nil {
+			logger.Error("error in fetching subscription payments: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+		for _, payment := range payments {
+			if payment.Status == string(models.PaymentCreated) || payment.Status == string(models.PaymentFailed) {
+				resp.OpenOrders = append(resp.OpenOrders, *subscriptionOrderResponse(pending[payment.OrderID]))
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+type ConfirmSubscriptionPaymentRequest struct {
+	RazorpayOrderID   string `json:"razorpay_order_id" binding:"required"`
+	RazorpayPaymentID string `json:"razorpay_payment_id" binding:"required"`
+	RazorpaySignature string `json:"razorpay_signature" binding:"required"`
+}
+
+func ConfirmSubscriptionPaymentHandler(c *gin.Context) {
+	var (
+		req         ConfirmSubscriptionPaymentRequest
+		paymentRepo = models.InitPaymentRepo(config.DB)
+		studentRepo = models.InitStudentRepo(config.DB)
+	)
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, err := paymentRepo.GetByOrderID(req.RazorpayOrderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment order not found"})
+		return
+	}
+
+	student, err := studentRepo.GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	isSubscriptionOrder := payment.Purpose == models.PaymentForSubscription || payment.Purpose == models.PaymentForRenewal
+	if !isSubscriptionOrder || payment.StudentID != student.ID {
+		logger.Errorf("order %s is not a subscription order of student %d", payment.OrderID, student.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrPaymentMismatch.Error()})
+		return
+	}
+
+	if !config.Payments.VerifyPaymentSignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature) {
+		logger.Error("error in verifying razorpay signature")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment signature"})
+		return
+	}
+
+	method, err := FetchPaymentMethod(req.RazorpayPaymentID)
+	if err != nil {
+		logger.Error("error in fetching razorpay payment method: ", err)
+	}
+
+	subscription, err := ActivateSubscriptionCharge(PaymentConfirmation{
+		OrderID:   req.RazorpayOrderID,
+		PaymentID: req.RazorpayPaymentID,
+		Method:    method,
+	})
+	if err != nil {
+		logger.Error("error in applying subscription payment: ", err)
+		if errors.Is(err, ErrPaymentAlreadyProcessed) || errors.Is(err, ErrSubscriptionChargeVoid) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply subscription payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+func CancelSubscriptionHandler(c *gin.Context) {
+	subscription, err := CancelSubscription(c.GetString("user_uuid"), time.Now())
+	if err != nil {
+		logger.Error("error in cancelling subscription: ", err)
+		subscriptionErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+func ResumeSubscriptionHandler(c *gin.Context) {
+	subscription, err := ResumeSubscription(c.GetString("user_uuid"))
+	if err != nil {
+		logger.Error("error in resuming subscription: ", err)
+		subscriptionErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+type CreatePlanRequest struct {
+	Name              string   `json:"name" binding:"required"`
+	Description       string   `json:"description"`
+	SessionsPerPeriod int      `json:"sessions_per_period" binding:"required"`
+	PriceInPaise      int64    `json:"price_in_paise" binding:"required"`
+	PeriodMonths      int      `json:"period_months"` // defaults to 1
+	ExpertUUIDs       []string `json:"expert_uuids"`
+	Specializations   []string `json:"specializations"`
+
+	PriorityBookingDays int `json:"priority_booking_days"`
+}
+
+func (r *CreatePlanRequest) validate() string {
+	switch {
+	case strings.TrimSpace(r.Name) == "":
+		return "name is required"
+	case r.SessionsPerPeriod <= 0:
+		return "sessions_per_period must be positive"
+	case r.PriceInPaise < minGatewayAmountInPaise || r.PriceInPaise < int64(r.SessionsPerPeriod):
+		return "price_in_paise is too low"
+	case r.PeriodMonths < 0 || r.PeriodMonths > 12:
+		return "period_months must be between 1 and 12"
+	case r.PriorityBookingDays < 0:
+		return "priority_booking_days cannot be negative"
+	}
+	return ""
+}
+
+func CreatePlanHandler(c *gin.Context) {
+	var req CreatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := req.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	plan := &models.Plan{
+		Name:              strings.TrimSpace(req.Name),
+		Description:       req.Description,
+		Active:            true,
+		SessionsPerPeriod: req.SessionsPerPeriod,
+		PriceInPaise:      req.PriceInPaise,
+		PeriodMonths:      max(req.PeriodMonths, 1),
+		ExpertUUIDs:       req.ExpertUUIDs,
+		Specializations:   req.Specializations,
+
+		PriorityBookingDays: req.PriorityBookingDays,
+	}
+
+	if err := models.InitSubscriptionRepo(config.DB).CreatePlan(plan); err != nil {
+		logger.Error("error in creating plan: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+func ListAllPlansHandler(c *gin.Context) {
+	plans, err := models.InitSubscriptionRepo(config.DB).ListPlans()
+	if err != nil {
+		logger.Error("error in listing plans: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plans)
+}
+
+// DeactivatePlanHandler stops new subscriptions and upgrades to a plan.
+// Existing subscribers keep renewing at the terms they signed up for.
+func DeactivatePlanHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("plan_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid plan id"})
+		return
+	}
+
+	if err := models.InitSubscriptionRepo(config.DB).SetPlanActive(uint(id), false); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": ErrPlanNotFound.Error()})
+			return
+		}
+		logger.Error("error in deactivating plan: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "plan deactivated"})
+}
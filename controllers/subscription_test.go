@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"interviewexcel-backend-go/models"
+	"testing"
+	"time"
+)
+
+func TestUpgradeCharge(t *testing.T) {
+	var (
+		start = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+		end   = start.AddDate(0, 0, 30)
+		half  = start.Add(end.Sub(start) / 2)
+	)
+
+	subscription := &models.Subscription{
+		PriceInPaise:       100000,
+		SessionsPerPeriod:  4,
+		CurrentPeriodStart: &start,
+		CurrentPeriodEnd:   &end,
+	}
+
+	tests := []struct {
+		name        string
+		plan        models.Plan
+		now         time.Time
+		wantAmount  int64
+		wantCredits int
+	}{
+		{"at period start", models.Plan{PriceInPaise: 160000, SessionsPerPeriod: 8}, start, 60000, 4},
+		{"halfway", models.Plan{PriceInPaise: 160000, SessionsPerPeriod: 8}, half, 30000, 2},
+		{"credits round to nearest", models.Plan{PriceInPaise: 160000, SessionsPerPeriod: 7}, half, 30000, 2},
+		{"before period start counts as whole period", models.Plan{PriceInPaise: 160000, SessionsPerPeriod: 8}, start.Add(-time.Hour), 60000, 4},
+		{"an hour left", models.Plan{PriceInPaise: 1600000, SessionsPerPeriod: 5}, end.Add(-time.Hour), 2083, 1},
+		{"at least the gateway minimum", models.Plan{PriceInPaise: 160000, SessionsPerPeriod: 8}, end, minGatewayAmountInPaise, 1},
+		{"after period end", models.Plan{PriceInPaise: 160000, SessionsPerPeriod: 8}, end.Add(time.Hour), minGatewayAmountInPaise, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, credits := upgradeCharge(subscription, &tt.plan, tt.now)
+			if amount != tt.wantAmount || credits != tt.wantCredits {
+				t.Errorf("upgradeCharge() = %d, %d; want %d, %d", amount, credits, tt.wantAmount, tt.wantCredits)
+			}
+		})
+	}
+}
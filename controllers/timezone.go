@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"errors"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"interviewexcel-backend-go/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidTimeZone = errors.New("tz must be an IANA time zone such as Asia/Kolkata")
+
+// viewerLocation returns the zone to render times in for the caller: the
+// tz query parameter, else the zone on the caller's profile, else the
+// default zone.
+func viewerLocation(c *gin.Context) (*time.Location, error) {
+	if tz := c.Query("tz"); tz != "" {
+		if !utils.ValidTimeZone(tz) {
+			return nil, errInvalidTimeZone
+		}
+		return utils.LoadLocation(tz), nil
+	}
+	if uuid := c.GetString("user_uuid"); uuid != "" {
+		return utils.UserLocation(config.DB, uuid), nil
+	}
+	return utils.LoadLocation(""), nil
+}
+
+// slotsIn renders the slots' times in loc. The instants are unchanged.
+func slotsIn(slots []models.AvailabilitySlot, loc *time.Location) []models.AvailabilitySlot {
+	for i := range slots {
+		slots[i].StartTime = slots[i].StartTime.In(loc)
+		slots[i].EndTime = slots[i].EndTime.In(loc)
+		if slots[i].HeldUntil != nil {
+			heldUntil := slots[i].HeldUntil.In(loc)
+			slots[i].HeldUntil = &heldUntil
+		}
+	}
+	return slots
+}
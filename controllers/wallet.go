@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	walletPageDefault = 50
+	walletPageMax     = 200
+)
+
+// WalletSessionLink identifies the session a wallet row belongs to.
+type WalletSessionLink struct {
+	SessionUUID string    `json:"session_uuid"`
+	StartTime   time.Time `json:"start_time"`
+	Status      string    `json:"status"`
+}
+
+type WalletTransactionResponse struct {
+	ID              uint               `json:"id"`
+	CreatedAt       time.Time          `json:"created_at"`
+	Type            string             `json:"type"`
+	Source          string             `json:"source"`
+	AmountInPaise   int64              `json:"amount_in_paise"`
+	AvailableChange int64              `json:"available_change"`
+	PendingChange   int64              `json:"pending_change"`
+	ReferenceID     string             `json:"reference_id"`
+	Description     string             `json:"description"`
+	ExpiresAt       *time.Time         `json:"expires_at,omitempty"` // student credits only
+	Session         *WalletSessionLink `json:"session,omitempty"`
+}
+
+type WalletTransactionsResponse struct {
+	Transactions []WalletTransactionResponse `json:"transactions"`
+	NextCursor   string                      `json:"next_cursor,omitempty"`
+}
+
+func encodeWalletCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeWalletCursor(cursor string) (uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	return uint(id), err
+}
+
+// parseDateParam accepts YYYY-MM-DD (start of that day, UTC) or RFC3339.
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", value)
+	}
+	return &t, nil
+}
+
+func splitCSVParam(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// walletSessionLinks loads the sessions referenced by wallet rows. Rows for
+// payouts reference a payout UUID and simply find no session.
+func walletSessionLinks(transactions []models.WalletTransaction) (map[string]*WalletSessionLink, error) {
+	var refs []string
+	seen := map[string]bool{}
+	for _, wt := range transactions {
+		if wt.ReferenceID != "" && wt.Source != "payout" && !seen[wt.ReferenceID] {
+			seen[wt.ReferenceID] = true
+			refs = append(refs, wt.ReferenceID)
+		}
+	}
+
+	sessions, err := models.InitSessionRepo(config.DB).GetByUUIDs(refs)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make(map[string]*WalletSessionLink, len(sessions))
+	for _, session := range sessions {
+		links[session.SessionUUID] = &WalletSessionLink{
+			SessionUUID: session.SessionUUID,
+			StartTime:   session.StartTime,
+			Status:      session.Status,
+		}
+	}
+	return links, nil
+}
+
+func GetWalletTransactionsHandler(c *gin.Context) {
+	var (
+		walletRepo = models.InitWalletRepo(config.DB)
+		wtRepo     = models.InitWalletTransactionRepo(config.DB)
+		filter     = models.WalletTransactionFilter{Limit: walletPageDefault}
+		err        error
+	)
+
+	if filter.From, err = parseDateParam(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = parseDateParam(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Types = splitCSVParam(c.Query("type"))
+	filter.Sources = splitCSVParam(c.Query("source"))
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		filter.Limit = min(n, walletPageMax)
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if filter.BeforeID, err = decodeWalletCursor(cursor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+
+	resp := WalletTransactionsResponse{Transactions: []WalletTransactionResponse{}}
+
+	wallet, err := walletRepo.GetByUserUUID(c.GetString("user_uuid"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		logger.Error("error in fetching wallet: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	// One extra row tells us whether there is another page
+	pageSize := filter.Limit
+	filter.Limit++
+
+	transactions, err := wtRepo.List(wallet.ID, filter)
+	if err != nil {
+		logger.Error("error in listing wallet transactions: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if len(transactions) > pageSize {
+		transactions = transactions[:pageSize]
+		resp.NextCursor = encodeWalletCursor(transactions[pageSize-1].ID)
+	}
+
+	links, err := walletSessionLinks(transactions)
+	if err != nil {
+		logger.Error("error in fetching sessions for wallet transactions: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	for _, wt := range transactions {
+		available, pending := wt.BalanceEffect()
+		resp.Transactions = append(resp.Transactions, WalletTransactionResponse{
+			ID:              wt.ID,
+			CreatedAt:       wt.CreatedAt,
+			Type:            wt.Type,
+			Source:          wt.Source,
+			AmountInPaise:   wt.AmountInPaise,
+			AvailableChange: available,
+			PendingChange:   pending,
+			ReferenceID:     wt.ReferenceID,
+			Description:     wt.Description,
+			ExpiresAt:       wt.ExpiresAt,
+			Session:         links[wt.ReferenceID],
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetWalletStatementCSVHandler exports one calendar month (UTC) of wallet
+// history: the opening balances, every movement with running balances, and
+// the closing balances. Amounts are in rupees.
+func GetWalletStatementCSVHandler(c *gin.Context) {
+	var (
+		walletRepo = models.InitWalletRepo(config.DB)
+		wtRepo     = models.InitWalletTransactionRepo(config.DB)
+		userUUID   = c.GetString("user_uuid")
+	)
+
+	month, err := time.Parse("2006-01", c.Query("month"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "month is required as YYYY-MM"})
+		return
+	}
+	from, to := month, month.AddDate(0, 1, 0)
+
+	var (
+		transactions               []models.WalletTransaction
+		openAvailable, openPending int64
+	)
+
+	wallet, err := walletRepo.GetByUserUUID(userUUID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// No wallet yet: an empty statement
+	case err != nil:
+		logger.Error("error in fetching wallet: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	default:
+		openAvailable, openPending, err = wtRepo.BalancesBefore(wallet.ID, from)
+		if err != nil {
+			logger.Error("error in computing opening balance: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+
+		transactions, err = wtRepo.ListBetween(wallet.ID, from, to)
+		if err != nil {
+			logger.Error("error in listing statement transactions: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+	}
+
+	links, err := walletSessionLinks(transactions)
+	if err != nil {
+		logger.Error("error in fetching sessions for statement: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	filename := fmt.Sprintf("wallet-statement-%s.csv", month.Format("2006-01"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	rows := [][]string{
+		{"date", "type", "source", "reference_id", "session_uuid", "description",
+			"available_change", "pending_change", "available_balance", "pending_balance"},
+		{from.Format(time.DateOnly), "opening_balance", "", "", "", "",
+			"", "", rupees(openAvailable), rupees(openPending)},
+	}
+
+	available, pending := openAvailable, openPending
+	for _, wt := range transactions {
+		dAvailable, dPending := wt.BalanceEffect()
+		available += dAvailable
+		pending += dPending
+
+		sessionUUID := ""
+		if link := links[wt.ReferenceID]; link != nil {
+			sessionUUID = link.SessionUUID
+		}
+
+		rows = append(rows, []string{
+			wt.CreatedAt.UTC().Format(time.RFC3339), wt.Type, wt.Source, wt.ReferenceID, sessionUUID, wt.Description,
+			rupees(dAvailable), rupees(dPending), rupees(available), rupees(pending),
+		})
+	}
+
+	rows = append(rows, []string{
+		to.AddDate(0, 0, -1).Format(time.DateOnly), "closing_balance", "", "", "", "",
+		rupees(available - openAvailable), rupees(pending - openPending), rupees(available), rupees(pending),
+	})
+
+	if err := w.WriteAll(rows); err != nil {
+		logger.Error("error in writing wallet statement: ", err)
+	}
+}
+
+// rupees formats paise as a decimal rupee amount, e.g. -1234 → "-12.34".
+func rupees(paise int64) string {
+	sign := ""
+	if paise < 0 {
+		sign, paise = "-", -paise
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, paise/100, paise%100)
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"net/http"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Razorpay → POST /webhooks/razorpay
+//    ↓
+// Verify X-Razorpay-Signature (HMAC-SHA256 of raw body, webhook secret;
+// the fake gateway signs its simulated webhooks the same way)
+//    ↓
+// Record X-Razorpay-Event-Id (duplicate → 200, nothing else happens)
+//    ↓
+// payment.captured / order.paid → BookExpertSlot, or ActivatePackagePurchase
+//                                for package orders (same paths as client confirm)
+// payment.failed                → mark Payment failed
+// refund.processed              → record refunded amount on Payment
+
+const (
+	RazorpayEventPaymentCaptured = "payment.captured"
+	RazorpayEventPaymentFailed   = "payment.failed"
+	RazorpayEventOrderPaid       = "order.paid"
+	RazorpayEventRefundProcessed = "refund.processed"
+)
+
+type razorpayWebhookEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment *struct {
+			Entity razorpayPaymentEntity `json:"entity"`
+		} `json:"payment"`
+		Order *struct {
+			Entity struct {
+				ID string `json:"id"`
+			} `json:"entity"`
+		} `json:"order"`
+		Refund *struct {
+			Entity struct {
+				ID        string `json:"id"`
+				PaymentID string `json:"payment_id"`
+				Amount    int64  `json:"amount"`
+			} `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+type razorpayPaymentEntity struct {
+	ID             string `json:"id"`
+	OrderID        string `json:"order_id"`
+	Amount         int64  `json:"amount"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Method         string `json:"method"`
+	Status         string `json:"status"`
+}
+
+// errWebhookPermanent marks failures that a redelivery cannot fix, so the
+// event is kept as failed instead of being released for retry.
+var errWebhookPermanent = errors.New("webhook event cannot be processed")
+
+func RazorpayWebhookHandler(c *gin.Context) {
+	var (
+		webhookRepo = models.InitWebhookEventRepo(config.DB)
+		event       razorpayWebhookEvent
+	)
+
+	body, err := c.GetRawData()
+	if err != nil {
+		logger.Error("error in reading webhook body: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	if !config.Payments.VerifyWebhookSignature(body, c.GetHeader("X-Razorpay-Signature")) {
+		logger.Error("error in verifying razorpay webhook signature")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook signature"})
+		return
+	}
+
+	eventID := c.GetHeader("X-Razorpay-Event-Id")
+	if eventID == "" {
+		logger.Error("razorpay webhook without event id")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing event id"})
+		return
+	}
+
+	if err := json.Unmarshal(body, &event); err != nil {
+		logger.Error("error in parsing razorpay webhook: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	created, err := webhookRepo.CreateIfAbsent(&models.WebhookEvent{
+		Provider: "razorpay",
+		EventID:  eventID,
+		Event:    event.Event,
+		Status:   string(models.WebhookEventProcessing),
+		Payload:  datatypes.JSON(body),
+	})
+	if err != nil {
+		logger.Error("error in recording webhook event: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record event"})
+		return
+	}
+	if !created {
+		logger.Infof("duplicate razorpay webhook event %s (%s) ignored", eventID, event.Event)
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+
+	err = handleRazorpayWebhookEvent(&event)
+	switch {
+	case err == nil:
+		if err := webhookRepo.UpdateStatus(eventID, models.WebhookEventProcessed, ""); err != nil {
+			logger.Error("error in marking webhook event processed: ", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "processed"})
+
+	case errors.Is(err, errWebhookPermanent):
+		logger.Errorf("razorpay webhook %s (%s) failed permanently: %v", eventID, event.Event, err)
+		if err := webhookRepo.UpdateStatus(eventID, models.WebhookEventFailed, err.Error()); err != nil {
+			logger.Error("error in marking webhook event failed: ", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "failed"})
+
+	default:
+		// Release the event ID so Razorpay's redelivery is processed again
+		logger.Errorf("razorpay webhook %s (%s) failed: %v", eventID, event.Event, err)
+		if err := webhookRepo.Delete(eventID); err != nil {
+			logger.Error("error in releasing webhook event: ", err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process event"})
+	}
+}
+
+func handleRazorpayWebhookEvent(event *razorpayWebhookEvent) error {
+	switch event.Event {
+	case RazorpayEventPaymentCaptured, RazorpayEventOrderPaid:
+		if event.Payload.Payment == nil {
+			return errWebhookPermanent
+		}
+		entity := event.Payload.Payment.Entity
+		if entity.OrderID == "" && event.Payload.Order != nil {
+			entity.OrderID = event.Payload.Order.Entity.ID
+		}
+		return completeBookingFromWebhook(entity)
+
+	case RazorpayEventPaymentFailed:
+		if event.Payload.Payment == nil {
+			return errWebhookPermanent
+		}
+		return markPaymentFailed(event.Payload.Payment.Entity)
+
+	case RazorpayEventRefundProcessed:
+		if event.Payload.Payment == nil {
+			return errWebhookPermanent
+		}
+		return recordRefund(event.Payload.Payment.Entity)
+
+	default:
+		logger.Infof("ignoring razorpay webhook event %s", event.Event)
+		return nil
+	}
+}
+
+func completeBookingFromWebhook(entity razorpayPaymentEntity) error {
+	paymentRepo := models.InitPaymentRepo(config.DB)
+
+	payment, err := paymentRepo.GetByOrderID(entity.OrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errWebhookPermanent
+		}
+		return err
+	}
+
+	err = completePayment(payment, PaymentConfirmation{
+		OrderID:   entity.OrderID,
+		PaymentID: entity.ID,
+		Method:    entity.Method,
+	})
+	if errors.Is(err, ErrSlotNotAvailable) || errors.Is(err, ErrSubscriptionChargeVoid) {
+		// A payment that cannot be applied is refunded; until that has gone
+		// through, Razorpay's redelivery tries again
+		refunded, lookupErr := paymentRepo.GetByOrderID(entity.OrderID)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		if refunded.Status != string(models.PaymentRefunded) {
+			return fmt.Errorf("captured payment %s for order %s could not be applied or refunded: %w", entity.ID, entity.OrderID, err)
+		}
+		logger.Warnf("captured payment %s for order %s could not be applied and was refunded: %v", entity.ID, entity.OrderID, err)
+		return nil
+	}
+	if errors.Is(err, ErrPaymentAlreadyProcessed) {
+		logger.Errorf("captured payment %s for order %s could not be booked: %v", entity.ID, entity.OrderID, err)
+		return errWebhookPermanent
+	}
+	return err
+}
+
+func markPaymentFailed(entity razorpayPaymentEntity) error {
+	// Only a payment that has not been paid yet may move to failed
+	return config.DB.Model(&models.Payment{}).
+		Where("order_id = ? AND status = ?", entity.OrderID, string(models.PaymentCreated)).
+		Updates(&models.Payment{
+			Status:    string(models.PaymentFailed),
+			PaymentID: entity.ID,
+			Method:    entity.Method,
+		}).Error
+}
+
+func recordRefund(entity razorpayPaymentEntity) error {
+	status := models.PaymentPartiallyRefunded
+	if entity.AmountRefunded >= entity.Amount {
+		status = models.PaymentRefunded
+	}
+
+	// amount_refunded is cumulative, so applying it is safe on any delivery
+	// order. What the gateway refunded beyond our record is taken off any
+	// refund still queued, so the queue never sends it a second time.
+	result := config.DB.Model(&models.Payment{}).
+		Where("payment_id = ? AND refunded_amount <= ?", entity.ID, entity.AmountRefunded).
+		Updates(map[string]interface{}{
+			"status":          string(status),
+			"refunded_amount": entity.AmountRefunded,
+			"refund_pending":  gorm.Expr("GREATEST(refund_pending + refunded_amount - ?, 0)", entity.AmountRefunded),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		logger.Warnf("refund for payment %s did not match a local payment", entity.ID)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+)
+
+// Job is a background task run on a fixed interval by every server
+// instance. Jobs must be safe to run concurrently on several instances.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time) error
+}
+
+// Start runs each job once immediately and then on its interval until ctx
+// is cancelled.
+func Start(ctx context.Context, jobs ...Job) {
+	for _, job := range jobs {
+		go loop(ctx, job)
+	}
+}
+
+func loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		run(job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func run(job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("job %s panicked: %v", job.Name, r)
+		}
+	}()
+
+	if err := job.Run(time.Now()); err != nil {
+		logger.Errorf("job %s failed: %v", job.Name, err)
+	}
+}
@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"interviewexcel-backend-go/controllers"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+)
+
+// Default lists the jobs started with the server.
+func Default() []Job {
+	return []Job{
+		{
+			Name:     "escrow-release",
+			Interval: 5 * time.Minute,
+			Run: func(now time.Time) error {
+				released, err := controllers.ReleaseDueEarnings(now)
+				if released > 0 {
+					logger.Infof("escrow-release: released earnings of %d sessions", released)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "no-show-refunds",
+			Interval: 5 * time.Minute,
+			Run: func(now time.Time) error {
+				refunded, err := controllers.RefundExpertNoShows(now)
+				if refunded > 0 {
+					logger.Infof("no-show-refunds: refunded %d expert no-shows", refunded)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "payout-sync",
+			Interval: 5 * time.Minute,
+			Run: func(now time.Time) error {
+				settled, err := controllers.SyncProcessingPayouts(now)
+				if settled > 0 {
+					logger.Infof("payout-sync: settled %d payouts", settled)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "payment-expiry",
+			Interval: 5 * time.Minute,
+			Run: func(now time.Time) error {
+				expired, err := controllers.ExpireAbandonedPayments(now)
+				if expired > 0 {
+					logger.Infof("payment-expiry: expired %d unpaid orders", expired)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "pending-refunds",
+			Interval: 5 * time.Minute,
+			Run: func(now time.Time) error {
+				issued, err := controllers.IssuePendingRefunds(now)
+				if issued > 0 {
+					logger.Infof("pending-refunds: issued %d refunds", issued)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "payment-reconcile",
+			Interval: 24 * time.Hour,
+			Run: func(now time.Time) error {
+				report, err := controllers.ReconcileRecentPayments(now)
+				if err != nil {
+					return err
+				}
+				logger.Infof("payment-reconcile: %d discrepancies, %d unresolved",
+					len(report.Discrepancies), report.Unresolved())
+				return nil
+			},
+		},
+		{
+			Name:     "availability-materializer",
+			Interval: time.Hour,
+			Run: func(now time.Time) error {
+				created, err := controllers.MaterializeAvailability(now)
+				if created > 0 {
+					logger.Infof("availability-materializer: created %d slots", created)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "vacation-mode",
+			Interval: 15 * time.Minute,
+			Run: func(now time.Time) error {
+				hidden, shown, err := controllers.SyncVacationMode(now)
+				if hidden > 0 || shown > 0 {
+					logger.Infof("vacation-mode: hid %d experts, showed %d", hidden, shown)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "subscription-renewal",
+			Interval: 15 * time.Minute,
+			Run: func(now time.Time) error {
+				renewed, ended, err := controllers.RenewSubscriptions(now)
+				if renewed > 0 || ended > 0 {
+					logger.Infof("subscription-renewal: opened %d renewals, ended %d subscriptions", renewed, ended)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "wallet-credit-expiry",
+			Interval: time.Hour,
+			Run: func(now time.Time) error {
+				expired, err := controllers.ExpireWalletCredits(now)
+				if expired > 0 {
+					logger.Infof("wallet-credit-expiry: expired %d wallet credits", expired)
+				}
+				return err
+			},
+		},
+		{
+			Name:     "session-credit-expiry",
+			Interval: time.Hour,
+			Run: func(now time.Time) error {
+				expired, err := controllers.ExpireSessionCredits(now)
+				if expired > 0 {
+					logger.Infof("session-credit-expiry: expired %d session credits", expired)
+				}
+				return err
+			},
+		},
+	}
+}
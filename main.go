@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/controllers"
+	"interviewexcel-backend-go/jobs"
 	"interviewexcel-backend-go/routes"
 	"log"
 	"net/http"
@@ -22,8 +27,8 @@ func buildRouter() *gin.Engine {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     runtimeConfig.CorsAllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Cookie"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Cookie", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -33,7 +38,10 @@ func buildRouter() *gin.Engine {
 	// Register routes
 	routes.RegisterExpertRoutes(r)
 	routes.RegisterStudentRoutes(r)
+	routes.RegisterAdminRoutes(r)
 	routes.AuthRoutes(r)
+	routes.RegisterWebhookRoutes(r)
+	routes.RegisterDevRoutes(r)
 
 	// Banner
 	banner := `
@@ -91,10 +99,16 @@ func runServe() error {
 		return err
 	}
 
-	if err := config.InitRazorpay(); err != nil {
+	if err := config.InitPayments(); err != nil {
 		return err
 	}
 
+	if err := config.InitPayouts(); err != nil {
+		return err
+	}
+
+	jobs.Start(context.Background(), jobs.Default()...)
+
 	router := buildRouter()
 	port := config.RuntimeConfig().Port
 	if !strings.HasPrefix(port, ":") {
@@ -112,6 +126,100 @@ func runMigrate() error {
 	return config.RunMigrations()
 }
 
+// runLedgerCheck verifies stored wallet balances against the ledger and
+// fails when they disagree, so it can gate deploys or run from cron.
+func runLedgerCheck() error {
+	if err := config.InitDB(); err != nil {
+		return err
+	}
+
+	report, err := controllers.CheckLedgerConsistency()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("ledger check: %d wallets, %d mismatched balances, %d unbalanced transactions, %d orphan accounts, posting total %d",
+		report.WalletsChecked, len(report.Mismatches), len(report.Unbalanced), len(report.OrphanAccounts), report.Total)
+
+	for _, m := range report.Mismatches {
+		log.Printf("  %s %s: stored %d, ledger %d (diff %d)", m.UserUUID, m.Balance, m.Stored, m.Ledger, m.Stored-m.Ledger)
+	}
+	for _, u := range report.Unbalanced {
+		log.Printf("  ledger transaction %d sums to %d", u.LedgerTransactionID, u.Sum)
+	}
+	for _, account := range report.OrphanAccounts {
+		log.Printf("  ledger account %s has no wallet", account)
+	}
+
+	if !report.Consistent() {
+		return fmt.Errorf("ledger is inconsistent")
+	}
+
+	log.Println("ledger is consistent")
+	return nil
+}
+
+// runLedgerBackfill records opening balances for wallets that predate the ledger.
+func runLedgerBackfill() error {
+	if err := config.InitDB(); err != nil {
+		return err
+	}
+
+	posted, err := controllers.BackfillOpeningBalances()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("posted %d opening balances", posted)
+	return nil
+}
+
+// runReconcile compares gateway orders and payments with local records,
+// heals what is safe to heal and fails while discrepancies remain.
+func runReconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	since := flags.Duration("since", config.RuntimeConfig().ReconcileWindow, "how far back to look")
+	dryRun := flags.Bool("dry-run", false, "report discrepancies without healing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := config.InitDB(); err != nil {
+		return err
+	}
+
+	if err := config.InitPayments(); err != nil {
+		return err
+	}
+
+	to := time.Now()
+	report, err := controllers.ReconcilePayments(to.Add(-*since), to, !*dryRun)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("reconcile %s → %s: %d gateway orders, %d gateway payments, %d local payments, %d discrepancies",
+		report.From.Format(time.RFC3339), report.To.Format(time.RFC3339),
+		report.GatewayOrders, report.GatewayPayments, report.LocalPayments, len(report.Discrepancies))
+
+	for _, d := range report.Discrepancies {
+		state := "open"
+		if d.Healed {
+			state = "healed"
+		} else if d.HealError != "" {
+			state = "heal failed: " + d.HealError
+		}
+		log.Printf("  %-26s order %s payment %s: %s [%s]", d.Kind, d.OrderID, d.PaymentID, d.Detail, state)
+	}
+
+	if unresolved := report.Unresolved(); unresolved > 0 {
+		return fmt.Errorf("%d discrepancies need attention", unresolved)
+	}
+
+	log.Println("payments reconciled")
+	return nil
+}
+
 func main() {
 	command := "serve"
 	if len(os.Args) > 1 {
@@ -125,8 +233,14 @@ func main() {
 		err = runServe()
 	case "migrate":
 		err = runMigrate()
+	case "ledger-check":
+		err = runLedgerCheck()
+	case "ledger-backfill":
+		err = runLedgerBackfill()
+	case "reconcile":
+		err = runReconcile(os.Args[2:])
 	default:
-		log.Fatalf("unknown command %q, expected serve or migrate", command)
+		log.Fatalf("unknown command %q, expected serve, migrate, ledger-check, ledger-backfill or reconcile", command)
 	}
 
 	if err != nil {
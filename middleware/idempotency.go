@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"io"
+	"net/http"
+	"time"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	idempotencyKeyMaxLen = 255
+	// Keys older than this are treated as unused and may be reused
+	idempotencyKeyTTL = 24 * time.Hour
+)
+
+// bodyCaptureWriter keeps a copy of everything the handler writes so the
+// response can be stored against the idempotency key.
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response when a request is repeated with
+// the same Idempotency-Key by the same user. It must run after
+// AuthMiddleware. Requests without the header pass through unchanged.
+// Server errors (5xx) and panics are not stored, so the client can retry
+// them.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		userUUID := c.GetString("user_uuid")
+		if userUUID == "" {
+			logger.Error("idempotency middleware used without authenticated user")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Error("error in reading request body: ", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		repo := models.InitIdempotencyKeyRepo(config.DB)
+		record := &models.IdempotencyKey{
+			Key:         key,
+			UserUUID:    userUUID,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hashRequest(c.Request.Method, c.Request.URL.Path, body),
+		}
+
+		created, err := repo.CreateIfAbsent(record)
+		if err == nil && !created {
+			created, err = reclaimExpiredKey(repo, record)
+		}
+		if err != nil {
+			logger.Error("error in recording idempotency key: ", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+			return
+		}
+
+		if !created {
+			replayIdempotentResponse(c, repo, record)
+			return
+		}
+
+		writer := &bodyCaptureWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		// A panicking handler leaves no response to store; release the key
+		// so the retry runs, and let the recovery middleware answer
+		defer func() {
+			if r := recover(); r != nil {
+				if err := repo.Delete(record.ID); err != nil {
+					logger.Error("error in releasing idempotency key: ", err)
+				}
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			if err := repo.Delete(record.ID); err != nil {
+				logger.Error("error in releasing idempotency key: ", err)
+			}
+			return
+		}
+
+		if err := repo.Complete(record.ID, status, writer.Header().Get("Content-Type"), writer.body.Bytes()); err != nil {
+			logger.Error("error in storing idempotent response: ", err)
+		}
+	}
+}
+
+// reclaimExpiredKey drops a stored key that is past its TTL and records the
+// new request in its place.
+func reclaimExpiredKey(repo models.IIdempotencyKeyRepo, record *models.IdempotencyKey) (bool, error) {
+	existing, err := repo.Get(record.Key, record.UserUUID)
+	if err != nil {
+		return false, err
+	}
+	if time.Since(existing.CreatedAt) < idempotencyKeyTTL {
+		return false, nil
+	}
+
+	if err := repo.Delete(existing.ID); err != nil {
+		return false, err
+	}
+	return repo.CreateIfAbsent(record)
+}
+
+func replayIdempotentResponse(c *gin.Context, repo models.IIdempotencyKeyRepo, record *models.IdempotencyKey) {
+	existing, err := repo.Get(record.Key, record.UserUUID)
+	if err != nil {
+		logger.Error("error in fetching idempotency key: ", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Server Error"})
+		return
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key was already used for a different request",
+		})
+		return
+	}
+
+	if existing.CompletedAt == nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A request with this Idempotency-Key is still in progress",
+		})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.StatusCode, existing.ContentType, existing.ResponseBody)
+	c.Abort()
+}
+
+func hashRequest(method string, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	logger "interviewexcel-backend-go/pkg/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole allows the request only if the authenticated user has one of
+// the given roles. It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		logger.Errorf("role %q not allowed for %s", role, c.FullPath())
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	}
+}
@@ -1,11 +1,14 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	logger "interviewexcel-backend-go/pkg/errors"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AvailabilitySlotStatus string
@@ -14,6 +17,7 @@ const (
 	SlotAvailable AvailabilitySlotStatus = "AVAILABLE"
 	SlotBooked    AvailabilitySlotStatus = "BOOKED"
 	SlotCancelled AvailabilitySlotStatus = "CANCELLED"
+	SlotHeld      AvailabilitySlotStatus = "HELD" // reserved for a student's open payment order
 )
 
 type AvailabilitySlot struct {
@@ -30,8 +34,44 @@ type AvailabilitySlot struct {
 
 	Status    string `gorm:"type:varchar(20);default:'available';index" json:"status"`
 	StudentID *uint  `gorm:"index" json:"student_id,omitempty"`
+
+	// Set while Status is HELD; the hold lapses on its own once HeldUntil passes.
+	HeldUntil   *time.Time `json:"held_until,omitempty"`
+	HoldOrderID string     `gorm:"index" json:"hold_order_id,omitempty"`
+
+	RuleID *uint `gorm:"index" json:"rule_id,omitempty"` // AvailabilityRule that generated it
+}
+
+// HoldExpired reports whether the slot is HELD by a hold that has lapsed.
+func (s *AvailabilitySlot) HoldExpired(now time.Time) bool {
+	return s.Status == string(SlotHeld) && s.HeldUntil != nil && !s.HeldUntil.After(now)
+}
+
+// HoldableBy reports whether the student could hold the slot at now, on the
+// same terms as LockForHoldWithTx.
+func (s *AvailabilitySlot) HoldableBy(studentID uint, now time.Time) bool {
+	if s.StartTime.Before(now) {
+		return false
+	}
+	switch s.Status {
+	case string(SlotAvailable):
+		return true
+	case string(SlotHeld):
+		return s.HoldExpired(now) || (s.StudentID != nil && *s.StudentID == studentID)
+	}
+	return false
+}
+
+// Active reports whether the slot takes up its time. An expert's active
+// slots never overlap; availability_slots_no_overlap enforces this.
+func (s *AvailabilitySlot) Active() bool {
+	return s.Status != string(SlotCancelled)
 }
 
+// ErrSlotOverlap is returned when a slot would overlap another active slot
+// of the same expert.
+var ErrSlotOverlap = errors.New("slot overlaps another active slot of the expert")
+
 type availabilitySlotRepo struct {
 	DB *gorm.DB
 }
@@ -47,15 +87,103 @@ func (r *availabilitySlotRepo) GetAllByExpert(expertID string) ([]AvailabilitySl
 	return slots, err
 }
 
-// Get all available (not booked) slots
+// Get all open slots, including ones currently held for checkout.
+// Held slots keep Status HELD so students can see they are taken for now;
+// lapsed holds are reported as AVAILABLE.
 func (r *availabilitySlotRepo) GetAvailableByExpert(expertID string) ([]AvailabilitySlot, error) {
 	var slots []AvailabilitySlot
-	err := r.DB.Where("expert_id = ? AND is_booked = false AND start_time >= ?", expertID, time.Now()).
+	now := time.Now()
+	err := r.DB.Where("expert_id = ? AND status IN ? AND start_time >= ?",
+		expertID, []string{string(SlotAvailable), string(SlotHeld)}, now).
 		Order("date ASC, start_time ASC").
 		Find(&slots).Error
+
+	for i := range slots {
+		if slots[i].HoldExpired(now) {
+			slots[i].Status = string(SlotAvailable)
+			slots[i].StudentID = nil
+			slots[i].HeldUntil = nil
+			slots[i].HoldOrderID = ""
+		}
+	}
+	return slots, err
+}
+
+// LockForHoldWithTx locks a future slot the student may hold: one that is
+// available, held by a lapsed hold, or already held by the same student
+// (a repeated checkout moves the hold to the new order).
+func (r *availabilitySlotRepo) LockForHoldWithTx(tx *gorm.DB, slotID uint, studentID uint) (*AvailabilitySlot, error) {
+	var slot AvailabilitySlot
+	now := time.Now()
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND start_time >= ?", slotID, now).
+		Where(
+			tx.Where("status = ?", string(SlotAvailable)).
+				Or("status = ? AND (held_until <= ? OR student_id = ?)", string(SlotHeld), now, studentID),
+		).
+		First(&slot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// HoldWithTx holds a slot locked by LockForHoldWithTx for the order until
+// the given time.
+func (r *availabilitySlotRepo) HoldWithTx(tx *gorm.DB, slotID uint, studentID uint, orderID string, until time.Time) error {
+	return tx.Model(&AvailabilitySlot{}).
+		Where("id = ?", slotID).
+		Updates(map[string]interface{}{
+			"status":        string(SlotHeld),
+			"student_id":    studentID,
+			"held_until":    until,
+			"hold_order_id": orderID,
+		}).Error
+}
+
+// LockForBookingWithTx locks a slot that the given order may book: an
+// available slot, one held for this order, or one whose hold has lapsed.
+func (r *availabilitySlotRepo) LockForBookingWithTx(tx *gorm.DB, slotID uint, orderID string) (*AvailabilitySlot, error) {
+	var slot AvailabilitySlot
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", slotID).
+		Where(
+			tx.Where("status = ?", string(SlotAvailable)).
+				Or("status = ? AND (hold_order_id = ? OR held_until <= ?)", string(SlotHeld), orderID, time.Now()),
+		).
+		First(&slot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// LockByIDsWithTx locks the given slots in ID order, so two transactions
+// locking the same pair cannot deadlock.
+func (r *availabilitySlotRepo) LockByIDsWithTx(tx *gorm.DB, ids []uint) ([]AvailabilitySlot, error) {
+	var slots []AvailabilitySlot
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id ASC").
+		Find(&slots).Error
 	return slots, err
 }
 
+// MarkBookedWithTx books the slot for the student and clears any hold.
+func (r *availabilitySlotRepo) MarkBookedWithTx(tx *gorm.DB, slotID uint, studentID uint) error {
+	return tx.Model(&AvailabilitySlot{}).
+		Where("id = ?", slotID).
+		Updates(map[string]interface{}{
+			"status":        string(SlotBooked),
+			"student_id":    studentID,
+			"held_until":    nil,
+			"hold_order_id": "",
+		}).Error
+}
+
 // Get slot by ID
 func (r *availabilitySlotRepo) GetByID(id uint) (*AvailabilitySlot, error) {
 	var slot AvailabilitySlot
@@ -68,6 +196,100 @@ func (r *availabilitySlotRepo) MarkAsBooked(id uint) error {
 	return r.DB.Model(&AvailabilitySlot{}).Where("id = ?", id).Update("is_booked", true).Error
 }
 
+// ReleaseWithTx makes a slot bookable again, dropping its student and any hold.
+func (r *availabilitySlotRepo) ReleaseWithTx(tx *gorm.DB, slotID uint) error {
+	return tx.Model(&AvailabilitySlot{}).
+		Where("id = ?", slotID).
+		Updates(map[string]interface{}{
+			"status":        string(SlotAvailable),
+			"student_id":    nil,
+			"held_until":    nil,
+			"hold_order_id": "",
+		}).Error
+}
+
+// ReleaseHoldsWithTx releases slots still held for any of the orders. Slots
+// booked or re-held for another order meanwhile are left alone.
+func (r *availabilitySlotRepo) ReleaseHoldsWithTx(tx *gorm.DB, orderIDs []string) (int64, error) {
+	result := tx.Model(&AvailabilitySlot{}).
+		Where("status = ? AND hold_order_id IN ?", string(SlotHeld), orderIDs).
+		Updates(map[string]interface{}{
+			"status":        string(SlotAvailable),
+			"student_id":    nil,
+			"held_until":    nil,
+			"hold_order_id": "",
+		})
+	return result.RowsAffected, result.Error
+}
+
+// InsertWithTx creates one slot. If it overlaps an active slot of the same
+// expert it returns ErrSlotOverlap and leaves tx usable.
+func (r *availabilitySlotRepo) InsertWithTx(tx *gorm.DB, slot *AvailabilitySlot) error {
+	if err := tx.SavePoint("slot_insert").Error; err != nil {
+		return err
+	}
+
+	err := tx.Create(slot).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" { // exclusion_violation
+		if err := tx.RollbackTo("slot_insert").Error; err != nil {
+			return err
+		}
+		return ErrSlotOverlap
+	}
+	return err
+}
+
+// ListOverlappingWithTx returns the expert's slots, in any status, that
+// overlap [from, to).
+func (r *availabilitySlotRepo) ListOverlappingWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time) ([]AvailabilitySlot, error) {
+	var slots []AvailabilitySlot
+	err := tx.
+		Where("expert_id = ? AND start_time < ? AND end_time > ?", expertID, to, from).
+		Order("start_time ASC").
+		Find(&slots).Error
+	return slots, err
+}
+
+// ListLiveHoldsWithTx returns the expert's slots overlapping [from, to)
+// that are held for an open payment order as of now.
+func (r *availabilitySlotRepo) ListLiveHoldsWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time, now time.Time) ([]AvailabilitySlot, error) {
+	var slots []AvailabilitySlot
+	err := tx.
+		Where("expert_id = ? AND status = ? AND held_until > ? AND start_time < ? AND end_time > ?",
+			expertID, string(SlotHeld), now, to, from).
+		Order("start_time ASC").
+		Find(&slots).Error
+	return slots, err
+}
+
+// DeleteUnbookedByRuleWithTx removes the rule's slots starting at or after
+// from that nobody has booked or is paying for. Booked and held slots stay.
+func (r *availabilitySlotRepo) DeleteUnbookedByRuleWithTx(tx *gorm.DB, ruleID uint, from time.Time) (int64, error) {
+	result := tx.
+		Where("rule_id = ? AND start_time >= ?", ruleID, from).
+		Where(
+			tx.Where("status = ?", string(SlotAvailable)).
+				Or("status = ? AND held_until <= ?", string(SlotHeld), from),
+		).
+		Delete(&AvailabilitySlot{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteUnbookedInRangeWithTx removes the expert's slots overlapping
+// [from, to) that nobody has booked or is paying for, as of now. Booked and
+// held slots stay.
+func (r *availabilitySlotRepo) DeleteUnbookedInRangeWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time, now time.Time) (int64, error) {
+	result := tx.
+		Where("expert_id = ? AND start_time < ? AND end_time > ?", expertID, to, from).
+		Where(
+			tx.Where("status = ?", string(SlotAvailable)).
+				Or("status = ? AND held_until <= ?", string(SlotHeld), now),
+		).
+		Delete(&AvailabilitySlot{})
+	return result.RowsAffected, result.Error
+}
+
 // Delete a slot
 func (r *availabilitySlotRepo) Delete(id uint) error {
 	return r.DB.Delete(&AvailabilitySlot{}, id).Error
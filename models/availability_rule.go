@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AvailabilityRule is an expert's recurring availability, e.g. Mon/Wed/Fri
+// 18:00–21:00 in 45-minute slots. The materializer keeps its slots created
+// a few weeks ahead, for dates between EffectiveFrom and EffectiveUntil.
+type AvailabilityRule struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ExpertID  string         `gorm:"not null;index" json:"expert_id"` // Expert.UserID
+
+	Days        pq.StringArray `gorm:"type:text[];not null" json:"days"`           // monday … sunday
+	StartTime   string         `gorm:"type:varchar(5);not null" json:"start_time"` // "18:00"
+	EndTime     string         `gorm:"type:varchar(5);not null" json:"end_time"`   // "21:00"
+	SlotMinutes int            `gorm:"not null" json:"slot_minutes"`
+
+	EffectiveFrom  time.Time  `gorm:"type:date;not null" json:"effective_from"`
+	EffectiveUntil *time.Time `gorm:"type:date" json:"effective_until,omitempty"` // inclusive; nil runs on
+}
+
+type availabilityRuleRepo struct {
+	DB *gorm.DB
+}
+
+func (r *availabilityRuleRepo) CreateWithTx(tx *gorm.DB, rule *AvailabilityRule) error {
+	return tx.Create(rule).Error
+}
+
+func (r *availabilityRuleRepo) ListByExpert(expertID string) ([]AvailabilityRule, error) {
+	var rules []AvailabilityRule
+	err := r.DB.Where("expert_id = ?", expertID).Order("effective_from ASC, id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// LockByExpertWithTx locks one of the expert's rules.
+func (r *availabilityRuleRepo) LockByExpertWithTx(tx *gorm.DB, id uint, expertID string) (*AvailabilityRule, error) {
+	var rule AvailabilityRule
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND expert_id = ?", id, expertID).
+		First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// LockForMaterializeWithTx locks the rule unless another instance is
+// materializing or editing it, in which case gorm.ErrRecordNotFound is
+// returned.
+func (r *availabilityRuleRepo) LockForMaterializeWithTx(tx *gorm.DB, id uint) (*AvailabilityRule, error) {
+	var rule AvailabilityRule
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ?", id).
+		First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *availabilityRuleRepo) SaveWithTx(tx *gorm.DB, rule *AvailabilityRule) error {
+	return tx.Save(rule).Error
+}
+
+func (r *availabilityRuleRepo) DeleteWithTx(tx *gorm.DB, id uint) error {
+	return tx.Delete(&AvailabilityRule{}, id).Error
+}
+
+// ListIDsInEffect returns the rules that may still produce slots on or
+// after the given date.
+func (r *availabilityRuleRepo) ListIDsInEffect(from time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&AvailabilityRule{}).
+		Where("effective_until IS NULL OR effective_until >= ?", from).
+		Order("id ASC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
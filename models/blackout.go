@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blackout is a period an expert is away, from the start of StartDate to
+// the end of EndDate in the expert's zone. No new slots are created inside
+// it. A vacation blackout also marks the expert unavailable while it lasts,
+// which hides them from the expert listing.
+type Blackout struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ExpertID  string         `gorm:"not null;index" json:"expert_id"` // Expert.UserID
+
+	StartDate time.Time `gorm:"type:date;not null" json:"start_date"`
+	EndDate   time.Time `gorm:"type:date;not null" json:"end_date"` // inclusive
+
+	// The period as instants, for queries
+	StartsAt time.Time `gorm:"not null;index" json:"starts_at"`
+	EndsAt   time.Time `gorm:"not null;index" json:"ends_at"`
+
+	Reason   string `json:"reason,omitempty"`
+	Vacation bool   `gorm:"default:false" json:"vacation"`
+}
+
+type blackoutRepo struct {
+	DB *gorm.DB
+}
+
+func (r *blackoutRepo) CreateWithTx(tx *gorm.DB, blackout *Blackout) error {
+	return tx.Create(blackout).Error
+}
+
+// ListCurrentByExpert returns the expert's blackouts that have not ended.
+func (r *blackoutRepo) ListCurrentByExpert(expertID string, now time.Time) ([]Blackout, error) {
+	var blackouts []Blackout
+	err := r.DB.
+		Where("expert_id = ? AND ends_at > ?", expertID, now).
+		Order("starts_at ASC, id ASC").
+		Find(&blackouts).Error
+	return blackouts, err
+}
+
+// LockByExpertWithTx locks one of the expert's blackouts.
+func (r *blackoutRepo) LockByExpertWithTx(tx *gorm.DB, id uint, expertID string) (*Blackout, error) {
+	var blackout Blackout
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND expert_id = ?", id, expertID).
+		First(&blackout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &blackout, nil
+}
+
+func (r *blackoutRepo) DeleteWithTx(tx *gorm.DB, id uint) error {
+	return tx.Delete(&Blackout{}, id).Error
+}
+
+// ListOverlappingWithTx returns the expert's blackouts that overlap
+// [from, to).
+func (r *blackoutRepo) ListOverlappingWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time) ([]Blackout, error) {
+	var blackouts []Blackout
+	err := tx.
+		Where("expert_id = ? AND starts_at < ? AND ends_at > ?", expertID, to, from).
+		Order("starts_at ASC").
+		Find(&blackouts).Error
+	return blackouts, err
+}
+
+// SyncExpertAvailabilityWithTx marks available experts on a vacation
+// blackout at now unavailable, and shows again the experts a vacation hid
+// once none is current, for the given experts or all of them when none are
+// given. Experts made unavailable for any other reason stay hidden. It
+// returns how many were hidden and shown.
+func (r *blackoutRepo) SyncExpertAvailabilityWithTx(tx *gorm.DB, now time.Time, expertIDs ...string) (int64, int64, error) {
+	onVacation := tx.Model(&Blackout{}).
+		Select("expert_id").
+		Where("vacation = ? AND starts_at <= ? AND ends_at > ?", true, now, now)
+
+	experts := func() *gorm.DB {
+		query := tx.Model(&Expert{})
+		if len(expertIDs) > 0 {
+			query = query.Where("user_id IN ?", expertIDs)
+		}
+		return query
+	}
+
+	hidden := experts().
+		Where("is_available = ? AND user_id IN (?)", true, onVacation).
+		Updates(map[string]interface{}{"is_available": false, "hidden_for_vacation": true})
+	if hidden.Error != nil {
+		return 0, 0, hidden.Error
+	}
+
+	shown := experts().
+		Where("hidden_for_vacation = ? AND user_id NOT IN (?)", true, onVacation).
+		Updates(map[string]interface{}{"is_available": true, "hidden_for_vacation": false})
+	return hidden.RowsAffected, shown.RowsAffected, shown.Error
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CouponDiscountType string
+
+const (
+	CouponPercent CouponDiscountType = "percent"
+	CouponFlat    CouponDiscountType = "flat"
+)
+
+// CouponFunding says whose share of the session fee a discount comes out of.
+type CouponFunding string
+
+const (
+	CouponFundedByPlatform CouponFunding = "platform"
+	CouponFundedByExpert   CouponFunding = "expert"
+)
+
+// Coupon is a promo code belonging to a discount campaign. Limits of zero
+// mean unlimited; empty expert and specialization lists mean any expert.
+type Coupon struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Code        string `gorm:"uniqueIndex;not null" json:"code"` // stored upper-case
+	Description string `json:"description"`
+	Active      bool   `gorm:"default:true" json:"active"`
+
+	DiscountType       string `gorm:"type:varchar(10);not null" json:"discount_type"` // percent, flat
+	PercentOff         int    `json:"percent_off,omitempty"`
+	AmountOffInPaise   int64  `json:"amount_off_in_paise,omitempty"`
+	MaxDiscountInPaise int64  `json:"max_discount_in_paise,omitempty"`            // caps percentage discounts
+	FundedBy           string `gorm:"type:varchar(10);not null" json:"funded_by"` // platform, expert
+
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+
+	MaxRedemptions        int   `json:"max_redemptions"`
+	MaxRedemptionsPerUser int   `json:"max_redemptions_per_user"`
+	RedemptionCount       int   `gorm:"default:0" json:"redemption_count"`
+	MinFeeInPaise         int64 `json:"min_fee_in_paise"`
+
+	// Restrict to these experts (user UUIDs) or to experts with any of these specializations
+	ExpertUUIDs     pq.StringArray `gorm:"type:text[]" json:"expert_uuids,omitempty"`
+	Specializations pq.StringArray `gorm:"type:text[]" json:"specializations,omitempty"`
+}
+
+// Where a coupon redemption stands
+const (
+	CouponRedemptionPending   = "pending"   // reserved by an open order
+	CouponRedemptionConfirmed = "confirmed" // the order was paid and booked
+)
+
+// CouponRedemption records one use of a coupon. It is reserved, as pending,
+// when the order is opened, and confirmed in the transaction that books the
+// session. An order that expires unpaid releases it. Pending redemptions
+// count against the coupon's limits like confirmed ones.
+type CouponRedemption struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	CouponID        uint   `gorm:"index:idx_coupon_redemption_student;not null" json:"coupon_id"`
+	StudentID       uint   `gorm:"index:idx_coupon_redemption_student;not null" json:"student_id"`
+	OrderID         string `gorm:"uniqueIndex;not null" json:"order_id"`
+	Status          string `gorm:"type:varchar(20);default:'confirmed'" json:"status"` // pending, confirmed
+	SessionUUID     string `json:"session_uuid"`
+	DiscountInPaise int64  `json:"discount_in_paise"`
+	FundedBy        string `json:"funded_by"`
+}
+
+type couponRepo struct {
+	DB *gorm.DB
+}
+
+func (r *couponRepo) Create(coupon *Coupon) error {
+	return r.DB.Create(coupon).Error
+}
+
+func (r *couponRepo) GetByCode(code string) (*Coupon, error) {
+	var coupon Coupon
+	err := r.DB.Where("code = ?", code).First(&coupon).Error
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *couponRepo) GetByID(id uint) (*Coupon, error) {
+	var coupon Coupon
+	err := r.DB.First(&coupon, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetByIDForUpdate locks the coupon so redemptions are counted one at a time.
+func (r *couponRepo) GetByIDForUpdate(tx *gorm.DB, id uint) (*Coupon, error) {
+	var coupon Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *couponRepo) ListAll() ([]Coupon, error) {
+	var coupons []Coupon
+	err := r.DB.Order("created_at DESC").Find(&coupons).Error
+	return coupons, err
+}
+
+func (r *couponRepo) SetActive(id uint, active bool) error {
+	result := r.DB.Model(&Coupon{}).Where("id = ?", id).Update("active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountRedemptionsByStudent counts how often a student has used the coupon.
+func (r *couponRepo) CountRedemptionsByStudent(couponID uint, studentID uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&CouponRedemption{}).
+		Where("coupon_id = ? AND student_id = ?", couponID, studentID).
+		Count(&count).Error
+	return count, err
+}
+
+// HasPendingRedemption reports whether the order holds a reservation on
+// the coupon.
+func (r *couponRepo) HasPendingRedemption(couponID uint, orderID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&CouponRedemption{}).
+		Where("coupon_id = ? AND order_id = ? AND status = ?", couponID, orderID, CouponRedemptionPending).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RedeemWithTx records the redemption and bumps the coupon's counter. A
+// second call for the same order is a no-op and reports false.
+func (r *couponRepo) RedeemWithTx(tx *gorm.DB, redemption *CouponRedemption) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(redemption)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	err := tx.Model(&Coupon{}).
+		Where("id = ?", redemption.CouponID).
+		UpdateColumn("redemption_count", gorm.Expr("redemption_count + 1")).Error
+	return err == nil, err
+}
+
+// ConfirmWithTx confirms the order's pending redemption for the booked
+// session. It reports false when the order has none.
+func (r *couponRepo) ConfirmWithTx(tx *gorm.DB, orderID string, sessionUUID string) (bool, error) {
+	result := tx.Model(&CouponRedemption{}).
+		Where("order_id = ? AND status = ?", orderID, CouponRedemptionPending).
+		Updates(map[string]interface{}{
+			"status":       CouponRedemptionConfirmed,
+			"session_uuid": sessionUUID,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseWithTx removes the order's pending redemption and gives its place
+// back to the coupon. Confirmed redemptions are kept.
+func (r *couponRepo) ReleaseWithTx(tx *gorm.DB, orderID string) error {
+	var released []CouponRedemption
+	err := tx.Clauses(clause.Returning{}).
+		Where("order_id = ? AND status = ?", orderID, CouponRedemptionPending).
+		Delete(&released).Error
+	if err != nil || len(released) == 0 {
+		return err
+	}
+
+	return tx.Model(&Coupon{}).
+		Where("id = ? AND redemption_count > 0", released[0].CouponID).
+		UpdateColumn("redemption_count", gorm.Expr("redemption_count - 1")).Error
+}
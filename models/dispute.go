@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DisputeStatus string
+
+const (
+	DisputeOpen     DisputeStatus = "open"
+	DisputeResolved DisputeStatus = "resolved"
+)
+
+// DisputeOutcome is how a resolved dispute settles the session.
+type DisputeOutcome string
+
+const (
+	DisputeRelease       DisputeOutcome = "release"        // the expert keeps the earnings
+	DisputeRefundFull    DisputeOutcome = "refund_full"    // the student gets everything back
+	DisputeRefundPartial DisputeOutcome = "refund_partial" // RefundPercent back, the rest released
+)
+
+// Dispute is raised by a student about a completed session. While a dispute
+// is open the expert's earnings for the session stay in escrow.
+type Dispute struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// At most one open dispute per session
+	SessionUUID string `gorm:"not null;uniqueIndex:idx_dispute_open_session,where:status = 'open'" json:"session_uuid"`
+	RaisedBy    string `gorm:"not null" json:"raised_by"` // user UUID
+	Reason      string `gorm:"not null" json:"reason"`
+	Status      string `gorm:"type:varchar(20);index;not null" json:"status"`
+
+	ResolvedBy    string     `json:"resolved_by,omitempty"`
+	Resolution    string     `json:"resolution,omitempty"`
+	Outcome       string     `gorm:"type:varchar(20)" json:"outcome,omitempty"`
+	RefundPercent int        `gorm:"default:0" json:"refund_percent,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+type disputeRepo struct {
+	DB *gorm.DB
+}
+
+func (r *disputeRepo) Create(dispute *Dispute) error {
+	return r.DB.Create(dispute).Error
+}
+
+func (r *disputeRepo) GetByID(id uint) (*Dispute, error) {
+	var dispute Dispute
+	err := r.DB.First(&dispute, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &dispute, nil
+}
+
+func (r *disputeRepo) ListByStatus(status DisputeStatus) ([]Dispute, error) {
+	var disputes []Dispute
+	err := r.DB.Where("status = ?", string(status)).Order("created_at ASC").Find(&disputes).Error
+	return disputes, err
+}
+
+func (r *disputeRepo) HasOpen(sessionUUID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&Dispute{}).
+		Where("session_uuid = ? AND status = ?", sessionUUID, string(DisputeOpen)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Resolve closes an open dispute. It returns gorm.ErrRecordNotFound when the
+// dispute does not exist or is already resolved.
+func (r *disputeRepo) Resolve(id uint, resolvedBy string, resolution string, outcome DisputeOutcome, refundPercent int) error {
+	now := time.Now()
+	result := r.DB.Model(&Dispute{}).
+		Where("id = ? AND status = ?", id, string(DisputeOpen)).
+		Updates(&Dispute{
+			Status:        string(DisputeResolved),
+			ResolvedBy:    resolvedBy,
+			Resolution:    resolution,
+			Outcome:       string(outcome),
+			RefundPercent: refundPercent,
+			ResolvedAt:    &now,
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Expert struct {
@@ -24,6 +25,7 @@ type Expert struct {
 	Languages         pq.StringArray `gorm:"type:text[]" json:"languages,omitempty"`
 	ProfilePictureUrl string         `json:"profile_picture_url,omitempty"`
 	FeesPerSession    int            `json:"fees_per_session"`
+	CommissionPercent *int           `json:"commission_percent,omitempty"` // overrides the platform default when set
 	City              string         `json:"city"`
 	Achievement       string         `json:"achievement"`
 	DOB               time.Time      `json:"dob"`
@@ -34,6 +36,22 @@ type Expert struct {
 	StudentMentored    int64   `gorm:"default:0" json:"student_mentored"`
 	IsAvailable        bool    `gorm:"default:true" json:"is_available"`
 
+	// Set while a vacation blackout keeps IsAvailable false, so only the
+	// experts it hid are shown again when it ends
+	HiddenForVacation bool `gorm:"default:false" json:"-"`
+
+	// Sessions the expert cancelled after they were booked
+	CancellationCount   int  `gorm:"default:0" json:"cancellation_count"`
+	CancellationFlagged bool `gorm:"default:false" json:"cancellation_flagged"`
+
+	// Limits on what students may book; 0 means no limit. Days and weeks
+	// (Monday to Sunday) are the expert's calendar ones.
+	BufferMinutes      int `gorm:"default:0" json:"buffer_minutes"` // kept free before and after each session
+	MaxSessionsPerDay  int `gorm:"default:0" json:"max_sessions_per_day"`
+	MaxSessionsPerWeek int `gorm:"default:0" json:"max_sessions_per_week"`
+	MinNoticeMinutes   int `gorm:"default:0" json:"min_notice_minutes"` // between booking and the start
+	MaxAdvanceDays     int `gorm:"default:0" json:"max_advance_days"`   // furthest day ahead, counted from today
+
 	AvailabilitySlots []AvailabilitySlot `gorm:"foreignKey:ExpertID;references:UserID" json:"availability_slots,omitempty"`
 }
 
@@ -92,6 +110,61 @@ func (e *expertRepo) UpdateWithTx(tx *gorm.DB, where *Expert, update *Expert) er
 	return nil
 }
 
+// RecordCancellationWithTx counts a booked session cancelled by the expert and
+// flags the expert once the count reaches flagThreshold (0 disables flagging).
+func (e *expertRepo) RecordCancellationWithTx(tx *gorm.DB, userUUID string, flagThreshold int) error {
+	updates := map[string]interface{}{
+		"cancellation_count": gorm.Expr("cancellation_count + 1"),
+	}
+	if flagThreshold > 0 {
+		updates["cancellation_flagged"] = gorm.Expr("cancellation_count + 1 >= ?", flagThreshold)
+	}
+
+	return tx.Model(&Expert{}).Where("user_id = ?", userUUID).Updates(updates).Error
+}
+
+// GetForUpdateWithTx locks the expert. Bookings lock it so that they are
+// checked against the expert's scheduling limits one at a time.
+func (e *expertRepo) GetForUpdateWithTx(tx *gorm.DB, userUUID string) (*Expert, error) {
+	var expert Expert
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userUUID).
+		First(&expert).Error
+	if err != nil {
+		return nil, err
+	}
+	return &expert, nil
+}
+
+// UpdateScheduling sets the expert's scheduling limits.
+func (e *expertRepo) UpdateScheduling(userUUID string, fields map[string]interface{}) error {
+	result := e.DB.Model(&Expert{}).
+		Where("user_id = ?", userUUID).
+		Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetCommissionPercent sets or (with nil) clears the expert's commission override.
+func (e *expertRepo) SetCommissionPercent(userUUID string, percent *int) error {
+	result := e.DB.Model(&Expert{}).
+		Where("user_id = ?", userUUID).
+		Update("commission_percent", percent)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 func (e *expertRepo) Delete(id uint64) error {
 	err := e.DB.Delete(&Expert{}, id).Error
 	if err != nil {
@@ -113,3 +186,14 @@ func (r *expertRepo) GetAllExpertsWithUserDetails() ([]Expert, error) {
 		Find(&experts).Error
 	return experts, err
 }
+
+// GetAvailableExpertsWithUserDetails leaves out experts who are away, such
+// as on a vacation blackout.
+func (r *expertRepo) GetAvailableExpertsWithUserDetails() ([]Expert, error) {
+	var experts []Expert
+	err := r.DB.
+		Preload("User").
+		Where("is_available = ?", true).
+		Find(&experts).Error
+	return experts, err
+}
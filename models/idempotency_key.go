@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKey stores the response to a request sent with an
+// Idempotency-Key header so a retry of the same request can be replayed.
+type IdempotencyKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Key      string `gorm:"uniqueIndex:idx_idempotency_key_user;not null" json:"key"`
+	UserUUID string `gorm:"uniqueIndex:idx_idempotency_key_user;not null" json:"user_uuid"`
+
+	Method      string `gorm:"type:varchar(10)" json:"method"`
+	Path        string `json:"path"`
+	RequestHash string `gorm:"type:varchar(64)" json:"request_hash"`
+
+	// Empty until the first request finishes
+	StatusCode   int        `json:"status_code"`
+	ContentType  string     `json:"content_type"`
+	ResponseBody []byte     `json:"-"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+type idempotencyKeyRepo struct {
+	DB *gorm.DB
+}
+
+// CreateIfAbsent inserts the key and reports whether it was new.
+func (r *idempotencyKeyRepo) CreateIfAbsent(key *IdempotencyKey) (bool, error) {
+	result := r.DB.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}, {Name: "user_uuid"}},
+			DoNothing: true,
+		}).
+		Create(key)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *idempotencyKeyRepo) Get(key string, userUUID string) (*IdempotencyKey, error) {
+	var record IdempotencyKey
+	err := r.DB.Where("key = ? AND user_uuid = ?", key, userUUID).First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *idempotencyKeyRepo) Complete(id uint, statusCode int, contentType string, body []byte) error {
+	now := time.Now()
+	return r.DB.Model(&IdempotencyKey{}).
+		Where("id = ?", id).
+		Updates(&IdempotencyKey{
+			StatusCode:   statusCode,
+			ContentType:  contentType,
+			ResponseBody: body,
+			CompletedAt:  &now,
+		}).Error
+}
+
+func (r *idempotencyKeyRepo) Delete(id uint) error {
+	return r.DB.Delete(&IdempotencyKey{}, id).Error
+}
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type IExpert interface {
 	Create(s *Expert) error
@@ -10,9 +14,14 @@ type IExpert interface {
 	GetWithTx(tx *gorm.DB, where *Expert) (*Expert, error)
 	Update(where *Expert, a *Expert) error
 	UpdateWithTx(tx *gorm.DB, where *Expert, a *Expert) error
+	RecordCancellationWithTx(tx *gorm.DB, userUUID string, flagThreshold int) error
+	SetCommissionPercent(userUUID string, percent *int) error
+	GetForUpdateWithTx(tx *gorm.DB, userUUID string) (*Expert, error)
+	UpdateScheduling(userUUID string, fields map[string]interface{}) error
 	Delete(where uint64) error
 	GetAll() ([]Expert, error)
 	GetAllExpertsWithUserDetails() ([]Expert, error)
+	GetAvailableExpertsWithUserDetails() ([]Expert, error)
 }
 
 type IAvailabilitySlotRepo interface {
@@ -20,6 +29,13 @@ type IAvailabilitySlotRepo interface {
 	GetAllByExpert(expertID string) ([]AvailabilitySlot, error)
 	GetAvailableByExpert(expertID string) ([]AvailabilitySlot, error)
 	GetByID(id uint) (*AvailabilitySlot, error)
+	LockForHoldWithTx(tx *gorm.DB, slotID uint, studentID uint) (*AvailabilitySlot, error)
+	HoldWithTx(tx *gorm.DB, slotID uint, studentID uint, orderID string, until time.Time) error
+	LockForBookingWithTx(tx *gorm.DB, slotID uint, orderID string) (*AvailabilitySlot, error)
+	LockByIDsWithTx(tx *gorm.DB, ids []uint) ([]AvailabilitySlot, error)
+	MarkBookedWithTx(tx *gorm.DB, slotID uint, studentID uint) error
+	ReleaseWithTx(tx *gorm.DB, slotID uint) error
+	ReleaseHoldsWithTx(tx *gorm.DB, orderIDs []string) (int64, error)
 	MarkAsBooked(id uint) error
 	Delete(id uint) error
 	Update(slot *AvailabilitySlot) error
@@ -28,27 +44,178 @@ type IAvailabilitySlotRepo interface {
 	GetBookedSlotsByExpert(expertID uint) ([]AvailabilitySlot, error)
 	CountAvailableSlotsByExpert(expertID string) (int64, error)
 	CountBookedSlotsByExpertUUID(expertID string) (int64, error)
+	InsertWithTx(tx *gorm.DB, slot *AvailabilitySlot) error
+	ListOverlappingWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time) ([]AvailabilitySlot, error)
+	ListLiveHoldsWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time, now time.Time) ([]AvailabilitySlot, error)
+	DeleteUnbookedByRuleWithTx(tx *gorm.DB, ruleID uint, from time.Time) (int64, error)
+	DeleteUnbookedInRangeWithTx(tx *gorm.DB, expertID string, from time.Time, to time.Time, now time.Time) (int64, error)
+}
+
+type IAvailabilityRuleRepo interface {
+	CreateWithTx(tx *gorm.DB, rule *AvailabilityRule) error
+	ListByExpert(expertID string) ([]AvailabilityRule, error)
+	LockByExpertWithTx(tx *gorm.DB, id uint, expertID string) (*AvailabilityRule, error)
+	LockForMaterializeWithTx(tx *gorm.DB, id uint) (*AvailabilityRule, error)
+	SaveWithTx(tx *gorm.DB, rule *AvailabilityRule) error
+	DeleteWithTx(tx *gorm.DB, id uint) error
+	ListIDsInEffect(from time.Time) ([]uint, error)
 }
 
 type IWalletRepo interface {
 	GetByUserUUID(userUUID string) (*Wallet, error)
 	Create(wallet *Wallet) error
-	UpdateBalance(userUUID string, newBalanceInPaise int64) error
+	ListAll() ([]Wallet, error)
+	GetOrCreate(userUUID string) (*Wallet, error)
+	IncrementBalance(userUUID string, delta int64) error
+	IncrementPendingBalance(userUUID string, delta int64) error
+	DebitIfSufficient(userUUID string, amount int64) (bool, error)
+	ReleasePending(userUUID string, amount int64) error
 }
 
 type IWalletTransactionRepo interface {
 	Create(tx *gorm.DB, wt *WalletTransaction) error
 	GetByWalletID(walletID uint) ([]WalletTransaction, error)
 	GetByReferenceID(referenceID string) ([]WalletTransaction, error)
+	List(walletID uint, filter WalletTransactionFilter) ([]WalletTransaction, error)
+	ListBetween(walletID uint, from time.Time, to time.Time) ([]WalletTransaction, error)
+	BalancesBefore(walletID uint, before time.Time) (available int64, pending int64, err error)
 }
 
 type IPaymentRepo interface {
 	Create(payment *Payment) error
 	GetByOrderID(orderID string) (*Payment, error)
+	GetByOrderIDForUpdate(tx *gorm.DB, orderID string) (*Payment, error)
+	GetByPaymentID(paymentID string) (*Payment, error)
+	Update(payment *Payment) error
+	UpdateWithTx(tx *gorm.DB, payment *Payment, where *Payment) error
+	GetByOrderIDs(orderIDs []string) ([]Payment, error)
+	ListCreatedBetween(from time.Time, to time.Time) ([]Payment, error)
+	CountByStatusBetween(from time.Time, to time.Time) ([]PaymentFunnelRow, error)
+	LockAbandonedWithTx(tx *gorm.DB, createdBefore time.Time, limit int) ([]Payment, error)
+	MarkExpiredWithTx(tx *gorm.DB, ids []uint, at time.Time) error
+}
+
+type IInvoiceRepo interface {
+	NextSequence(financialYear string) (int64, error)
+	Create(invoice *Invoice) error
+	GetByOrderID(orderID string) (*Invoice, error)
+	GetByPaymentID(paymentID uint) (*Invoice, error)
+}
+
+type ICouponRepo interface {
+	Create(coupon *Coupon) error
+	GetByCode(code string) (*Coupon, error)
+	GetByID(id uint) (*Coupon, error)
+	GetByIDForUpdate(tx *gorm.DB, id uint) (*Coupon, error)
+	ListAll() ([]Coupon, error)
+	SetActive(id uint, active bool) error
+	CountRedemptionsByStudent(couponID uint, studentID uint) (int64, error)
+	HasPendingRedemption(couponID uint, orderID string) (bool, error)
+	RedeemWithTx(tx *gorm.DB, redemption *CouponRedemption) (bool, error)
+	ConfirmWithTx(tx *gorm.DB, orderID string, sessionUUID string) (bool, error)
+	ReleaseWithTx(tx *gorm.DB, orderID string) error
+}
+
+type IPackageRepo interface {
+	Create(pkg *Package) error
+	GetByID(id uint) (*Package, error)
+	ListAll() ([]Package, error)
+	ListActive() ([]Package, error)
+	SetActive(id uint, active bool) error
+	CreatePurchaseWithTx(tx *gorm.DB, purchase *StudentPackage) error
+	GetPurchaseByOrderID(orderID string) (*StudentPackage, error)
+	GetPurchaseByOrderIDForUpdate(tx *gorm.DB, orderID string) (*StudentPackage, error)
+	ActivatePurchaseWithTx(tx *gorm.DB, id uint, activatedAt time.Time, expiresAt time.Time) error
+	ListPurchasesByStudent(studentID uint) ([]StudentPackage, error)
+}
+
+type ISessionCreditRepo interface {
+	CreateWithTx(tx *gorm.DB, credits []SessionCredit) error
+	LockUsableWithTx(tx *gorm.DB, studentID uint, now time.Time) ([]SessionCredit, error)
+	MarkUsedWithTx(tx *gorm.DB, id uint, sessionUUID string, at time.Time) error
+	RestoreWithTx(tx *gorm.DB, id uint) error
+	LockExpiredWithTx(tx *gorm.DB, now time.Time, limit int) ([]SessionCredit, error)
+	MarkExpiredWithTx(tx *gorm.DB, id uint) error
+	ListByStudent(studentID uint) ([]SessionCredit, error)
+	ListBySource(source string, sourceID uint) ([]SessionCredit, error)
+}
+
+type ISubscriptionRepo interface {
+	CreatePlan(plan *Plan) error
+	GetPlanByID(id uint) (*Plan, error)
+	ListPlans() ([]Plan, error)
+	ListActivePlans() ([]Plan, error)
+	SetPlanActive(id uint, active bool) error
+	CreateWithTx(tx *gorm.DB, subscription *Subscription) error
+	GetCurrentByStudent(studentID uint) (*Subscription, error)
+	GetCurrentByStudentForUpdate(tx *gorm.DB, studentID uint) (*Subscription, error)
+	GetByIDForUpdate(tx *gorm.DB, id uint) (*Subscription, error)
+	UpdateWithTx(tx *gorm.DB, id uint, fields map[string]interface{}) error
+	GetNextDueForRenewal(now time.Time, excluded []uint) (*Subscription, error)
+	LockDueForRenewalWithTx(tx *gorm.DB, id uint, now time.Time) (*Subscription, error)
+	LockGraceExpiredWithTx(tx *gorm.DB, now time.Time, limit int) ([]Subscription, error)
+	CreateChargeWithTx(tx *gorm.DB, charge *SubscriptionCharge) error
+	GetChargeByOrderID(orderID string) (*SubscriptionCharge, error)
+	GetChargeByOrderIDForUpdate(tx *gorm.DB, orderID string) (*SubscriptionCharge, error)
+	MarkChargePaidWithTx(tx *gorm.DB, id uint, periodStart time.Time, periodEnd time.Time, paidAt time.Time) error
+	VoidPendingChargesWithTx(tx *gorm.DB, subscriptionID uint, kinds ...string) ([]string, error)
+	ListChargesBySubscription(subscriptionID uint) ([]SubscriptionCharge, error)
+}
+
+type IWalletCreditRepo interface {
+	CreateWithTx(tx *gorm.DB, credit *WalletCredit) error
+	LockSpendableWithTx(tx *gorm.DB, userUUID string, now time.Time) ([]WalletCredit, error)
+	SpendWithTx(tx *gorm.DB, creditID uint, orderID string, amount int64) error
+	ReleaseUsesWithTx(tx *gorm.DB, orderID string, at time.Time) (int64, error)
+	LockExpiredWithTx(tx *gorm.DB, now time.Time, limit int) ([]WalletCredit, error)
+	MarkExpiredWithTx(tx *gorm.DB, creditID uint, at time.Time) error
+	ListActiveByUser(userUUID string, now time.Time) ([]WalletCredit, error)
+}
+
+type IWebhookEventRepo interface {
+	CreateIfAbsent(event *WebhookEvent) (bool, error)
+	UpdateStatus(eventID string, status WebhookEventStatus, errMsg string) error
+	Delete(eventID string) error
+}
+
+type IIdempotencyKeyRepo interface {
+	CreateIfAbsent(key *IdempotencyKey) (bool, error)
+	Get(key string, userUUID string) (*IdempotencyKey, error)
+	Complete(id uint, statusCode int, contentType string, body []byte) error
+	Delete(id uint) error
+}
+
+type IDisputeRepo interface {
+	Create(dispute *Dispute) error
+	GetByID(id uint) (*Dispute, error)
+	ListByStatus(status DisputeStatus) ([]Dispute, error)
+	HasOpen(sessionUUID string) (bool, error)
+	Resolve(id uint, resolvedBy string, resolution string, outcome DisputeOutcome, refundPercent int) error
+}
+
+type IPayoutAccountRepo interface {
+	GetByExpertUUID(expertUUID string) (*PayoutAccount, error)
+	Upsert(account *PayoutAccount) error
+}
+
+type IPayoutRepo interface {
+	Create(payout *Payout) error
+	GetByUUID(payoutUUID string) (*Payout, error)
+	GetByUUIDForUpdate(payoutUUID string) (*Payout, error)
+	ListByExpert(expertUUID string) ([]Payout, error)
+	ListByStatus(status PayoutStatus, limit int) ([]Payout, error)
+	Update(payoutUUID string, updates map[string]interface{}) error
+}
+
+type ILedgerRepo interface {
+	Create(txn *LedgerTransaction) error
+	AccountBalances() (map[string]int64, error)
+	Unbalanced() ([]LedgerUnbalanced, error)
 }
 
 type IStudent interface {
 	Create(student *Student) error
+	GetByID(id uint) (*Student, error)
 	GetByUserUUID(uuid string) (*Student, error)
 	UpdateByUserUUID(uuid string, updates map[string]interface{}) error
 	DeleteByUserUUID(uuid string) error
@@ -58,13 +225,24 @@ type IStudent interface {
 type ISession interface {
 	Create(session *Session) error
 	GetByUUID(sessionUUID string) (*Session, error)
+	GetByOrderID(orderID string) (*Session, error)
+	GetByUUIDs(sessionUUIDs []string) ([]Session, error)
 	GetByStudentUUID(studentUUID string) ([]Session, error)
 	GetByExpertUUID(expertUUID string) ([]Session, error)
 	GetUpcomingForUser(userUUID string) ([]Session, error)
 	ExistsForSlot(slotID uint) (bool, error)
 	UpdateStatus(sessionUUID string, status string) error
 	Cancel(sessionUUID string) error
+	GetByUUIDForUpdate(sessionUUID string) (*Session, error)
+	CancelWithDetails(sessionUUID string, cancelledBy string, reason string) error
+	Reschedule(sessionUUID string, slot *AvailabilitySlot, meetLink string) error
 	MarkCompleted(sessionUUID string) error
+	CompleteEnded(endedBefore time.Time) (int64, int64, error)
+	MarkJoined(sessionUUID string, asExpert bool, at time.Time) error
+	GetReleasable(endedBefore time.Time, limit int) ([]Session, error)
+	GetNoShowsToRefund(endedBefore time.Time, limit int) ([]Session, error)
+	MarkRefunded(sessionUUID string, at time.Time) error
+	MarkEarningsReleased(sessionUUID string) error
 	Delete(sessionUUID string) error
 }
 type IUser interface {
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invoice is the tax invoice issued once for a paid Payment. Amounts are in
+// paise and are frozen at issue time so re-rendering never changes them.
+type Invoice struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	InvoiceNumber string    `gorm:"uniqueIndex;not null" json:"invoice_number"`
+	FinancialYear string    `gorm:"type:varchar(7);not null" json:"financial_year"` // e.g. 2026-27
+	Sequence      int64     `gorm:"not null" json:"sequence"`
+	IssuedAt      time.Time `gorm:"not null" json:"issued_at"`
+
+	PaymentID   uint   `gorm:"uniqueIndex;not null" json:"payment_id"` // references Payment.ID
+	OrderID     string `gorm:"uniqueIndex;not null" json:"order_id"`
+	StudentUUID string `gorm:"index;not null" json:"student_uuid"`
+	ExpertUUID  string `json:"expert_uuid"`
+	SessionUUID string `json:"session_uuid,omitempty"`
+
+	BilledName  string `json:"billed_name"`
+	BilledEmail string `json:"billed_email"`
+	BilledState string `json:"billed_state"`
+
+	SupplierName    string `json:"supplier_name"`
+	SupplierAddress string `json:"supplier_address"`
+	SupplierGSTIN   string `json:"supplier_gstin"`
+	SupplierState   string `json:"supplier_state"`
+
+	Description        string `json:"description"` // what was sold; empty for a single session
+	Currency           string `json:"currency"`
+	BaseFeeInPaise     int64  `json:"base_fee_in_paise"`     // expert's session fee
+	PlatformFeeInPaise int64  `json:"platform_fee_in_paise"` // taxable value of the platform fee
+	GSTRatePercent     int    `json:"gst_rate_percent"`
+	CGSTInPaise        int64  `json:"cgst_in_paise"`
+	SGSTInPaise        int64  `json:"sgst_in_paise"`
+	IGSTInPaise        int64  `json:"igst_in_paise"`
+	TotalInPaise       int64  `json:"total_in_paise"`
+}
+
+// InvoiceSequence holds the last invoice number used in a financial year.
+type InvoiceSequence struct {
+	FinancialYear string `gorm:"primaryKey;type:varchar(7)"`
+	LastNumber    int64  `gorm:"not null"`
+}
+
+var indiaTime = time.FixedZone("IST", 5*60*60+30*60)
+
+// FinancialYear returns the Indian financial year (April to March) that t
+// falls in, e.g. "2026-27" for any date from 1 April 2026 to 31 March 2027.
+func FinancialYear(t time.Time) string {
+	t = t.In(indiaTime)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+type invoiceRepo struct {
+	DB *gorm.DB
+}
+
+// NextSequence reserves the next invoice number in the financial year. The
+// counter row stays locked until the surrounding transaction ends, so the
+// series has no gaps or duplicates as long as it is called inside the
+// transaction that creates the invoice.
+func (r *invoiceRepo) NextSequence(financialYear string) (int64, error) {
+	var next int64
+	err := r.DB.Raw(`
+		INSERT INTO invoice_sequences (financial_year, last_number) VALUES (?, 1)
+		ON CONFLICT (financial_year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number`, financialYear).
+		Scan(&next).Error
+	return next, err
+}
+
+func (r *invoiceRepo) Create(invoice *Invoice) error {
+	return r.DB.Create(invoice).Error
+}
+
+func (r *invoiceRepo) GetByOrderID(orderID string) (*Invoice, error) {
+	var invoice Invoice
+	err := r.DB.Where("order_id = ?", orderID).First(&invoice).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *invoiceRepo) GetByPaymentID(paymentID uint) (*Invoice, error) {
+	var invoice Invoice
+	err := r.DB.Where("payment_id = ?", paymentID).First(&invoice).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
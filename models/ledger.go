@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ledger accounts. Every wallet has an available and a pending account;
+// money entering or leaving the platform goes through an external account.
+// Postings are signed: a positive amount increases what the platform owes
+// the account holder, so external accounts carry negative balances and all
+// postings sum to zero.
+const (
+	LedgerGatewayAccount = "external:gateway" // student payments in, refunds out
+	LedgerPayoutsAccount = "external:payouts" // expert withdrawals out
+	LedgerOpeningAccount = "external:opening" // balances that predate the ledger
+
+	// Prepaid package money not yet spent on a session
+	LedgerSessionCreditsAccount = "liability:session_credits"
+
+	// Order payments collected from wallet and gateway before being split
+	// between expert and platform
+	LedgerCheckoutAccount = "clearing:checkout"
+
+	LedgerPromotionsAccount     = "external:promotions"      // promotional and referral wallet credits
+	LedgerExpiredCreditsAccount = "external:expired_credits" // wallet and session credits forfeited at expiry
+)
+
+const (
+	LedgerBalanceAvailable = "available"
+	LedgerBalancePending   = "pending"
+)
+
+var ErrUnbalancedLedgerTransaction = errors.New("ledger postings do not balance")
+
+// WalletLedgerAccount names the ledger account for one of a user's balances.
+func WalletLedgerAccount(userUUID string, balance string) string {
+	return fmt.Sprintf("wallet:%s:%s", userUUID, balance)
+}
+
+// ParseWalletLedgerAccount is the inverse of WalletLedgerAccount.
+func ParseWalletLedgerAccount(account string) (userUUID string, balance string, ok bool) {
+	if !strings.HasPrefix(account, "wallet:") {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(account, "wallet:")
+	i := strings.LastIndex(rest, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// LedgerTransaction groups the postings of one money movement.
+type LedgerTransaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Kind        string `gorm:"type:varchar(30);index;not null" json:"kind"` // booking, release, refund, payout, ...
+	ReferenceID string `gorm:"index" json:"reference_id"`
+	Description string `json:"description"`
+
+	Postings []LedgerPosting `gorm:"foreignKey:LedgerTransactionID;constraint:OnDelete:RESTRICT;" json:"postings"`
+}
+
+type LedgerPosting struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	LedgerTransactionID uint   `gorm:"index;not null" json:"ledger_transaction_id"`
+	Account             string `gorm:"index;not null" json:"account"`
+	AmountInPaise       int64  `gorm:"not null" json:"amount_in_paise"`
+}
+
+type LedgerUnbalanced struct {
+	LedgerTransactionID uint
+	Sum                 int64
+}
+
+type ledgerRepo struct {
+	DB *gorm.DB
+}
+
+// Create stores a transaction with its postings. Postings must sum to zero.
+func (r *ledgerRepo) Create(txn *LedgerTransaction) error {
+	if len(txn.Postings) < 2 {
+		return ErrUnbalancedLedgerTransaction
+	}
+
+	var sum int64
+	for _, posting := range txn.Postings {
+		sum += posting.AmountInPaise
+	}
+	if sum != 0 {
+		return ErrUnbalancedLedgerTransaction
+	}
+
+	return r.DB.Create(txn).Error
+}
+
+// AccountBalances sums postings per account.
+func (r *ledgerRepo) AccountBalances() (map[string]int64, error) {
+	var rows []struct {
+		Account string
+		Total   int64
+	}
+	err := r.DB.Model(&LedgerPosting{}).
+		Select("account, COALESCE(SUM(amount_in_paise), 0) AS total").
+		Group("account").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		balances[row.Account] = row.Total
+	}
+	return balances, nil
+}
+
+// Unbalanced lists transactions whose postings do not sum to zero.
+func (r *ledgerRepo) Unbalanced() ([]LedgerUnbalanced, error) {
+	var rows []LedgerUnbalanced
+	err := r.DB.Model(&LedgerPosting{}).
+		Select("ledger_transaction_id, SUM(amount_in_paise) AS sum").
+		Group("ledger_transaction_id").
+		Having("SUM(amount_in_paise) <> 0").
+		Scan(&rows).Error
+	return rows, err
+}
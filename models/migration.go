@@ -4,13 +4,95 @@ var modelsForMigration = []interface{}{
 	&User{},
 	&Expert{},
 	&AvailabilitySlot{},
+	&AvailabilityRule{},
+	&Blackout{},
 	&Payment{},
 	&Student{},
 	&Session{},
 	&Wallet{},
 	&WalletTransaction{},
+	&LedgerTransaction{},
+	&LedgerPosting{},
+	&WebhookEvent{},
+	&IdempotencyKey{},
+	&Dispute{},
+	&PayoutAccount{},
+	&Payout{},
+	&Invoice{},
+	&InvoiceSequence{},
+	&Coupon{},
+	&CouponRedemption{},
+	&Package{},
+	&StudentPackage{},
+	&SessionCredit{},
+	&Plan{},
+	&Subscription{},
+	&SubscriptionCharge{},
+	&WalletCredit{},
+	&WalletCreditUse{},
+}
+
+// migrationStatements run after AutoMigrate, for schema it cannot express.
+// Each must be safe to run again.
+var migrationStatements = []string{
+	`CREATE EXTENSION IF NOT EXISTS btree_gist`,
+
+	// An expert's active (not cancelled, not deleted) slots must not overlap.
+	// Before adding the constraint, lapsed checkout holds are freed, and
+	// unbooked slots that overlap a booked or held slot, or an older unbooked
+	// one, are removed. Booked and held slots that still overlap each other
+	// need a person to decide which session goes: the migration then fails
+	// and lists every such pair, and nothing is changed.
+	`DO $$
+	DECLARE
+		conflicts text;
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'availability_slots_no_overlap') THEN
+			UPDATE availability_slots
+			SET status = 'AVAILABLE', student_id = NULL, held_until = NULL, hold_order_id = ''
+			WHERE deleted_at IS NULL AND status = 'HELD' AND held_until <= NOW();
+
+			UPDATE availability_slots AS s SET deleted_at = NOW()
+			WHERE s.deleted_at IS NULL AND s.status = 'AVAILABLE' AND EXISTS (
+				SELECT 1 FROM availability_slots AS o
+				WHERE o.expert_id = s.expert_id AND o.id <> s.id
+					AND o.deleted_at IS NULL AND o.status <> 'CANCELLED'
+					AND o.start_time < s.end_time AND o.end_time > s.start_time
+					AND (o.status <> 'AVAILABLE' OR o.id < s.id)
+			);
+
+			SELECT string_agg(
+				format('expert %s: slot %s (%s, %s) and slot %s (%s, %s)',
+					s.expert_id, s.id, s.status, s.start_time, o.id, o.status, o.start_time),
+				E'\n' ORDER BY s.expert_id, s.id, o.id)
+			INTO conflicts
+			FROM availability_slots AS s
+			JOIN availability_slots AS o
+				ON o.expert_id = s.expert_id AND o.id > s.id
+				AND o.deleted_at IS NULL AND o.status <> 'CANCELLED'
+				AND o.start_time < s.end_time AND o.end_time > s.start_time
+			WHERE s.deleted_at IS NULL AND s.status <> 'CANCELLED';
+
+			IF conflicts IS NOT NULL THEN
+				RAISE EXCEPTION E'booked or held availability slots overlap; cancel one session of each pair and migrate again:\n%', conflicts;
+			END IF;
+
+			ALTER TABLE availability_slots ADD CONSTRAINT availability_slots_no_overlap
+				EXCLUDE USING gist (expert_id WITH =, tstzrange(start_time, end_time) WITH &&)
+				WHERE (deleted_at IS NULL AND status <> 'CANCELLED');
+		END IF;
+	END $$`,
+
+	// Payments refunded because their slot was gone used to be stamped
+	// paid; nothing was sold, so the stamp becomes the capture time
+	`UPDATE payments SET captured_at = paid_at, paid_at = NULL
+	WHERE refund_reason <> '' AND paid_at IS NOT NULL`,
 }
 
 func GetMigrationModel() []interface{} {
 	return modelsForMigration
 }
+
+func GetMigrationStatements() []string {
+	return migrationStatements
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Package is a prepaid bundle of sessions sold at a fixed price. Empty
+// expert and specialization lists mean the credits work with any expert.
+type Package struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name         string `gorm:"not null" json:"name"`
+	Description  string `json:"description"`
+	Active       bool   `gorm:"default:true" json:"active"`
+	SessionCount int    `gorm:"not null" json:"session_count"`
+	PriceInPaise int64  `gorm:"not null" json:"price_in_paise"`
+	ValidityDays int    `gorm:"not null" json:"validity_days"` // counted from purchase
+
+	// Restrict to these experts (user UUIDs) or to experts with any of these specializations
+	ExpertUUIDs     pq.StringArray `gorm:"type:text[]" json:"expert_uuids,omitempty"`
+	Specializations pq.StringArray `gorm:"type:text[]" json:"specializations,omitempty"`
+}
+
+type StudentPackageStatus string
+
+const (
+	StudentPackagePending StudentPackageStatus = "pending" // order created, not paid
+	StudentPackageActive  StudentPackageStatus = "active"  // paid, credits issued
+)
+
+// StudentPackage is one purchase of a Package. Its credits are issued when
+// the order is paid.
+type StudentPackage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	StudentID uint   `gorm:"index;not null" json:"student_id"`
+	PackageID uint   `gorm:"index;not null" json:"package_id"`
+	OrderID   string `gorm:"uniqueIndex;not null" json:"order_id"` // Payment.OrderID
+	Status    string `gorm:"type:varchar(10);not null" json:"status"`
+
+	// Copied from the package at purchase time
+	Name         string `json:"name"`
+	SessionCount int    `json:"session_count"`
+	PriceInPaise int64  `json:"price_in_paise"`
+	ValidityDays int    `json:"validity_days"`
+
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type SessionCreditStatus string
+
+const (
+	SessionCreditAvailable SessionCreditStatus = "available"
+	SessionCreditUsed      SessionCreditStatus = "used"
+	SessionCreditExpired   SessionCreditStatus = "expired"
+)
+
+// Where a SessionCredit came from
+const (
+	SessionCreditFromPackage      = "package"
+	SessionCreditFromSubscription = "subscription"
+)
+
+// SessionCredit pays for one session without a gateway payment. Its value
+// is the share of the purchase price it stands for, and is what the expert
+// and the platform are credited when it is spent.
+type SessionCredit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	StudentID uint   `gorm:"index:idx_session_credit_student_status;not null" json:"student_id"`
+	Status    string `gorm:"type:varchar(10);index:idx_session_credit_student_status;not null" json:"status"`
+	Source    string `gorm:"type:varchar(20);not null" json:"source"` // package, subscription
+	SourceID  uint   `gorm:"index;not null" json:"source_id"`         // StudentPackage.ID or SubscriptionCharge.ID
+
+	ValueInPaise int64     `gorm:"not null" json:"value_in_paise"`
+	ExpiresAt    time.Time `gorm:"index;not null" json:"expires_at"`
+
+	ExpertUUIDs     pq.StringArray `gorm:"type:text[]" json:"expert_uuids,omitempty"`
+	Specializations pq.StringArray `gorm:"type:text[]" json:"specializations,omitempty"`
+
+	SessionUUID string     `gorm:"index" json:"session_uuid,omitempty"`
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+}
+
+type packageRepo struct {
+	DB *gorm.DB
+}
+
+func (r *packageRepo) Create(pkg *Package) error {
+	return r.DB.Create(pkg).Error
+}
+
+func (r *packageRepo) GetByID(id uint) (*Package, error) {
+	var pkg Package
+	err := r.DB.First(&pkg, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+func (r *packageRepo) ListAll() ([]Package, error) {
+	var packages []Package
+	err := r.DB.Order("created_at DESC").Find(&packages).Error
+	return packages, err
+}
+
+func (r *packageRepo) ListActive() ([]Package, error) {
+	var packages []Package
+	err := r.DB.Where("active = ?", true).Order("price_in_paise ASC").Find(&packages).Error
+	return packages, err
+}
+
+func (r *packageRepo) SetActive(id uint, active bool) error {
+	result := r.DB.Model(&Package{}).Where("id = ?", id).Update("active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *packageRepo) CreatePurchaseWithTx(tx *gorm.DB, purchase *StudentPackage) error {
+	return tx.Create(purchase).Error
+}
+
+func (r *packageRepo) GetPurchaseByOrderID(orderID string) (*StudentPackage, error) {
+	var purchase StudentPackage
+	err := r.DB.Where("order_id = ?", orderID).First(&purchase).Error
+	if err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+// GetPurchaseByOrderIDForUpdate locks the purchase paid for by the order.
+func (r *packageRepo) GetPurchaseByOrderIDForUpdate(tx *gorm.DB, orderID string) (*StudentPackage, error) {
+	var purchase StudentPackage
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		First(&purchase).Error
+	if err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+func (r *packageRepo) ActivatePurchaseWithTx(tx *gorm.DB, id uint, activatedAt time.Time, expiresAt time.Time) error {
+	return tx.Model(&StudentPackage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       string(StudentPackageActive),
+			"activated_at": activatedAt,
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+func (r *packageRepo) ListPurchasesByStudent(studentID uint) ([]StudentPackage, error) {
+	var purchases []StudentPackage
+	err := r.DB.
+		Where("student_id = ? AND status = ?", studentID, string(StudentPackageActive)).
+		Order("activated_at DESC").
+		Find(&purchases).Error
+	return purchases, err
+}
+
+type sessionCreditRepo struct {
+	DB *gorm.DB
+}
+
+func (r *sessionCreditRepo) CreateWithTx(tx *gorm.DB, credits []SessionCredit) error {
+	if len(credits) == 0 {
+		return nil
+	}
+	return tx.Create(&credits).Error
+}
+
+// LockUsableWithTx locks the student's unspent, unexpired credits, soonest
+// to expire first. Credits locked by a concurrent booking are skipped, so
+// two bookings never spend the same credit.
+func (r *sessionCreditRepo) LockUsableWithTx(tx *gorm.DB, studentID uint, now time.Time) ([]SessionCredit, error) {
+	var credits []SessionCredit
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("student_id = ? AND status = ? AND expires_at > ?", studentID, string(SessionCreditAvailable), now).
+		Order("expires_at ASC, id ASC").
+		Find(&credits).Error
+	return credits, err
+}
+
+func (r *sessionCreditRepo) MarkUsedWithTx(tx *gorm.DB, id uint, sessionUUID string, at time.Time) error {
+	return tx.Model(&SessionCredit{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       string(SessionCreditUsed),
+			"session_uuid": sessionUUID,
+			"used_at":      at,
+		}).Error
+}
+
+// RestoreWithTx makes the credit spent on the session available again. It
+// keeps its original expiry.
+func (r *sessionCreditRepo) RestoreWithTx(tx *gorm.DB, id uint) error {
+	return tx.Model(&SessionCredit{}).
+		Where("id = ? AND status = ?", id, string(SessionCreditUsed)).
+		Updates(map[string]interface{}{
+			"status":       string(SessionCreditAvailable),
+			"session_uuid": "",
+			"used_at":      nil,
+		}).Error
+}
+
+// LockExpiredWithTx locks up to limit unspent credits past their expiry.
+// Rows locked by another instance are skipped.
+func (r *sessionCreditRepo) LockExpiredWithTx(tx *gorm.DB, now time.Time, limit int) ([]SessionCredit, error) {
+	var credits []SessionCredit
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND expires_at <= ?", string(SessionCreditAvailable), now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&credits).Error
+	return credits, err
+}
+
+func (r *sessionCreditRepo) MarkExpiredWithTx(tx *gorm.DB, id uint) error {
+	return tx.Model(&SessionCredit{}).
+		Where("id = ?", id).
+		Update("status", string(SessionCreditExpired)).Error
+}
+
+func (r *sessionCreditRepo) ListByStudent(studentID uint) ([]SessionCredit, error) {
+	var credits []SessionCredit
+	err := r.DB.
+		Where("student_id = ?", studentID).
+		Order("expires_at ASC, id ASC").
+		Find(&credits).Error
+	return credits, err
+}
+
+func (r *sessionCreditRepo) ListBySource(source string, sourceID uint) ([]SessionCredit, error) {
+	var credits []SessionCredit
+	err := r.DB.
+		Where("source = ? AND source_id = ?", source, sourceID).
+		Order("id ASC").
+		Find(&credits).Error
+	return credits, err
+}
@@ -2,27 +2,76 @@ package models
 
 import (
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
+type PaymentStatus string
+
+const (
+	PaymentCreated PaymentStatus = "created"
+	PaymentPaid    PaymentStatus = "paid"
+	PaymentFailed  PaymentStatus = "failed"
+	PaymentExpired PaymentStatus = "expired" // never paid within the order timeout
+
+	PaymentRefunded          PaymentStatus = "refunded"
+	PaymentPartiallyRefunded PaymentStatus = "partially_refunded"
+)
+
+// What a Payment pays for
+const (
+	PaymentForSession = "session" // one slot, booked when paid
+	PaymentForPackage = "package" // a StudentPackage, whose credits are issued when paid
+
+	// A SubscriptionCharge: the first period or an upgrade, or a renewal.
+	// Renewal orders stay open through the grace period instead of expiring
+	// with abandoned checkouts.
+	PaymentForSubscription = "subscription"
+	PaymentForRenewal      = "renewal"
+)
+
 type Payment struct {
 	gorm.Model
 
 	OrderID   string `gorm:"uniqueIndex" json:"order_id"`
-	PaymentID string `json:"payment_id,omitempty"`
-	Status    string `json:"status"` // created, paid, failed
+	PaymentID string `gorm:"index" json:"payment_id,omitempty"`
+	Status    string `json:"status"` // created, paid, failed, expired, refunded, partially_refunded
+	Purpose   string `gorm:"type:varchar(20);default:'session'" json:"purpose"`
 
 	StudentID uint `json:"student_id"`
 	ExpertID  uint `json:"expert_id"`
 	SlotID    uint `json:"slot_id"`
 
-	Amount      uint `json:"amount"`       // in paise
+	Amount      uint `json:"amount"`       // in paise, charged through the gateway
 	PlatformFee uint `json:"platform_fee"` // in paise
 	ExpertShare uint `json:"expert_share"` // in paise
 
-	Currency string     `json:"currency"` // INR
-	Method   string     `json:"method"`   // upi, card, etc.
-	PaidAt   *time.Time `json:"paid_at,omitempty"`
+	// Paid from the student's wallet credits on top of Amount; the order is
+	// then worth Amount+WalletAmount. An order paid entirely from the wallet
+	// has an Amount of zero and never reaches the gateway.
+	WalletAmount uint `gorm:"default:0" json:"wallet_amount"`
+
+	// Set when a coupon reduced Amount; the discount is already taken out of
+	// PlatformFee or ExpertShare according to the campaign
+	CouponID        *uint `json:"coupon_id,omitempty"`
+	DiscountInPaise uint  `gorm:"default:0" json:"discount_in_paise"`
+
+	RefundedAmount uint   `gorm:"default:0" json:"refunded_amount"` // in paise, through the gateway
+	RefundID       string `json:"refund_id,omitempty"`
+
+	// In paise, refunded in our books but not yet sent to the gateway
+	RefundPending uint `gorm:"default:0;index" json:"refund_pending,omitempty"`
+
+	// Set when the payment was captured but what it paid for could no longer
+	// be had, and it was refunded in full instead. Such a payment has a
+	// CapturedAt but no PaidAt, as nothing was sold.
+	RefundReason string     `json:"refund_reason,omitempty"`
+	CapturedAt   *time.Time `json:"captured_at,omitempty"`
+
+	Currency  string     `json:"currency"` // INR
+	Method    string     `json:"method"`   // upi, card, etc.
+	PaidAt    *time.Time `json:"paid_at,omitempty"`
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
 }
 
 type paymentRepo struct {
@@ -43,6 +92,107 @@ func (r *paymentRepo) GetByOrderID(orderID string) (*Payment, error) {
 	return &payment, err
 }
 
+// GetByOrderIDForUpdate locks the payment row so concurrent confirmations of
+// the same order are serialised.
+func (r *paymentRepo) GetByOrderIDForUpdate(tx *gorm.DB, orderID string) (*Payment, error) {
+	var payment Payment
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		First(&payment).Error
+	return &payment, err
+}
+
+func (r *paymentRepo) GetByPaymentID(paymentID string) (*Payment, error) {
+	var payment Payment
+	err := r.DB.Where("payment_id = ?", paymentID).First(&payment).Error
+	return &payment, err
+}
+
 func (r *paymentRepo) Update(payment *Payment) error {
 	return r.DB.Save(payment).Error
 }
+
+func (r *paymentRepo) UpdateWithTx(tx *gorm.DB, payment *Payment, where *Payment) error {
+	return tx.Model(&Payment{}).Where(where).Updates(payment).Error
+}
+
+func (r *paymentRepo) GetByOrderIDs(orderIDs []string) ([]Payment, error) {
+	var payments []Payment
+	if len(orderIDs) == 0 {
+		return payments, nil
+	}
+	err := r.DB.Where("order_id IN ?", orderIDs).Find(&payments).Error
+	return payments, err
+}
+
+// ListCreatedBetween returns the orders created locally in [from, to).
+func (r *paymentRepo) ListCreatedBetween(from time.Time, to time.Time) ([]Payment, error) {
+	var payments []Payment
+	err := r.DB.
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Order("id ASC").
+		Find(&payments).Error
+	return payments, err
+}
+
+// PaymentFunnelRow counts the orders of one purpose that ended up in one
+// status.
+type PaymentFunnelRow struct {
+	Purpose       string `json:"purpose"`
+	Status        string `json:"status"`
+	Orders        int64  `json:"orders"`
+	AmountInPaise int64  `json:"amount_in_paise"`
+}
+
+// CountByStatusBetween counts the orders created in [from, to) by purpose
+// and status.
+func (r *paymentRepo) CountByStatusBetween(from time.Time, to time.Time) ([]PaymentFunnelRow, error) {
+	var rows []PaymentFunnelRow
+	err := r.DB.Model(&Payment{}).
+		Select("purpose, status, COUNT(*) AS orders, COALESCE(SUM(amount), 0) AS amount_in_paise").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("purpose, status").
+		Order("purpose ASC, status ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// LockAbandonedWithTx locks up to limit unpaid orders created before the
+// cutoff. Rows locked by another instance are skipped, so concurrent
+// sweepers share the work instead of waiting on each other. Renewal orders
+// are left to the subscription job, which expires them with the grace
+// period.
+func (r *paymentRepo) LockAbandonedWithTx(tx *gorm.DB, createdBefore time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status IN ? AND created_at < ? AND purpose <> ?",
+			[]string{string(PaymentCreated), string(PaymentFailed)}, createdBefore, PaymentForRenewal).
+		Order("id ASC").
+		Limit(limit).
+		Find(&payments).Error
+	return payments, err
+}
+
+// ListRefundPending returns up to limit payments with a refund queued for
+// the gateway.
+func (r *paymentRepo) ListRefundPending(limit int) ([]Payment, error) {
+	var payments []Payment
+	err := r.DB.
+		Where("refund_pending > 0").
+		Order("id ASC").
+		Limit(limit).
+		Find(&payments).Error
+	return payments, err
+}
+
+// MarkExpiredWithTx expires the given orders.
+func (r *paymentRepo) MarkExpiredWithTx(tx *gorm.DB, ids []uint, at time.Time) error {
+	return tx.Model(&Payment{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"status":     string(PaymentExpired),
+			"expired_at": at,
+		}).Error
+}
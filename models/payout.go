@@ -0,0 +1,131 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PayoutStatus string
+
+const (
+	PayoutRequested  PayoutStatus = "requested"
+	PayoutProcessing PayoutStatus = "processing"
+	PayoutPaid       PayoutStatus = "paid"
+	PayoutFailed     PayoutStatus = "failed"
+	PayoutRejected   PayoutStatus = "rejected"
+)
+
+// PayoutAccount is where an expert's withdrawals are sent. The account
+// number, IFSC and UPI ID are only stored encrypted; MaskedDestination is
+// safe to show back to the expert.
+type PayoutAccount struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ExpertUUID        string `gorm:"uniqueIndex;not null" json:"expert_uuid"`
+	Method            string `gorm:"type:varchar(10);not null" json:"method"` // bank | upi
+	AccountHolderName string `json:"account_holder_name"`
+	MaskedDestination string `json:"masked_destination"` // e.g. XXXXXX4321 / ra***@okaxis
+
+	EncryptedDetails string `gorm:"type:text;not null" json:"-"`
+}
+
+type Payout struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PayoutUUID    string `gorm:"uniqueIndex;not null" json:"payout_uuid"`
+	ExpertUUID    string `gorm:"index;not null" json:"expert_uuid"`
+	AmountInPaise int64  `gorm:"not null" json:"amount_in_paise"`
+	Status        string `gorm:"type:varchar(20);index;not null" json:"status"` // requested, processing, paid, failed, rejected
+
+	// Snapshot of the destination when the request was made. The transfer
+	// goes here even if the expert changes their payout account later.
+	PayoutAccountID   uint   `json:"payout_account_id"`
+	Method            string `json:"method"`
+	AccountHolderName string `json:"account_holder_name"`
+	MaskedDestination string `json:"masked_destination"`
+	EncryptedDetails  string `gorm:"type:text" json:"-"`
+
+	Provider         string `json:"provider,omitempty"`
+	ProviderPayoutID string `gorm:"index" json:"provider_payout_id,omitempty"`
+	UTR              string `json:"utr,omitempty"` // bank reference once paid
+	FailureReason    string `json:"failure_reason,omitempty"`
+
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	SettledAt  *time.Time `json:"settled_at,omitempty"`
+}
+
+type payoutAccountRepo struct {
+	DB *gorm.DB
+}
+
+func (r *payoutAccountRepo) GetByExpertUUID(expertUUID string) (*PayoutAccount, error) {
+	var account PayoutAccount
+	err := r.DB.Where("expert_uuid = ?", expertUUID).First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Upsert stores the expert's payout destination, replacing any previous one.
+func (r *payoutAccountRepo) Upsert(account *PayoutAccount) error {
+	return r.DB.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "expert_uuid"}},
+			DoUpdates: clause.AssignmentColumns([]string{"method", "account_holder_name", "masked_destination", "encrypted_details", "updated_at"}),
+		}).
+		Create(account).Error
+}
+
+type payoutRepo struct {
+	DB *gorm.DB
+}
+
+func (r *payoutRepo) Create(payout *Payout) error {
+	return r.DB.Create(payout).Error
+}
+
+func (r *payoutRepo) GetByUUID(payoutUUID string) (*Payout, error) {
+	var payout Payout
+	err := r.DB.Where("payout_uuid = ?", payoutUUID).First(&payout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// GetByUUIDForUpdate locks the payout row so status changes are serialised.
+func (r *payoutRepo) GetByUUIDForUpdate(payoutUUID string) (*Payout, error) {
+	var payout Payout
+	err := r.DB.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("payout_uuid = ?", payoutUUID).
+		First(&payout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+func (r *payoutRepo) ListByExpert(expertUUID string) ([]Payout, error) {
+	var payouts []Payout
+	err := r.DB.Where("expert_uuid = ?", expertUUID).Order("created_at DESC").Find(&payouts).Error
+	return payouts, err
+}
+
+func (r *payoutRepo) ListByStatus(status PayoutStatus, limit int) ([]Payout, error) {
+	var payouts []Payout
+	err := r.DB.Where("status = ?", string(status)).Order("created_at ASC").Limit(limit).Find(&payouts).Error
+	return payouts, err
+}
+
+func (r *payoutRepo) Update(payoutUUID string, updates map[string]interface{}) error {
+	return r.DB.Model(&Payout{}).Where("payout_uuid = ?", payoutUUID).Updates(updates).Error
+}
@@ -29,3 +29,59 @@ func InitWalletRepo(db *gorm.DB) *walletRepo {
 func InitWalletTransactionRepo(db *gorm.DB) *walletTransactionRepo {
 	return &walletTransactionRepo{DB: db}
 }
+
+func InitWebhookEventRepo(db *gorm.DB) *webhookEventRepo {
+	return &webhookEventRepo{DB: db}
+}
+
+func InitIdempotencyKeyRepo(db *gorm.DB) *idempotencyKeyRepo {
+	return &idempotencyKeyRepo{DB: db}
+}
+
+func InitDisputeRepo(db *gorm.DB) *disputeRepo {
+	return &disputeRepo{DB: db}
+}
+
+func InitPayoutAccountRepo(db *gorm.DB) *payoutAccountRepo {
+	return &payoutAccountRepo{DB: db}
+}
+
+func InitPayoutRepo(db *gorm.DB) *payoutRepo {
+	return &payoutRepo{DB: db}
+}
+
+func InitLedgerRepo(db *gorm.DB) *ledgerRepo {
+	return &ledgerRepo{DB: db}
+}
+
+func InitInvoiceRepo(db *gorm.DB) *invoiceRepo {
+	return &invoiceRepo{DB: db}
+}
+
+func InitCouponRepo(db *gorm.DB) *couponRepo {
+	return &couponRepo{DB: db}
+}
+
+func InitPackageRepo(db *gorm.DB) *packageRepo {
+	return &packageRepo{DB: db}
+}
+
+func InitSessionCreditRepo(db *gorm.DB) *sessionCreditRepo {
+	return &sessionCreditRepo{DB: db}
+}
+
+func InitAvailabilityRuleRepo(db *gorm.DB) *availabilityRuleRepo {
+	return &availabilityRuleRepo{DB: db}
+}
+
+func InitSubscriptionRepo(db *gorm.DB) *subscriptionRepo {
+	return &subscriptionRepo{DB: db}
+}
+
+func InitBlackoutRepo(db *gorm.DB) *blackoutRepo {
+	return &blackoutRepo{DB: db}
+}
+
+func InitWalletCreditRepo(db *gorm.DB) *walletCreditRepo {
+	return &walletCreditRepo{DB: db}
+}
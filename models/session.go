@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Session struct {
@@ -16,16 +17,49 @@ type Session struct {
 	ExpertUUID  string `gorm:"index;not null" json:"expert_uuid"`
 	StudentUUID string `gorm:"index;not null" json:"student_uuid"`
 
-	SlotID uint `gorm:"index" json:"slot_id"`
+	SlotID  uint   `gorm:"index" json:"slot_id"`
+	OrderID string `gorm:"index" json:"order_id,omitempty"` // Payment.OrderID
+
+	// Set instead of OrderID when the session was paid with a prepaid credit
+	CreditID *uint `gorm:"index" json:"credit_id,omitempty"` // SessionCredit.ID
 
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 
-	MeetLink string `json:"meet_link,omitempty"`
+	// Handed out only by the join endpoint, so that joining is recorded
+	MeetLink string `json:"-"`
 
 	Status string `gorm:"default:'scheduled';index" json:"status"`
+
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy        string     `json:"cancelled_by,omitempty"` // student | expert
+	CancellationReason string     `json:"cancellation_reason,omitempty"`
+
+	RescheduleCount int `gorm:"default:0" json:"reschedule_count"`
+
+	// Set the first time each participant joins through the join endpoint.
+	// The expert's join is what shows the session took place.
+	ExpertJoinedAt  *time.Time `json:"expert_joined_at,omitempty"`
+	StudentJoinedAt *time.Time `json:"student_joined_at,omitempty"`
+
+	// Set once the expert's escrowed earnings for the session are released
+	EarningsReleasedAt *time.Time `json:"earnings_released_at,omitempty"`
+
+	// Set when the student is refunded after the session, on a dispute or
+	// an expert no-show
+	RefundedAt *time.Time `json:"refunded_at,omitempty"`
 }
 
+const (
+	SessionScheduled = "scheduled"
+	SessionCompleted = "completed"
+	SessionCancelled = "cancelled"
+
+	// Ended without the expert joining; the earnings stay in escrow until
+	// the student is refunded
+	SessionExpertNoShow = "expert_no_show"
+)
+
 type SessionRepo struct {
 	db *gorm.DB
 }
@@ -46,6 +80,31 @@ func (r *SessionRepo) GetByUUID(sessionUUID string) (*Session, error) {
 	return &session, nil
 }
 
+func (r *SessionRepo) GetByOrderID(orderID string) (*Session, error) {
+	var session Session
+	err := r.db.
+		Where("order_id = ?", orderID).
+		First(&session).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepo) GetByUUIDs(sessionUUIDs []string) ([]Session, error) {
+	var sessions []Session
+	if len(sessionUUIDs) == 0 {
+		return sessions, nil
+	}
+
+	err := r.db.
+		Where("session_uuid IN ?", sessionUUIDs).
+		Find(&sessions).Error
+
+	return sessions, err
+}
+
 func (r *SessionRepo) GetByStudentUUID(studentUUID string) ([]Session, error) {
 	var sessions []Session
 	err := r.db.
@@ -84,13 +143,154 @@ func (r *SessionRepo) UpdateStatus(sessionUUID string, status string) error {
 }
 
 func (r *SessionRepo) Cancel(sessionUUID string) error {
-	return r.UpdateStatus(sessionUUID, "cancelled")
+	return r.UpdateStatus(sessionUUID, SessionCancelled)
+}
+
+// GetByUUIDForUpdate locks the session row for the rest of the transaction.
+func (r *SessionRepo) GetByUUIDForUpdate(sessionUUID string) (*Session, error) {
+	var session Session
+	err := r.db.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("session_uuid = ?", sessionUUID).
+		First(&session).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CancelWithDetails cancels a scheduled session and records who cancelled it and why.
+func (r *SessionRepo) CancelWithDetails(sessionUUID string, cancelledBy string, reason string) error {
+	now := time.Now()
+	result := r.db.
+		Model(&Session{}).
+		Where("session_uuid = ? AND status = ?", sessionUUID, SessionScheduled).
+		Updates(&Session{
+			Status:             SessionCancelled,
+			CancelledAt:        &now,
+			CancelledBy:        cancelledBy,
+			CancellationReason: reason,
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Reschedule moves a scheduled session onto another slot and counts the move.
+func (r *SessionRepo) Reschedule(sessionUUID string, slot *AvailabilitySlot, meetLink string) error {
+	result := r.db.
+		Model(&Session{}).
+		Where("session_uuid = ? AND status = ?", sessionUUID, SessionScheduled).
+		Updates(map[string]interface{}{
+			"slot_id":          slot.ID,
+			"start_time":       slot.StartTime,
+			"end_time":         slot.EndTime,
+			"meet_link":        meetLink,
+			"reschedule_count": gorm.Expr("reschedule_count + 1"),
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
 }
 
 func (r *SessionRepo) MarkCompleted(sessionUUID string) error {
 	return r.UpdateStatus(sessionUUID, "completed")
 }
 
+// CompleteEnded settles scheduled sessions that ended before endedBefore:
+// those the expert joined are completed, the others are marked expert
+// no-shows. It returns how many of each.
+func (r *SessionRepo) CompleteEnded(endedBefore time.Time) (int64, int64, error) {
+	completed := r.db.
+		Model(&Session{}).
+		Where("status = ? AND end_time < ? AND expert_joined_at IS NOT NULL", SessionScheduled, endedBefore).
+		Update("status", SessionCompleted)
+	if completed.Error != nil {
+		return 0, 0, completed.Error
+	}
+
+	noShows := r.db.
+		Model(&Session{}).
+		Where("status = ? AND end_time < ? AND expert_joined_at IS NULL", SessionScheduled, endedBefore).
+		Update("status", SessionExpertNoShow)
+
+	return completed.RowsAffected, noShows.RowsAffected, noShows.Error
+}
+
+// MarkJoined records when the expert, or otherwise the student, first
+// joined the session.
+func (r *SessionRepo) MarkJoined(sessionUUID string, asExpert bool, at time.Time) error {
+	column := "student_joined_at"
+	if asExpert {
+		column = "expert_joined_at"
+	}
+	return r.db.
+		Model(&Session{}).
+		Where("session_uuid = ? AND "+column+" IS NULL", sessionUUID).
+		Update(column, at).Error
+}
+
+// GetReleasable returns completed sessions that ended before endedBefore,
+// whose earnings are still in escrow and which have neither an open dispute
+// nor one resolved with a full refund. A partial refund leaves the rest of
+// the earnings to be released.
+func (r *SessionRepo) GetReleasable(endedBefore time.Time, limit int) ([]Session, error) {
+	var sessions []Session
+	err := r.db.
+		Where("status = ? AND end_time < ? AND earnings_released_at IS NULL", SessionCompleted, endedBefore).
+		Where("NOT EXISTS (SELECT 1 FROM disputes WHERE disputes.session_uuid = sessions.session_uuid AND (disputes.status = ? OR disputes.outcome = ?))",
+			string(DisputeOpen), string(DisputeRefundFull)).
+		Order("end_time ASC").
+		Limit(limit).
+		Find(&sessions).Error
+
+	return sessions, err
+}
+
+// GetNoShowsToRefund returns expert no-shows that ended before endedBefore,
+// have no open dispute and whose student has not been refunded yet.
+func (r *SessionRepo) GetNoShowsToRefund(endedBefore time.Time, limit int) ([]Session, error) {
+	var sessions []Session
+	err := r.db.
+		Where("status = ? AND end_time < ? AND refunded_at IS NULL", SessionExpertNoShow, endedBefore).
+		Where("NOT EXISTS (SELECT 1 FROM disputes WHERE disputes.session_uuid = sessions.session_uuid AND disputes.status = ?)",
+			string(DisputeOpen)).
+		Order("end_time ASC").
+		Limit(limit).
+		Find(&sessions).Error
+
+	return sessions, err
+}
+
+func (r *SessionRepo) MarkRefunded(sessionUUID string, at time.Time) error {
+	return r.db.
+		Model(&Session{}).
+		Where("session_uuid = ?", sessionUUID).
+		Update("refunded_at", at).Error
+}
+
+func (r *SessionRepo) MarkEarningsReleased(sessionUUID string) error {
+	return r.db.
+		Model(&Session{}).
+		Where("session_uuid = ?", sessionUUID).
+		Update("earnings_released_at", time.Now()).Error
+}
+
 func (r *SessionRepo) ExistsForSlot(slotID uint) (bool, error) {
 	var count int64
 	err := r.db.
@@ -101,6 +301,30 @@ func (r *SessionRepo) ExistsForSlot(slotID uint) (bool, error) {
 	return count > 0, err
 }
 
+// ListScheduledForExpertBetween returns the expert's scheduled sessions
+// that overlap [from, to).
+func (r *SessionRepo) ListScheduledForExpertBetween(expertUUID string, from time.Time, to time.Time) ([]Session, error) {
+	var sessions []Session
+	err := r.db.
+		Where("expert_uuid = ? AND status = ? AND start_time < ? AND end_time > ?",
+			expertUUID, SessionScheduled, to, from).
+		Order("start_time ASC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// ListBookedForExpertBetween returns the expert's scheduled and completed
+// sessions that overlap [from, to).
+func (r *SessionRepo) ListBookedForExpertBetween(expertUUID string, from time.Time, to time.Time) ([]Session, error) {
+	var sessions []Session
+	err := r.db.
+		Where("expert_uuid = ? AND status IN ? AND start_time < ? AND end_time > ?",
+			expertUUID, []string{SessionScheduled, SessionCompleted}, to, from).
+		Order("start_time ASC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
 func (r *SessionRepo) GetUpcomingForUser(userUUID string) ([]Session, error) {
 	var sessions []Session
 
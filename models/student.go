@@ -20,6 +20,7 @@ type Student struct {
 	PreparingFor string         `json:"preparing_for"`
 	DateOfBirth  time.Time      `json:"dob"`
 	City         string         `json:"city"`
+	State        string         `json:"state"` // place of supply on GST invoices
 	AboutMe      string         `json:"about_me"`
 	Skills       datatypes.JSON `json:"skills"` // JSON column for skills
 }
@@ -33,6 +34,16 @@ func (r *StudentRepo) Create(student *Student) error {
 	return r.db.Create(student).Error
 }
 
+// Get by primary key
+func (r *StudentRepo) GetByID(id uint) (*Student, error) {
+	var student Student
+	err := r.db.First(&student, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &student, nil
+}
+
 // Get by user UUID
 func (r *StudentRepo) GetByUserUUID(uuid string) (*Student, error) {
 	var student Student
@@ -0,0 +1,323 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Plan is a subscription on offer: SessionsPerPeriod session credits every
+// PeriodMonths months for PriceInPaise. Like packages, empty expert and
+// specialization lists mean the credits work with any expert.
+type Plan struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name              string `gorm:"not null" json:"name"`
+	Description       string `json:"description"`
+	Active            bool   `gorm:"default:true" json:"active"`
+	SessionsPerPeriod int    `gorm:"not null" json:"sessions_per_period"`
+	PriceInPaise      int64  `gorm:"not null" json:"price_in_paise"` // per period
+	PeriodMonths      int    `gorm:"not null" json:"period_months"`
+
+	// Days subscribers may book past an expert's max_advance_days
+	PriorityBookingDays int `gorm:"default:0" json:"priority_booking_days"`
+
+	ExpertUUIDs     pq.StringArray `gorm:"type:text[]" json:"expert_uuids,omitempty"`
+	Specializations pq.StringArray `gorm:"type:text[]" json:"specializations,omitempty"`
+}
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionPending   SubscriptionStatus = "pending"   // first period not paid yet
+	SubscriptionActive    SubscriptionStatus = "active"    // current period paid
+	SubscriptionPastDue   SubscriptionStatus = "past_due"  // renewal not paid yet, within the grace period
+	SubscriptionCancelled SubscriptionStatus = "cancelled" // ended by the student
+	SubscriptionLapsed    SubscriptionStatus = "lapsed"    // renewal not paid within the grace period
+)
+
+// Subscription is a student's plan. Renewals charge the price and allowance
+// copied here, so later changes to the catalog do not affect it until the
+// student upgrades.
+type Subscription struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	StudentID uint   `gorm:"index;not null" json:"student_id"`
+	PlanID    uint   `gorm:"index;not null" json:"plan_id"`
+	Status    string `gorm:"type:varchar(10);index;not null" json:"status"`
+
+	// Copied from the plan when subscribing or upgrading
+	PlanName          string `json:"plan_name"`
+	SessionsPerPeriod int    `json:"sessions_per_period"`
+	PriceInPaise      int64  `json:"price_in_paise"`
+	PeriodMonths      int    `json:"period_months"`
+
+	PriorityBookingDays int `gorm:"default:0" json:"priority_booking_days"`
+
+	CurrentPeriodStart *time.Time `json:"current_period_start,omitempty"`
+	CurrentPeriodEnd   *time.Time `gorm:"index" json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd  bool       `gorm:"default:false" json:"cancel_at_period_end"`
+	GraceUntil         *time.Time `gorm:"index" json:"grace_until,omitempty"` // while past_due
+	EndedAt            *time.Time `json:"ended_at,omitempty"`
+}
+
+// What a SubscriptionCharge is for
+const (
+	SubscriptionChargeFirst   = "first"   // the first period, which starts when paid
+	SubscriptionChargeRenewal = "renewal" // the next period
+	SubscriptionChargeUpgrade = "upgrade" // the prorated difference to a bigger plan
+)
+
+type SubscriptionChargeStatus string
+
+const (
+	SubscriptionChargePending SubscriptionChargeStatus = "pending"
+	SubscriptionChargePaid    SubscriptionChargeStatus = "paid"
+	SubscriptionChargeVoid    SubscriptionChargeStatus = "void" // replaced, or the subscription ended
+)
+
+// SubscriptionCharge is one order against a subscription. Paying it issues
+// Credits session credits that expire at the end of its period.
+type SubscriptionCharge struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	SubscriptionID uint   `gorm:"index;not null" json:"subscription_id"`
+	PlanID         uint   `gorm:"not null" json:"plan_id"`              // the plan upgraded to, for upgrades
+	OrderID        string `gorm:"uniqueIndex;not null" json:"order_id"` // Payment.OrderID
+	Kind           string `gorm:"type:varchar(10);not null" json:"kind"`
+	Status         string `gorm:"type:varchar(10);not null" json:"status"`
+
+	AmountInPaise int64 `gorm:"not null" json:"amount_in_paise"`
+	Credits       int   `gorm:"not null" json:"credits"`
+
+	// Unset on a first charge until it is paid
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+	PaidAt      *time.Time `json:"paid_at,omitempty"`
+}
+
+type subscriptionRepo struct {
+	DB *gorm.DB
+}
+
+func (r *subscriptionRepo) CreatePlan(plan *Plan) error {
+	return r.DB.Create(plan).Error
+}
+
+func (r *subscriptionRepo) GetPlanByID(id uint) (*Plan, error) {
+	var plan Plan
+	err := r.DB.First(&plan, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (r *subscriptionRepo) ListPlans() ([]Plan, error) {
+	var plans []Plan
+	err := r.DB.Order("created_at DESC").Find(&plans).Error
+	return plans, err
+}
+
+func (r *subscriptionRepo) ListActivePlans() ([]Plan, error) {
+	var plans []Plan
+	err := r.DB.Where("active = ?", true).Order("price_in_paise ASC").Find(&plans).Error
+	return plans, err
+}
+
+func (r *subscriptionRepo) SetPlanActive(id uint, active bool) error {
+	result := r.DB.Model(&Plan{}).Where("id = ?", id).Update("active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *subscriptionRepo) CreateWithTx(tx *gorm.DB, subscription *Subscription) error {
+	return tx.Create(subscription).Error
+}
+
+// liveSubscriptionStatuses are the statuses of a subscription that has not
+// ended. A student has at most one such subscription.
+var liveSubscriptionStatuses = []string{
+	string(SubscriptionPending),
+	string(SubscriptionActive),
+	string(SubscriptionPastDue),
+}
+
+// GetCurrentByStudent returns the student's subscription that has not
+// ended.
+func (r *subscriptionRepo) GetCurrentByStudent(studentID uint) (*Subscription, error) {
+	var subscription Subscription
+	err := r.DB.
+		Where("student_id = ? AND status IN ?", studentID, liveSubscriptionStatuses).
+		Order("id DESC").
+		First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetCurrentByStudentForUpdate locks the student's subscription that has
+// not ended.
+func (r *subscriptionRepo) GetCurrentByStudentForUpdate(tx *gorm.DB, studentID uint) (*Subscription, error) {
+	var subscription Subscription
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("student_id = ? AND status IN ?", studentID, liveSubscriptionStatuses).
+		Order("id DESC").
+		First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (r *subscriptionRepo) GetByIDForUpdate(tx *gorm.DB, id uint) (*Subscription, error) {
+	var subscription Subscription
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&subscription, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (r *subscriptionRepo) UpdateWithTx(tx *gorm.DB, id uint, fields map[string]interface{}) error {
+	return tx.Model(&Subscription{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// GetNextDueForRenewal returns the active subscription whose period ended
+// first, leaving out the given ones.
+func (r *subscriptionRepo) GetNextDueForRenewal(now time.Time, excluded []uint) (*Subscription, error) {
+	var subscription Subscription
+	query := r.DB.Where("status = ? AND current_period_end <= ?", string(SubscriptionActive), now)
+	if len(excluded) > 0 {
+		query = query.Where("id NOT IN ?", excluded)
+	}
+	err := query.Order("current_period_end ASC, id ASC").First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// LockDueForRenewalWithTx locks the subscription if it is still due for
+// renewal. A row locked by another instance is skipped and reported as not
+// found.
+func (r *subscriptionRepo) LockDueForRenewalWithTx(tx *gorm.DB, id uint, now time.Time) (*Subscription, error) {
+	var subscription Subscription
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ? AND current_period_end <= ?", id, string(SubscriptionActive), now).
+		First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// LockGraceExpiredWithTx locks up to limit past-due subscriptions whose
+// grace period has run out. Rows locked by another instance are skipped.
+func (r *subscriptionRepo) LockGraceExpiredWithTx(tx *gorm.DB, now time.Time, limit int) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND grace_until <= ?", string(SubscriptionPastDue), now).
+		Order("grace_until ASC, id ASC").
+		Limit(limit).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *subscriptionRepo) CreateChargeWithTx(tx *gorm.DB, charge *SubscriptionCharge) error {
+	return tx.Create(charge).Error
+}
+
+func (r *subscriptionRepo) GetChargeByOrderID(orderID string) (*SubscriptionCharge, error) {
+	var charge SubscriptionCharge
+	err := r.DB.Where("order_id = ?", orderID).First(&charge).Error
+	if err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
+
+// GetChargeByOrderIDForUpdate locks the charge paid for by the order.
+func (r *subscriptionRepo) GetChargeByOrderIDForUpdate(tx *gorm.DB, orderID string) (*SubscriptionCharge, error) {
+	var charge SubscriptionCharge
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		First(&charge).Error
+	if err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
+
+func (r *subscriptionRepo) MarkChargePaidWithTx(tx *gorm.DB, id uint, periodStart time.Time, periodEnd time.Time, paidAt time.Time) error {
+	return tx.Model(&SubscriptionCharge{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       string(SubscriptionChargePaid),
+			"period_start": periodStart,
+			"period_end":   periodEnd,
+			"paid_at":      paidAt,
+		}).Error
+}
+
+// VoidPendingChargesWithTx voids the subscription's unpaid charges of the
+// given kinds (all kinds when none are given) and returns their order IDs.
+func (r *subscriptionRepo) VoidPendingChargesWithTx(tx *gorm.DB, subscriptionID uint, kinds ...string) ([]string, error) {
+	query := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("subscription_id = ? AND status = ?", subscriptionID, string(SubscriptionChargePending))
+	if len(kinds) > 0 {
+		query = query.Where("kind IN ?", kinds)
+	}
+
+	var charges []SubscriptionCharge
+	if err := query.Find(&charges).Error; err != nil {
+		return nil, err
+	}
+	if len(charges) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(charges))
+	orderIDs := make([]string, 0, len(charges))
+	for _, charge := range charges {
+		ids = append(ids, charge.ID)
+		orderIDs = append(orderIDs, charge.OrderID)
+	}
+
+	err := tx.Model(&SubscriptionCharge{}).
+		Where("id IN ?", ids).
+		Update("status", string(SubscriptionChargeVoid)).Error
+	return orderIDs, err
+}
+
+// ListChargesBySubscription returns the subscription's charges, newest
+// first.
+func (r *subscriptionRepo) ListChargesBySubscription(subscriptionID uint) ([]SubscriptionCharge, error) {
+	var charges []SubscriptionCharge
+	err := r.DB.
+		Where("subscription_id = ?", subscriptionID).
+		Order("id DESC").
+		Find(&charges).Error
+	return charges, err
+}
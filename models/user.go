@@ -21,6 +21,9 @@ type User struct {
 	Phone    *string `gorm:"uniqueIndex" json:"phone,omitempty"`
 	Role     string  `gorm:"not null" json:"role"` // "student" | "expert" | "admin"
 
+	// IANA name such as "Europe/London"; empty means DEFAULT_TIME_ZONE
+	TimeZone string `gorm:"type:varchar(64)" json:"time_zone,omitempty"`
+
 	// Relations
 	Student *Student `gorm:"foreignKey:UserID;references:UserUUID" json:"student,omitempty"`
 	Expert  *Expert  `gorm:"foreignKey:UserID;references:UserUUID" json:"expert,omitempty"`
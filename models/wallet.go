@@ -4,8 +4,12 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// PlatformWalletUUID owns the wallet that collects the platform's commission.
+const PlatformWalletUUID = "platform"
+
 type Wallet struct {
 	ID        uint           `gorm:"primaryKey"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -13,7 +17,10 @@ type Wallet struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 	UserUUID  string         `gorm:"uniqueIndex;not null"`
 
-	BalanceInPaise int64 `gorm:"not null;default:0"`
+	// BalanceInPaise is available to withdraw. Session earnings sit in
+	// PendingBalanceInPaise until the session is completed and released.
+	BalanceInPaise        int64 `gorm:"not null;default:0"`
+	PendingBalanceInPaise int64 `gorm:"not null;default:0"`
 
 	Transactions []WalletTransaction `gorm:"foreignKey:WalletID;references:ID"`
 }
@@ -35,7 +42,55 @@ func (r *walletRepo) Create(wallet *Wallet) error {
 	return r.DB.Create(wallet).Error
 }
 
-func (r *walletRepo) UpdateBalance(userUUID string, newBalanceInPaise int64) error {
+func (r *walletRepo) ListAll() ([]Wallet, error) {
+	var wallets []Wallet
+	err := r.DB.Order("id ASC").Find(&wallets).Error
+	return wallets, err
+}
+
+// GetOrCreate returns the user's wallet, creating an empty one if needed.
+// Concurrent callers creating the same wallet both get the stored row.
+func (r *walletRepo) GetOrCreate(userUUID string) (*Wallet, error) {
+	err := r.DB.
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_uuid"}}, DoNothing: true}).
+		Create(&Wallet{UserUUID: userUUID}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.GetByUserUUID(userUUID)
+}
+
+// IncrementBalance adds delta (negative to debit) to the stored balance in SQL,
+// so concurrent updates are not lost.
+func (r *walletRepo) IncrementBalance(userUUID string, delta int64) error {
+	return r.DB.Model(&Wallet{}).Where("user_uuid = ?", userUUID).
+		Update("balance_in_paise", gorm.Expr("balance_in_paise + ?", delta)).Error
+}
+
+// DebitIfSufficient takes amount from the available balance only if it
+// covers it, in one statement. It reports whether the debit happened.
+func (r *walletRepo) DebitIfSufficient(userUUID string, amount int64) (bool, error) {
+	result := r.DB.Model(&Wallet{}).
+		Where("user_uuid = ? AND balance_in_paise >= ?", userUUID, amount).
+		Update("balance_in_paise", gorm.Expr("balance_in_paise - ?", amount))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// IncrementPendingBalance adds delta (negative to remove) to the escrowed balance.
+func (r *walletRepo) IncrementPendingBalance(userUUID string, delta int64) error {
+	return r.DB.Model(&Wallet{}).Where("user_uuid = ?", userUUID).
+		Update("pending_balance_in_paise", gorm.Expr("pending_balance_in_paise + ?", delta)).Error
+}
+
+// ReleasePending moves amount from the pending to the available balance in
+// a single statement.
+func (r *walletRepo) ReleasePending(userUUID string, amount int64) error {
 	return r.DB.Model(&Wallet{}).Where("user_uuid = ?", userUUID).
-		Update("balance_in_paise", newBalanceInPaise).Error
+		Updates(map[string]interface{}{
+			"pending_balance_in_paise": gorm.Expr("pending_balance_in_paise - ?", amount),
+			"balance_in_paise":         gorm.Expr("balance_in_paise + ?", amount),
+		}).Error
 }
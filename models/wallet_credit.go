@@ -0,0 +1,146 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Where a student's wallet credit came from
+const (
+	WalletCreditFromRefund    = "refund"
+	WalletCreditFromPromotion = "promotion"
+	WalletCreditFromReferral  = "referral"
+)
+
+// WalletCredit is one amount added to a student's wallet. Checkout spends
+// the credits closest to expiry first, and whatever is left of a credit when
+// it expires is forfeited. The remaining amounts of a student's unexpired
+// credits add up to their wallet balance.
+type WalletCredit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserUUID    string `gorm:"index;not null" json:"user_uuid"`
+	Source      string `gorm:"type:varchar(20);not null" json:"source"` // refund, promotion, referral
+	ReferenceID string `json:"reference_id,omitempty"`
+	Description string `json:"description"`
+
+	AmountInPaise    int64      `gorm:"not null" json:"amount_in_paise"`
+	RemainingInPaise int64      `gorm:"not null" json:"remaining_in_paise"`
+	ExpiresAt        *time.Time `gorm:"index" json:"expires_at,omitempty"` // nil never expires
+	ExpiredAt        *time.Time `json:"expired_at,omitempty"`
+}
+
+// WalletCreditUse records how much of a credit an order spent, so it can be
+// put back if the order is never paid.
+type WalletCreditUse struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	WalletCreditID uint       `gorm:"index;not null" json:"wallet_credit_id"`
+	OrderID        string     `gorm:"index;not null" json:"order_id"`
+	AmountInPaise  int64      `gorm:"not null" json:"amount_in_paise"`
+	ReleasedAt     *time.Time `json:"released_at,omitempty"`
+}
+
+type walletCreditRepo struct {
+	DB *gorm.DB
+}
+
+func (r *walletCreditRepo) CreateWithTx(tx *gorm.DB, credit *WalletCredit) error {
+	return tx.Create(credit).Error
+}
+
+// LockSpendableWithTx locks the user's credits that still have money on
+// them, soonest to expire first and never-expiring ones last.
+func (r *walletCreditRepo) LockSpendableWithTx(tx *gorm.DB, userUUID string, now time.Time) ([]WalletCredit, error) {
+	var credits []WalletCredit
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_uuid = ? AND remaining_in_paise > 0 AND (expires_at IS NULL OR expires_at > ?)", userUUID, now).
+		Order("expires_at ASC NULLS LAST, id ASC").
+		Find(&credits).Error
+	return credits, err
+}
+
+// SpendWithTx takes amount off the credit and records the use by the order.
+func (r *walletCreditRepo) SpendWithTx(tx *gorm.DB, creditID uint, orderID string, amount int64) error {
+	err := tx.Model(&WalletCredit{}).
+		Where("id = ?", creditID).
+		Update("remaining_in_paise", gorm.Expr("remaining_in_paise - ?", amount)).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&WalletCreditUse{
+		WalletCreditID: creditID,
+		OrderID:        orderID,
+		AmountInPaise:  amount,
+	}).Error
+}
+
+// ReleaseUsesWithTx puts back everything the order spent that has not been
+// put back yet, and returns the total.
+func (r *walletCreditRepo) ReleaseUsesWithTx(tx *gorm.DB, orderID string, at time.Time) (int64, error) {
+	var uses []WalletCreditUse
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND released_at IS NULL", orderID).
+		Order("wallet_credit_id ASC").
+		Find(&uses).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, use := range uses {
+		err := tx.Model(&WalletCredit{}).
+			Where("id = ?", use.WalletCreditID).
+			Update("remaining_in_paise", gorm.Expr("remaining_in_paise + ?", use.AmountInPaise)).Error
+		if err != nil {
+			return 0, err
+		}
+
+		err = tx.Model(&WalletCreditUse{}).Where("id = ?", use.ID).Update("released_at", at).Error
+		if err != nil {
+			return 0, err
+		}
+		total += use.AmountInPaise
+	}
+	return total, nil
+}
+
+// LockExpiredWithTx locks up to limit credits past their expiry that still
+// have money on them. Rows locked by another instance are skipped.
+func (r *walletCreditRepo) LockExpiredWithTx(tx *gorm.DB, now time.Time, limit int) ([]WalletCredit, error) {
+	var credits []WalletCredit
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("expires_at <= ? AND remaining_in_paise > 0", now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&credits).Error
+	return credits, err
+}
+
+func (r *walletCreditRepo) MarkExpiredWithTx(tx *gorm.DB, creditID uint, at time.Time) error {
+	return tx.Model(&WalletCredit{}).
+		Where("id = ?", creditID).
+		Updates(map[string]interface{}{
+			"remaining_in_paise": 0,
+			"expired_at":         at,
+		}).Error
+}
+
+// ListActiveByUser returns the user's credits with money left to spend.
+func (r *walletCreditRepo) ListActiveByUser(userUUID string, now time.Time) ([]WalletCredit, error) {
+	var credits []WalletCredit
+	err := r.DB.
+		Where("user_uuid = ? AND remaining_in_paise > 0 AND (expires_at IS NULL OR expires_at > ?)", userUUID, now).
+		Order("expires_at ASC NULLS LAST, id ASC").
+		Find(&credits).Error
+	return credits, err
+}
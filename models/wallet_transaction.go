@@ -15,12 +15,47 @@ type WalletTransaction struct {
 
 	Wallet *Wallet `gorm:"foreignKey:WalletID;references:ID;constraint:OnDelete:CASCADE;"`
 
+	// credit | debit move the available balance; hold puts earnings in
+	// escrow (pending), release moves them from pending to available and
+	// void drops pending earnings that are refunded before release
 	AmountInPaise int64
-	Type          string // credit | debit
-	Source        string // session | refund | payout
+	Type          string // credit | debit | hold | release | void
+	Source        string // session | refund | payout | commission | promotion | referral | checkout | expiry
 	ReferenceID   string
 
 	Description string
+
+	// Set on student wallet credits that expire
+	ExpiresAt *time.Time
+}
+
+// BalanceEffect reports how the transaction changed the available and
+// pending balances of its wallet.
+func (wt *WalletTransaction) BalanceEffect() (available int64, pending int64) {
+	switch wt.Type {
+	case "credit":
+		return wt.AmountInPaise, 0
+	case "debit":
+		return -wt.AmountInPaise, 0
+	case "hold":
+		return 0, wt.AmountInPaise
+	case "void":
+		return 0, -wt.AmountInPaise
+	case "release":
+		return wt.AmountInPaise, -wt.AmountInPaise
+	}
+	return 0, 0
+}
+
+// WalletTransactionFilter narrows a wallet's history. Zero values match
+// everything; BeforeID is the pagination cursor (rows are newest first).
+type WalletTransactionFilter struct {
+	From     *time.Time
+	To       *time.Time
+	Types    []string
+	Sources  []string
+	BeforeID uint
+	Limit    int
 }
 
 type walletTransactionRepo struct {
@@ -48,3 +83,63 @@ func (r *walletTransactionRepo) GetByReferenceID(referenceID string) ([]WalletTr
 	}
 	return transactions, nil
 }
+
+func (r *walletTransactionRepo) List(walletID uint, filter WalletTransactionFilter) ([]WalletTransaction, error) {
+	query := r.DB.Where("wallet_id = ?", walletID)
+
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if len(filter.Sources) > 0 {
+		query = query.Where("source IN ?", filter.Sources)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var transactions []WalletTransaction
+	err := query.Order("id DESC").Find(&transactions).Error
+	return transactions, err
+}
+
+// ListBetween returns the wallet's transactions in [from, to), oldest first.
+func (r *walletTransactionRepo) ListBetween(walletID uint, from time.Time, to time.Time) ([]WalletTransaction, error) {
+	var transactions []WalletTransaction
+	err := r.DB.
+		Where("wallet_id = ? AND created_at >= ? AND created_at < ?", walletID, from, to).
+		Order("id ASC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// BalancesBefore sums the effect of every transaction before the given time,
+// mirroring WalletTransaction.BalanceEffect.
+func (r *walletTransactionRepo) BalancesBefore(walletID uint, before time.Time) (available int64, pending int64, err error) {
+	var row struct {
+		Available int64
+		Pending   int64
+	}
+	err = r.DB.Model(&WalletTransaction{}).
+		Select(`COALESCE(SUM(CASE type
+				WHEN 'credit' THEN amount_in_paise
+				WHEN 'debit' THEN -amount_in_paise
+				WHEN 'release' THEN amount_in_paise
+				ELSE 0 END), 0) AS available,
+			COALESCE(SUM(CASE type
+				WHEN 'hold' THEN amount_in_paise
+				WHEN 'void' THEN -amount_in_paise
+				WHEN 'release' THEN -amount_in_paise
+				ELSE 0 END), 0) AS pending`).
+		Where("wallet_id = ? AND created_at < ?", walletID, before).
+		Scan(&row).Error
+	return row.Available, row.Pending, err
+}
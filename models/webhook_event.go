@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookEventStatus string
+
+const (
+	WebhookEventProcessing WebhookEventStatus = "processing"
+	WebhookEventProcessed  WebhookEventStatus = "processed"
+	WebhookEventFailed     WebhookEventStatus = "failed"
+)
+
+// WebhookEvent records every gateway event we have accepted, keyed by the
+// provider's event ID, so replays are recognised and skipped.
+type WebhookEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Provider string         `gorm:"type:varchar(30);not null" json:"provider"`
+	EventID  string         `gorm:"uniqueIndex;not null" json:"event_id"`
+	Event    string         `gorm:"index" json:"event"`
+	Status   string         `gorm:"type:varchar(20);index" json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Payload  datatypes.JSON `json:"payload"`
+}
+
+type webhookEventRepo struct {
+	DB *gorm.DB
+}
+
+// CreateIfAbsent inserts the event and reports whether it was new.
+// A false result means the event ID was already recorded.
+func (r *webhookEventRepo) CreateIfAbsent(event *WebhookEvent) (bool, error) {
+	result := r.DB.
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "event_id"}}, DoNothing: true}).
+		Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *webhookEventRepo) UpdateStatus(eventID string, status WebhookEventStatus, errMsg string) error {
+	return r.DB.Model(&WebhookEvent{}).
+		Where("event_id = ?", eventID).
+		Updates(map[string]interface{}{"status": string(status), "error": errMsg}).Error
+}
+
+func (r *webhookEventRepo) Delete(eventID string) error {
+	return r.DB.Where("event_id = ?", eventID).Delete(&WebhookEvent{}).Error
+}
@@ -0,0 +1,301 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeProvider is an in-process gateway for local development and tests.
+// IDs are sequential and signatures use the same HMAC scheme as Razorpay,
+// so the booking and webhook code paths run unchanged against it.
+type FakeProvider struct {
+	secret        string
+	webhookSecret string
+
+	mu       sync.Mutex
+	seq      int
+	orders   map[string]*Order
+	payments map[string]*Payment
+	refunds  map[string][]*Refund
+	now      func() time.Time
+}
+
+const (
+	fakeKeyID                = "rzp_test_fake"
+	defaultFakeSecret        = "fake_secret"
+	defaultFakeWebhookSecret = "fake_webhook_secret"
+)
+
+func NewFakeProvider(secret string, webhookSecret string) *FakeProvider {
+	if secret == "" {
+		secret = defaultFakeSecret
+	}
+	if webhookSecret == "" {
+		webhookSecret = defaultFakeWebhookSecret
+	}
+
+	return &FakeProvider{
+		secret:        secret,
+		webhookSecret: webhookSecret,
+		orders:        map[string]*Order{},
+		payments:      map[string]*Payment{},
+		refunds:       map[string][]*Refund{},
+		now:           time.Now,
+	}
+}
+
+// SetClock pins the time stamped on simulated payments.
+func (p *FakeProvider) SetClock(now func() time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.now = now
+}
+
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (p *FakeProvider) KeyID() string {
+	return fakeKeyID
+}
+
+func (p *FakeProvider) nextID(prefix string) string {
+	p.seq++
+	return fmt.Sprintf("%s_fake%08d", prefix, p.seq)
+}
+
+func (p *FakeProvider) CreateOrder(amountInPaise int64, currency string, receipt string) (*Order, error) {
+	if amountInPaise <= 0 {
+		return nil, errors.New("order amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order := &Order{
+		ID:            p.nextID("order"),
+		AmountInPaise: amountInPaise,
+		Currency:      currency,
+		Receipt:       receipt,
+		Status:        "created",
+		CreatedAt:     p.now(),
+	}
+	p.orders[order.ID] = order
+
+	copied := *order
+	return &copied, nil
+}
+
+func (p *FakeProvider) FetchPayment(paymentID string) (*Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+
+	copied := *payment
+	return &copied, nil
+}
+
+func (p *FakeProvider) Refund(paymentID string, amountInPaise int64, notes map[string]string) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != "captured" && payment.Status != "refunded" {
+		return nil, fmt.Errorf("payment %s is %s and cannot be refunded", paymentID, payment.Status)
+	}
+	if amountInPaise <= 0 || payment.AmountRefunded+amountInPaise > payment.AmountInPaise {
+		return nil, ErrInvalidRefund
+	}
+
+	payment.AmountRefunded += amountInPaise
+	if payment.AmountRefunded == payment.AmountInPaise {
+		payment.Status = "refunded"
+	}
+
+	refund := &Refund{
+		ID:            p.nextID("rfnd"),
+		PaymentID:     paymentID,
+		AmountInPaise: amountInPaise,
+		Status:        "processed",
+	}
+	p.refunds[paymentID] = append(p.refunds[paymentID], refund)
+
+	copied := *refund
+	return &copied, nil
+}
+
+func (p *FakeProvider) ListOrders(from time.Time, to time.Time) ([]Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var orders []Order
+	for _, order := range p.orders {
+		if !order.CreatedAt.Before(from) && order.CreatedAt.Before(to) {
+			orders = append(orders, *order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders, nil
+}
+
+func (p *FakeProvider) ListPayments(from time.Time, to time.Time) ([]Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var payments []Payment
+	for _, payment := range p.payments {
+		if !payment.CreatedAt.Before(from) && payment.CreatedAt.Before(to) {
+			payments = append(payments, *payment)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].ID < payments[j].ID })
+	return payments, nil
+}
+
+func (p *FakeProvider) VerifyPaymentSignature(orderID string, paymentID string, signature string) bool {
+	return verifyHex(p.secret, []byte(orderID+"|"+paymentID), signature)
+}
+
+func (p *FakeProvider) VerifyWebhookSignature(body []byte, signature string) bool {
+	return verifyHex(p.webhookSecret, body, signature)
+}
+
+// SimulatePaymentSuccess captures the full order amount, as if the student
+// completed checkout, and returns what checkout hands back to the client.
+func (p *FakeProvider) SimulatePaymentSuccess(orderID string, method string) (paymentID string, signature string, err error) {
+	payment, err := p.simulatePayment(orderID, method, "captured")
+	if err != nil {
+		return "", "", err
+	}
+	return payment.ID, signHex(p.secret, []byte(orderID+"|"+payment.ID)), nil
+}
+
+// SimulatePaymentFailure records a failed attempt against the order.
+func (p *FakeProvider) SimulatePaymentFailure(orderID string, method string) (paymentID string, err error) {
+	payment, err := p.simulatePayment(orderID, method, "failed")
+	if err != nil {
+		return "", err
+	}
+	return payment.ID, nil
+}
+
+func (p *FakeProvider) simulatePayment(orderID string, method string, status string) (*Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, ok := p.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if order.Status == "paid" {
+		return nil, fmt.Errorf("order %s is already paid", orderID)
+	}
+	if method == "" {
+		method = "upi"
+	}
+
+	payment := &Payment{
+		ID:            p.nextID("pay"),
+		OrderID:       orderID,
+		AmountInPaise: order.AmountInPaise,
+		Currency:      order.Currency,
+		Method:        method,
+		Status:        status,
+		CreatedAt:     p.now(),
+	}
+	p.payments[payment.ID] = payment
+
+	if status == "captured" {
+		order.Status = "paid"
+	} else {
+		order.Status = "attempted"
+	}
+
+	copied := *payment
+	return &copied, nil
+}
+
+// Webhook is a signed delivery ready to be posted to /webhooks/razorpay.
+type Webhook struct {
+	EventID   string
+	Event     string
+	Body      []byte
+	Signature string
+}
+
+// SimulateWebhook builds a Razorpay-shaped webhook for the current state of
+// a payment: payment.captured, payment.failed, order.paid or refund.processed.
+func (p *FakeProvider) SimulateWebhook(event string, paymentID string) (*Webhook, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+
+	paymentEntity := map[string]interface{}{
+		"id":              payment.ID,
+		"order_id":        payment.OrderID,
+		"amount":          payment.AmountInPaise,
+		"amount_refunded": payment.AmountRefunded,
+		"currency":        payment.Currency,
+		"method":          payment.Method,
+		"status":          payment.Status,
+		"created_at":      payment.CreatedAt.Unix(),
+	}
+	payload := map[string]interface{}{
+		"payment": map[string]interface{}{"entity": paymentEntity},
+	}
+
+	switch event {
+	case "payment.captured", "payment.failed":
+	case "order.paid":
+		payload["order"] = map[string]interface{}{
+			"entity": map[string]interface{}{"id": payment.OrderID, "status": "paid"},
+		}
+	case "refund.processed":
+		refunds := p.refunds[paymentID]
+		if len(refunds) == 0 {
+			return nil, fmt.Errorf("payment %s has no refunds", paymentID)
+		}
+		last := refunds[len(refunds)-1]
+		payload["refund"] = map[string]interface{}{
+			"entity": map[string]interface{}{
+				"id":         last.ID,
+				"payment_id": last.PaymentID,
+				"amount":     last.AmountInPaise,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported webhook event %q", event)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"entity":   "event",
+		"event":    event,
+		"payload":  payload,
+		"contains": []string{"payment"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook{
+		EventID:   p.nextID("evt"),
+		Event:     event,
+		Body:      body,
+		Signature: signHex(p.webhookSecret, body),
+	}, nil
+}
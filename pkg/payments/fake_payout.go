@@ -0,0 +1,96 @@
+package payments
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakePayoutProvider keeps payouts in memory for local development. Every
+// payout starts processing and is settled with SimulatePayoutPaid or
+// SimulatePayoutFailed.
+type FakePayoutProvider struct {
+	mu      sync.Mutex
+	seq     int
+	payouts map[string]*PayoutResult
+	byRef   map[string]string
+}
+
+func NewFakePayoutProvider() *FakePayoutProvider {
+	return &FakePayoutProvider{
+		payouts: map[string]*PayoutResult{},
+		byRef:   map[string]string{},
+	}
+}
+
+func (p *FakePayoutProvider) Name() string {
+	return PayoutProviderFake
+}
+
+func (p *FakePayoutProvider) InitiatePayout(instruction PayoutInstruction) (*PayoutResult, error) {
+	if instruction.AmountInPaise <= 0 {
+		return nil, fmt.Errorf("payout amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Same reference, same payout: retries never pay twice
+	if id, ok := p.byRef[instruction.ReferenceID]; ok {
+		copied := *p.payouts[id]
+		return &copied, nil
+	}
+
+	p.seq++
+	result := &PayoutResult{
+		ProviderPayoutID: fmt.Sprintf("pout_fake%08d", p.seq),
+		Status:           PayoutProcessing,
+	}
+	p.payouts[result.ProviderPayoutID] = result
+	p.byRef[instruction.ReferenceID] = result.ProviderPayoutID
+
+	copied := *result
+	return &copied, nil
+}
+
+func (p *FakePayoutProvider) FetchPayout(providerPayoutID string) (*PayoutResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.payouts[providerPayoutID]
+	if !ok {
+		return nil, ErrPayoutNotFound
+	}
+
+	copied := *result
+	return &copied, nil
+}
+
+// SimulatePayoutPaid settles a processing payout.
+func (p *FakePayoutProvider) SimulatePayoutPaid(providerPayoutID string) error {
+	return p.settle(providerPayoutID, PayoutPaid, "")
+}
+
+// SimulatePayoutFailed fails a processing payout with the given reason.
+func (p *FakePayoutProvider) SimulatePayoutFailed(providerPayoutID string, reason string) error {
+	return p.settle(providerPayoutID, PayoutFailed, reason)
+}
+
+func (p *FakePayoutProvider) settle(providerPayoutID string, status string, reason string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.payouts[providerPayoutID]
+	if !ok {
+		return ErrPayoutNotFound
+	}
+	if result.Status != PayoutProcessing {
+		return fmt.Errorf("payout %s is already %s", providerPayoutID, result.Status)
+	}
+
+	result.Status = status
+	result.FailureReason = reason
+	if status == PayoutPaid {
+		result.UTR = "utr_" + providerPayoutID
+	}
+	return nil
+}
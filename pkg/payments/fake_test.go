@@ -0,0 +1,123 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFakeProviderPaymentSignature(t *testing.T) {
+	p := NewFakeProvider("secret", "")
+	order, err := p.CreateOrder(50000, "INR", "slot_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paymentID, signature, err := p.SimulatePaymentSuccess(order.ID, "upi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		provider  *FakeProvider
+		orderID   string
+		paymentID string
+		signature string
+		want      bool
+	}{
+		{"valid", p, order.ID, paymentID, signature, true},
+		{"other order", p, "order_other", paymentID, signature, false},
+		{"other payment", p, order.ID, "pay_other", signature, false},
+		{"tampered signature", p, order.ID, paymentID, signature[:len(signature)-1] + "0", false},
+		{"empty signature", p, order.ID, paymentID, "", false},
+		{"other secret", NewFakeProvider("other", ""), order.ID, paymentID, signature, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.VerifyPaymentSignature(tt.orderID, tt.paymentID, tt.signature); got != tt.want {
+				t.Errorf("VerifyPaymentSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeProviderWebhookSignature(t *testing.T) {
+	p := NewFakeProvider("", "hook")
+	order, _ := p.CreateOrder(50000, "INR", "slot_1")
+	paymentID, _, _ := p.SimulatePaymentSuccess(order.ID, "card")
+
+	hook, err := p.SimulateWebhook("payment.captured", paymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", hook.Body, hook.Signature, true},
+		{"changed body", append([]byte(" "), hook.Body...), hook.Signature, false},
+		{"payment signature scheme", hook.Body, signHex(p.secret, hook.Body), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.VerifyWebhookSignature(tt.body, tt.signature); got != tt.want {
+				t.Errorf("VerifyWebhookSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeProviderRefundLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		refunds      []int64 // issued in order; the last one is checked
+		wantErr      error
+		wantRefunded int64
+		wantStatus   string
+	}{
+		{"partial", []int64{20000}, nil, 20000, "captured"},
+		{"full", []int64{50000}, nil, 50000, "refunded"},
+		{"partial then rest", []int64{20000, 30000}, nil, 50000, "refunded"},
+		{"more than paid", []int64{50001}, ErrInvalidRefund, 0, "captured"},
+		{"more than left", []int64{40000, 10001}, ErrInvalidRefund, 40000, "captured"},
+		{"after full refund", []int64{50000, 1}, ErrInvalidRefund, 50000, "refunded"},
+		{"zero", []int64{0}, ErrInvalidRefund, 0, "captured"},
+		{"negative", []int64{-100}, ErrInvalidRefund, 0, "captured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewFakeProvider("", "")
+			order, _ := p.CreateOrder(50000, "INR", "slot_1")
+			paymentID, _, _ := p.SimulatePaymentSuccess(order.ID, "upi")
+
+			var err error
+			for _, amount := range tt.refunds {
+				_, err = p.Refund(paymentID, amount, nil)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refund() error = %v, want %v", err, tt.wantErr)
+			}
+
+			payment, _ := p.FetchPayment(paymentID)
+			if payment.AmountRefunded != tt.wantRefunded || payment.Status != tt.wantStatus {
+				t.Errorf("payment refunded %d (%s), want %d (%s)",
+					payment.AmountRefunded, payment.Status, tt.wantRefunded, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFakeProviderRefundUnknownOrFailedPayment(t *testing.T) {
+	p := NewFakeProvider("", "")
+	order, _ := p.CreateOrder(50000, "INR", "slot_1")
+	failedID, _ := p.SimulatePaymentFailure(order.ID, "card")
+
+	if _, err := p.Refund("pay_missing", 100, nil); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("Refund() of unknown payment error = %v, want %v", err, ErrPaymentNotFound)
+	}
+	if _, err := p.Refund(failedID, 100, nil); err == nil {
+		t.Error("Refund() of failed payment succeeded")
+	}
+}
@@ -0,0 +1,73 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Payout provider names accepted by config (PAYOUT_PROVIDER)
+const (
+	PayoutProviderManual = "manual"
+	PayoutProviderFake   = "fake"
+)
+
+// Payout statuses reported by a provider
+const (
+	PayoutProcessing = "processing"
+	PayoutPaid       = "paid"
+	PayoutFailed     = "failed"
+)
+
+var ErrPayoutNotFound = errors.New("payout not found")
+
+// PayoutProvider moves money from the platform to an expert's bank account
+// or UPI ID. Amounts are in paise.
+type PayoutProvider interface {
+	Name() string
+	// InitiatePayout starts a transfer. The result is usually processing;
+	// a provider may also settle (paid) or reject (failed) it immediately.
+	InitiatePayout(instruction PayoutInstruction) (*PayoutResult, error)
+	// FetchPayout reports the current state of a transfer started earlier
+	FetchPayout(providerPayoutID string) (*PayoutResult, error)
+}
+
+type PayoutInstruction struct {
+	ReferenceID   string // our payout UUID, used by providers to dedupe
+	AmountInPaise int64
+	Method        string // bank, upi
+
+	AccountHolderName string
+	AccountNumber     string
+	IFSC              string
+	UPIID             string
+}
+
+type PayoutResult struct {
+	ProviderPayoutID string
+	Status           string // processing, paid, failed
+	FailureReason    string
+	UTR              string // bank reference once paid
+}
+
+// ManualPayoutProvider is used while transfers are made by hand from the
+// company account. Every payout stays processing until an admin settles it.
+type ManualPayoutProvider struct{}
+
+func NewManualPayoutProvider() *ManualPayoutProvider {
+	return &ManualPayoutProvider{}
+}
+
+func (p *ManualPayoutProvider) Name() string {
+	return PayoutProviderManual
+}
+
+func (p *ManualPayoutProvider) InitiatePayout(instruction PayoutInstruction) (*PayoutResult, error) {
+	return &PayoutResult{
+		ProviderPayoutID: fmt.Sprintf("manual_%s", instruction.ReferenceID),
+		Status:           PayoutProcessing,
+	}, nil
+}
+
+func (p *ManualPayoutProvider) FetchPayout(providerPayoutID string) (*PayoutResult, error) {
+	return &PayoutResult{ProviderPayoutID: providerPayoutID, Status: PayoutProcessing}, nil
+}
@@ -0,0 +1,85 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Provider names accepted by config (PAYMENT_PROVIDER)
+const (
+	ProviderRazorpay = "razorpay"
+	ProviderFake     = "fake"
+)
+
+var (
+	ErrOrderNotFound   = errors.New("payment order not found")
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrInvalidRefund   = errors.New("refund amount exceeds refundable balance")
+)
+
+// PaymentProvider is everything the booking flow needs from a payment
+// gateway. Amounts are always in paise.
+type PaymentProvider interface {
+	Name() string
+	// KeyID is the public key the frontend passes to the checkout widget
+	KeyID() string
+
+	CreateOrder(amountInPaise int64, currency string, receipt string) (*Order, error)
+	FetchPayment(paymentID string) (*Payment, error)
+	Refund(paymentID string, amountInPaise int64, notes map[string]string) (*Refund, error)
+
+	// ListOrders and ListPayments return everything created in [from, to),
+	// for reconciliation against local records
+	ListOrders(from time.Time, to time.Time) ([]Order, error)
+	ListPayments(from time.Time, to time.Time) ([]Payment, error)
+
+	// VerifyPaymentSignature checks the signature checkout returns to the client
+	VerifyPaymentSignature(orderID string, paymentID string, signature string) bool
+	// VerifyWebhookSignature checks the signature header of a webhook body
+	VerifyWebhookSignature(body []byte, signature string) bool
+}
+
+type Order struct {
+	ID            string
+	AmountInPaise int64
+	Currency      string
+	Receipt       string
+	Status        string // created, attempted, paid
+	CreatedAt     time.Time
+}
+
+type Payment struct {
+	ID             string
+	OrderID        string
+	AmountInPaise  int64
+	AmountRefunded int64
+	Currency       string
+	Method         string // upi, card, ...
+	Status         string // created, authorized, captured, refunded, failed
+	CreatedAt      time.Time
+}
+
+type Refund struct {
+	ID            string
+	PaymentID     string
+	AmountInPaise int64
+	Status        string
+}
+
+// signHex returns the hex HMAC-SHA256 of data, the scheme Razorpay uses for
+// both checkout and webhook signatures.
+func signHex(secret string, data []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func verifyHex(secret string, data []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	return hmac.Equal([]byte(signHex(secret, data)), []byte(signature))
+}
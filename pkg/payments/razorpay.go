@@ -0,0 +1,198 @@
+package payments
+
+import (
+	"errors"
+	"time"
+
+	"github.com/razorpay/razorpay-go"
+)
+
+// RazorpayProvider talks to the live Razorpay API.
+type RazorpayProvider struct {
+	client        *razorpay.Client
+	key           string
+	secret        string
+	webhookSecret string
+}
+
+func NewRazorpayProvider(key string, secret string, webhookSecret string) (*RazorpayProvider, error) {
+	if key == "" || secret == "" {
+		return nil, errors.New("missing Razorpay credentials")
+	}
+
+	return &RazorpayProvider{
+		client:        razorpay.NewClient(key, secret),
+		key:           key,
+		secret:        secret,
+		webhookSecret: webhookSecret,
+	}, nil
+}
+
+func (p *RazorpayProvider) Name() string {
+	return ProviderRazorpay
+}
+
+func (p *RazorpayProvider) KeyID() string {
+	return p.key
+}
+
+func (p *RazorpayProvider) CreateOrder(amountInPaise int64, currency string, receipt string) (*Order, error) {
+	order, err := p.client.Order.Create(map[string]interface{}{
+		"amount":   amountInPaise,
+		"currency": currency,
+		"receipt":  receipt,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := order["id"].(string)
+	if id == "" {
+		return nil, errors.New("razorpay order response has no id")
+	}
+
+	status, _ := order["status"].(string)
+	return &Order{
+		ID:            id,
+		AmountInPaise: amountInPaise,
+		Currency:      currency,
+		Receipt:       receipt,
+		Status:        status,
+	}, nil
+}
+
+func (p *RazorpayProvider) FetchPayment(paymentID string) (*Payment, error) {
+	payment, err := p.client.Payment.Fetch(paymentID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return razorpayPayment(payment), nil
+}
+
+func (p *RazorpayProvider) Refund(paymentID string, amountInPaise int64, notes map[string]string) (*Refund, error) {
+	data := map[string]interface{}{}
+	if len(notes) > 0 {
+		data["notes"] = notes
+	}
+
+	refund, err := p.client.Payment.Refund(paymentID, int(amountInPaise), data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := refund["id"].(string)
+	status, _ := refund["status"].(string)
+	return &Refund{
+		ID:            id,
+		PaymentID:     paymentID,
+		AmountInPaise: amountInPaise,
+		Status:        status,
+	}, nil
+}
+
+// razorpayPageSize is the largest page the list APIs return.
+const razorpayPageSize = 100
+
+// listAll pages through a Razorpay list API for entities created in [from, to).
+func listAll(list func(map[string]interface{}, map[string]string) (map[string]interface{}, error), from time.Time, to time.Time) ([]map[string]interface{}, error) {
+	var entities []map[string]interface{}
+	for skip := 0; ; skip += razorpayPageSize {
+		page, err := list(map[string]interface{}{
+			"from":  from.Unix(),
+			"to":    to.Unix() - 1, // the API's "to" is inclusive
+			"count": razorpayPageSize,
+			"skip":  skip,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		items, _ := page["items"].([]interface{})
+		for _, item := range items {
+			if entity, ok := item.(map[string]interface{}); ok {
+				entities = append(entities, entity)
+			}
+		}
+		if len(items) < razorpayPageSize {
+			return entities, nil
+		}
+	}
+}
+
+func (p *RazorpayProvider) ListOrders(from time.Time, to time.Time) ([]Order, error) {
+	entities, err := listAll(p.client.Order.All, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(entities))
+	for _, entity := range entities {
+		orders = append(orders, *razorpayOrder(entity))
+	}
+	return orders, nil
+}
+
+func (p *RazorpayProvider) ListPayments(from time.Time, to time.Time) ([]Payment, error) {
+	entities, err := listAll(p.client.Payment.All, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]Payment, 0, len(entities))
+	for _, entity := range entities {
+		payments = append(payments, *razorpayPayment(entity))
+	}
+	return payments, nil
+}
+
+func (p *RazorpayProvider) VerifyPaymentSignature(orderID string, paymentID string, signature string) bool {
+	return verifyHex(p.secret, []byte(orderID+"|"+paymentID), signature)
+}
+
+func (p *RazorpayProvider) VerifyWebhookSignature(body []byte, signature string) bool {
+	return verifyHex(p.webhookSecret, body, signature)
+}
+
+// razorpayPayment converts a payment entity from the API's generic JSON map.
+func razorpayPayment(entity map[string]interface{}) *Payment {
+	str := func(key string) string {
+		v, _ := entity[key].(string)
+		return v
+	}
+	num := func(key string) int64 {
+		v, _ := entity[key].(float64)
+		return int64(v)
+	}
+
+	return &Payment{
+		ID:             str("id"),
+		OrderID:        str("order_id"),
+		AmountInPaise:  num("amount"),
+		AmountRefunded: num("amount_refunded"),
+		Currency:       str("currency"),
+		Method:         str("method"),
+		Status:         str("status"),
+		CreatedAt:      time.Unix(num("created_at"), 0),
+	}
+}
+
+// razorpayOrder converts an order entity from the API's generic JSON map.
+func razorpayOrder(entity map[string]interface{}) *Order {
+	str := func(key string) string {
+		v, _ := entity[key].(string)
+		return v
+	}
+	num := func(key string) int64 {
+		v, _ := entity[key].(float64)
+		return int64(v)
+	}
+
+	return &Order{
+		ID:            str("id"),
+		AmountInPaise: num("amount"),
+		Currency:      str("currency"),
+		Receipt:       str("receipt"),
+		Status:        str("status"),
+		CreatedAt:     time.Unix(num("created_at"), 0),
+	}
+}
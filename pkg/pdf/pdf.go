@@ -0,0 +1,118 @@
+// Package pdf writes simple single-page PDF documents: text in the standard
+// Helvetica fonts and straight lines. It exists so invoices can be rendered
+// without an external service or a heavyweight dependency.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points.
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+// Document is one A4 page. Coordinates are in points from the top-left
+// corner, which is easier to lay out than PDF's bottom-left origin.
+type Document struct {
+	content bytes.Buffer
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// Text draws s with its baseline at (x, y). Characters outside Latin-1 are
+// replaced with '?', since the standard fonts cannot show them.
+func (d *Document) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&d.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, x, PageHeight-y, escape(s))
+}
+
+// TextRight draws s so that it ends at x. Widths are estimated, which is
+// close enough for right-aligning columns of figures.
+func (d *Document) TextRight(x, y, size float64, bold bool, s string) {
+	d.Text(x-textWidth(s, size), y, size, bold, s)
+}
+
+// Line draws a thin line from (x1, y1) to (x2, y2).
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&d.content, "0.5 w %.2f %.2f m %.2f %.2f l S\n",
+		x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// Bytes returns the finished PDF file.
+func (d *Document) Bytes() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", PageWidth, PageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", d.content.Len(), d.content.String()),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return out.Bytes()
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		case r > 126:
+			// Latin-1 matches WinAnsi here; write the single byte as an octal escape
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// textWidth estimates the width of s in Helvetica: digits and most letters
+// are a little over half the font size wide.
+func textWidth(s string, size float64) float64 {
+	var units float64
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == '.' || r == ',' || r == ':' || r == 'i' || r == 'l':
+			units += 0.28
+		case r >= 'A' && r <= 'Z':
+			units += 0.67
+		default:
+			units += 0.556
+		}
+	}
+	return units * size
+}
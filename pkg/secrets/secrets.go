@@ -0,0 +1,73 @@
+// Package secrets encrypts small sensitive values (bank and UPI details)
+// before they are stored, using AES-256-GCM.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+var (
+	ErrInvalidKey       = errors.New("encryption key must be 32 bytes, base64 encoded")
+	ErrMalformedCipher  = errors.New("malformed ciphertext")
+	ErrKeyNotConfigured = errors.New("encryption key is not configured")
+)
+
+// Box seals and opens values with a single key.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox builds a Box from a base64 encoded 32 byte key.
+func NewBox(encodedKey string) (*Box, error) {
+	if encodedKey == "" {
+		return nil, ErrKeyNotConfigured
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext and returns base64(nonce || ciphertext).
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open reverses Seal.
+func (b *Box) Open(encoded string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrMalformedCipher
+	}
+
+	size := b.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, ErrMalformedCipher
+	}
+
+	return b.aead.Open(nil, sealed[:size], sealed[size:], nil)
+}
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"interviewexcel-backend-go/controllers"
+	"interviewexcel-backend-go/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAdminRoutes(router *gin.Engine) {
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(middleware.AuthMiddleware(), middleware.RequireRole("admin"))
+
+	adminGroup.PUT("/experts/:user_uuid/commission", controllers.SetExpertCommissionHandler)
+	adminGroup.GET("/disputes", controllers.ListDisputesHandler)
+	adminGroup.POST("/disputes/:dispute_id/resolve", controllers.ResolveDisputeHandler)
+
+	adminGroup.GET("/coupons", controllers.ListCouponsHandler)
+	adminGroup.POST("/coupons", controllers.CreateCouponHandler)
+	adminGroup.POST("/coupons/:coupon_id/deactivate", controllers.DeactivateCouponHandler)
+
+	adminGroup.GET("/packages", controllers.ListAllPackagesHandler)
+	adminGroup.POST("/packages", controllers.CreatePackageHandler)
+	adminGroup.POST("/packages/:package_id/deactivate", controllers.DeactivatePackageHandler)
+
+	adminGroup.GET("/plans", controllers.ListAllPlansHandler)
+	adminGroup.POST("/plans", controllers.CreatePlanHandler)
+	adminGroup.POST("/plans/:plan_id/deactivate", controllers.DeactivatePlanHandler)
+
+	adminGroup.POST("/students/:user_uuid/wallet-credits", controllers.GrantWalletCreditHandler)
+
+	adminGroup.GET("/payments/funnel", controllers.PaymentFunnelHandler)
+
+	adminGroup.GET("/payouts", controllers.ListPayoutsHandler)
+	adminGroup.GET("/payouts/:payout_uuid", controllers.GetPayoutHandler)
+	adminGroup.POST("/payouts/:payout_uuid/approve", controllers.ApprovePayoutHandler)
+	adminGroup.POST("/payouts/:payout_uuid/reject", controllers.RejectPayoutHandler)
+	adminGroup.POST("/payouts/:payout_uuid/settle", controllers.SettlePayoutHandler)
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/controllers"
+	"interviewexcel-backend-go/pkg/payments"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterDevRoutes exposes the fake providers' simulation helpers. Each
+// group is only registered while the matching fake provider is active.
+func RegisterDevRoutes(router *gin.Engine) {
+	if _, ok := config.Payments.(*payments.FakeProvider); ok {
+		devGroup := router.Group("/dev/payments")
+		devGroup.POST("/orders/:order_id/succeed", controllers.FakePaymentSuccessHandler)
+		devGroup.POST("/orders/:order_id/fail", controllers.FakePaymentFailureHandler)
+		devGroup.POST("/:payment_id/webhook", controllers.FakeWebhookHandler)
+	}
+
+	if _, ok := config.Payouts.(*payments.FakePayoutProvider); ok {
+		devGroup := router.Group("/dev/payouts")
+		devGroup.POST("/:provider_payout_id/paid", controllers.FakePayoutPaidHandler)
+		devGroup.POST("/:provider_payout_id/fail", controllers.FakePayoutFailedHandler)
+	}
+}
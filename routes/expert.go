@@ -10,7 +10,7 @@ import (
 func RegisterExpertRoutes(router *gin.Engine) {
 	// Protected routes
 	expertGroup := router.Group("/expert")
-	expertGroup.Use(middleware.AuthMiddleware()) // ✅ Apply middleware here
+	expertGroup.Use(middleware.AuthMiddleware(), middleware.RequireRole("expert")) // ✅ Apply middleware here
 
 	// authexpertGroup.POST("/generate-slots", controllers.GenerateWeeklyAvailability)
 	expertGroup.GET("/profile", controllers.GetExpertProfile)
@@ -19,6 +19,29 @@ func RegisterExpertRoutes(router *gin.Engine) {
 	expertGroup.POST("/generate-slots", controllers.GenerateWeeklyAvailability)
 	expertGroup.GET("/all-slots", controllers.GetAllSlotsOfExpert)
 	expertGroup.DELETE("/availability/:slot_id", controllers.CancelSlotOfExpert)
+
+	// Recurring availability; slots are kept generated AVAILABILITY_HORIZON_WEEKS ahead
+	expertGroup.GET("/availability-rules", controllers.ListAvailabilityRulesHandler)
+	expertGroup.POST("/availability-rules", controllers.CreateAvailabilityRuleHandler)
+	expertGroup.PUT("/availability-rules/:rule_id", controllers.UpdateAvailabilityRuleHandler)
+	expertGroup.DELETE("/availability-rules/:rule_id", controllers.DeleteAvailabilityRuleHandler)
+
+	// Time off; vacation blackouts also hide the expert from the listing
+	expertGroup.GET("/blackouts", controllers.ListBlackoutsHandler)
+	expertGroup.POST("/blackouts", controllers.CreateBlackoutHandler)
+	expertGroup.DELETE("/blackouts/:blackout_id", controllers.DeleteBlackoutHandler)
+
+	// Buffer, daily/weekly caps, notice and how far ahead students may book
+	expertGroup.GET("/scheduling", controllers.GetSchedulingHandler)
+	expertGroup.PUT("/scheduling", controllers.UpdateSchedulingHandler)
 	expertGroup.GET("/dashboard", controllers.GetExpertDashboard)
+	expertGroup.POST("/sessions/:session_uuid/cancel", controllers.CancelExpertSessionHandler)
+	expertGroup.POST("/sessions/:session_uuid/join", controllers.JoinExpertSessionHandler)
+	expertGroup.GET("/wallet/transactions", controllers.GetWalletTransactionsHandler)
+	expertGroup.GET("/wallet/statement.csv", controllers.GetWalletStatementCSVHandler)
+	expertGroup.GET("/payout-account", controllers.GetPayoutAccountHandler)
+	expertGroup.PUT("/payout-account", controllers.SavePayoutAccountHandler)
+	expertGroup.GET("/payouts", controllers.ListExpertPayoutsHandler)
+	expertGroup.POST("/payouts", middleware.Idempotency(), controllers.RequestPayoutHandler)
 	// Add more protected expert routes here
 }
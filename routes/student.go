@@ -19,9 +19,37 @@ func RegisterStudentRoutes(r *gin.Engine) {
 	// studentRoutes.GET("/bookings", controllers.GetStudentBookingsHandler)
 	// studentRoutes.POST("/preview-slot", controllers.PreviewSlotForPaymentHandler)
 
-	studentRoutes.POST("/book-slot/:slot_id", controllers.InitiateBookingHandler)
-	studentRoutes.POST("/confirm-booking", controllers.ConfirmPaymentHandler)
+	// Retries carrying the same Idempotency-Key replay the first response
+	studentRoutes.POST("/book-slot/:slot_id", middleware.Idempotency(), controllers.InitiateBookingHandler)
+	studentRoutes.POST("/confirm-booking", middleware.Idempotency(), controllers.ConfirmPaymentHandler)
+	studentRoutes.POST("/coupons/validate", controllers.ValidateCouponHandler)
+
+	// Prepaid session packages; book with {"use_credit": true} on /book-slot
+	studentRoutes.GET("/packages", controllers.ListPackagesHandler)
+	studentRoutes.POST("/packages/:package_id/purchase", middleware.Idempotency(), controllers.PurchasePackageHandler)
+	studentRoutes.POST("/packages/confirm", middleware.Idempotency(), controllers.ConfirmPackagePurchaseHandler)
+	studentRoutes.GET("/credits", controllers.GetStudentCreditsHandler)
+
+	// Monthly plans; each paid period issues session credits like a package
+	studentRoutes.GET("/plans", controllers.ListPlansHandler)
+	studentRoutes.GET("/subscription", controllers.GetSubscriptionHandler)
+	studentRoutes.POST("/subscription", middleware.Idempotency(), controllers.SubscribeHandler)
+	studentRoutes.POST("/subscription/confirm", middleware.Idempotency(), controllers.ConfirmSubscriptionPaymentHandler)
+	studentRoutes.POST("/subscription/upgrade", middleware.Idempotency(), controllers.UpgradeSubscriptionHandler)
+	studentRoutes.POST("/subscription/cancel", controllers.CancelSubscriptionHandler)
+	studentRoutes.POST("/subscription/resume", controllers.ResumeSubscriptionHandler)
+
+	// Wallet credits from refunds and promotions; pay with {"use_wallet": true} on /book-slot
+	studentRoutes.GET("/wallet", controllers.GetStudentWalletHandler)
+	studentRoutes.GET("/wallet/transactions", controllers.GetWalletTransactionsHandler)
+
+	// Tax invoice for a paid order, as PDF or ?format=html
+	studentRoutes.GET("/payments/:order_id/invoice", controllers.GetPaymentInvoiceHandler)
 
 	// Fetch all sessions (upcoming or past) for the student
 	studentRoutes.GET("/sessions", controllers.GetStudentSessions)
+	studentRoutes.POST("/sessions/:session_uuid/cancel", controllers.CancelStudentSessionHandler)
+	studentRoutes.POST("/sessions/:session_uuid/reschedule", controllers.RescheduleSessionHandler)
+	studentRoutes.POST("/sessions/:session_uuid/dispute", controllers.RaiseDisputeHandler)
+	studentRoutes.POST("/sessions/:session_uuid/join", controllers.JoinStudentSessionHandler)
 }
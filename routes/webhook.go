@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"interviewexcel-backend-go/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterWebhookRoutes wires payment gateway callbacks. These routes are
+// public; each handler authenticates the request by its signature.
+func RegisterWebhookRoutes(router *gin.Engine) {
+	router.POST("/webhooks/razorpay", controllers.RazorpayWebhookHandler)
+}
@@ -17,7 +17,7 @@ func GenerateWeeklyAvailability(c *gin.Context) {
 		return
 	}
 
-	slots := GenerateWeeklySlots(input.ExpertID)
+	slots := GenerateWeeklySlots(input.ExpertID, UserLocation(config.DB, input.ExpertID))
 
 	if err := config.DB.Create(&slots).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create availability slots"})
@@ -5,9 +5,11 @@ import (
 	"time"
 )
 
-func GenerateWeeklySlots(expertID string) []models.AvailabilitySlot {
+// GenerateWeeklySlots creates hourly slots from 9 AM to 9 PM for the next
+// seven days, in the expert's zone loc. Slot times are stored in UTC.
+func GenerateWeeklySlots(expertID string, loc *time.Location) []models.AvailabilitySlot {
 	var slots []models.AvailabilitySlot
-	now := time.Now()
+	now := time.Now().In(loc)
 
 	startHour := 9 // 9 AM
 	endHour := 21  // 9 PM (exclusive, generates 12 slots per day)
@@ -15,14 +17,14 @@ func GenerateWeeklySlots(expertID string) []models.AvailabilitySlot {
 	for day := 0; day < 7; day++ {
 		currentDate := now.AddDate(0, 0, day)
 		for hour := startHour; hour < endHour; hour++ {
-			startTime := time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), hour, 0, 0, 0, time.UTC)
+			startTime := time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), hour, 0, 0, 0, loc)
 			endTime := startTime.Add(time.Hour)
 
 			slots = append(slots, models.AvailabilitySlot{
 				ExpertID:  expertID,
-				Date:      currentDate,
-				StartTime: startTime,
-				EndTime:   endTime,
+				Date:      time.Date(currentDate.Year(), currentDate.Month(), currentDate.Day(), 0, 0, 0, 0, time.UTC),
+				StartTime: startTime.UTC(),
+				EndTime:   endTime.UTC(),
 				Status:    string(models.SlotAvailable),
 			})
 		}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"interviewexcel-backend-go/config"
+	"interviewexcel-backend-go/models"
+	"time"
+	_ "time/tzdata" // zone data for images without /usr/share/zoneinfo
+
+	"gorm.io/gorm"
+)
+
+// Times are stored as UTC instants. Wall-clock input such as an expert's
+// "18:00" is read in the expert's zone, and responses are rendered in the
+// viewer's zone.
+
+// ValidTimeZone reports whether name is an IANA zone such as "Asia/Kolkata".
+func ValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// LoadLocation returns the named zone, or the default zone when the name is
+// empty or unknown.
+func LoadLocation(name string) *time.Location {
+	if ValidTimeZone(name) {
+		loc, _ := time.LoadLocation(name)
+		return loc
+	}
+	loc, err := time.LoadLocation(config.RuntimeConfig().DefaultTimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// UserLocation returns the zone set on the user's profile, or the default
+// zone.
+func UserLocation(db *gorm.DB, userUUID string) *time.Location {
+	user, err := models.InitUserRepo(db).GetByUUID(userUUID)
+	if err != nil {
+		return LoadLocation("")
+	}
+	return LoadLocation(user.TimeZone)
+}